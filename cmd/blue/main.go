@@ -0,0 +1,191 @@
+// Command blue provides tools for blue programs.
+//
+// Usage:
+//
+//	blue compile <file>
+//	blue disasm <file>
+//	blue ir <file>
+//
+// compile writes the bytecode of file to file with a .bluec extension.
+// disasm prints the disassembly of file, which is either a program
+// or bytecode written by compile. ir prints the SSA form of the
+// program in file after copy propagation and common subexpression
+// elimination.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/compiler"
+	"github.com/lindeneg/blue/lang/ir"
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/optimize"
+	"github.com/lindeneg/blue/lang/parser"
+	"github.com/lindeneg/blue/lang/resolve"
+)
+
+const usage = `usage: blue <command> [arguments]
+
+commands:
+	compile <file>	write the bytecode of file to a .bluec file
+	disasm <file>	print the bytecode of file
+	ir <file>	print the optimized ir of file
+`
+
+const bytecodeExt = ".bluec"
+
+// errFailed is returned once the errors of a command are reported
+var errFailed = errors.New("failed")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "compile":
+		err = compileFile(args)
+	case "disasm":
+		err = disasm(args)
+	case "ir":
+		err = dumpIR(args)
+	default:
+		fmt.Fprintf(os.Stderr, "blue: unknown command %q\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		if err != errFailed {
+			fmt.Fprintf(os.Stderr, "blue: %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func disasm(args []string) error {
+	if len(args) != 1 {
+		return errors.New("disasm requires one file")
+	}
+	bc, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	return bc.Disassemble(os.Stdout)
+}
+
+func dumpIR(args []string) error {
+	if len(args) != 1 {
+		return errors.New("ir requires one file")
+	}
+	l, program, table, err := resolveFile(args[0])
+	if err != nil {
+		return err
+	}
+	b := ir.New(l, args[0])
+	prog := b.Build(program, table)
+	if b.HasErrors() {
+		for _, e := range b.Errors() {
+			fmt.Fprintln(os.Stderr, e.Msg)
+		}
+		return errFailed
+	}
+	prog.Run(ir.CopyPropagation, ir.CSE)
+	if err := prog.Verify(); err != nil {
+		return err
+	}
+	fmt.Print(prog)
+	return nil
+}
+
+func compileFile(args []string) error {
+	if len(args) != 1 {
+		return errors.New("compile requires one file")
+	}
+	bc, err := compile(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := compiler.Marshal(bc)
+	if err != nil {
+		return err
+	}
+	out := strings.TrimSuffix(args[0], filepath.Ext(args[0])) + bytecodeExt
+	return os.WriteFile(out, data, 0o644)
+}
+
+// load decodes path if it is bytecode and compiles it otherwise
+func load(path string) (*compiler.Bytecode, error) {
+	if filepath.Ext(path) != bytecodeExt {
+		return compile(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := compiler.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bc, nil
+}
+
+// resolveFile parses and resolves the program in path, errors
+// of each stage are written to stderr before failing
+func resolveFile(path string) (*lexer.L, *ast.Program, *resolve.Table, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	l := lexer.New(source)
+	p := parser.New(l, path)
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		for _, e := range p.Errors() {
+			fmt.Fprintln(os.Stderr, e.Msg)
+		}
+		return nil, nil, nil, errFailed
+	}
+	r := resolve.New(l, path)
+	table := r.Resolve(program)
+	if r.HasErrors() {
+		for _, e := range r.Errors() {
+			fmt.Fprintln(os.Stderr, e.Msg)
+		}
+		return nil, nil, nil, errFailed
+	}
+	return l, program, table, nil
+}
+
+// compile compiles the program in path, errors of
+// each stage are written to stderr before failing
+func compile(path string) (*compiler.Bytecode, error) {
+	l, program, table, err := resolveFile(path)
+	if err != nil {
+		return nil, err
+	}
+	o := optimize.New(l, path)
+	o.Optimize(program)
+	for _, w := range o.Warnings() {
+		fmt.Fprintln(os.Stderr, w.Msg)
+	}
+	if o.HasErrors() {
+		for _, e := range o.Errors() {
+			fmt.Fprintln(os.Stderr, e.Msg)
+		}
+		return nil, errFailed
+	}
+	c := compiler.New(l, path)
+	bc := c.Compile(program, table)
+	if c.HasErrors() {
+		for _, e := range c.Errors() {
+			fmt.Fprintln(os.Stderr, e.Msg)
+		}
+		return nil, errFailed
+	}
+	return bc, nil
+}
@@ -84,12 +84,48 @@ func (al *Array) String() string {
 	return out.String()
 }
 
-// Function i.e def add(a, b) { return a + b; }
+// Parameter i.e a, port = 5432
+type Parameter struct {
+	Name *Identifier
+	// Default value, nil if the parameter is required
+	Default Expression
+}
+
+func (pa *Parameter) Literal() string { return pa.Name.Literal() }
+func (pa *Parameter) String() string {
+	if pa.Default == nil {
+		return pa.Name.String()
+	}
+	return pa.Name.String() + " = " + pa.Default.String()
+}
+
+// Receiver of a method i.e (p Point)
+type Receiver struct {
+	Name *Identifier
+	Type *Identifier
+}
+
+func (r *Receiver) Literal() string { return r.Name.Literal() }
+func (r *Receiver) String() string {
+	return "(" + r.Name.String() + " " + r.Type.String() + ")"
+}
+
+// Function i.e def add(a, b = 1, ...rest) { return a + b; }
+// or a method i.e fn (p Point) len() { return p.x + p.y; }
 type Function struct {
-	Token      token.T
+	Token token.T
+	// Receiver is set if the function is a method
+	Receiver   *Receiver
 	Name       *Identifier
-	Parameters []*Identifier
-	Body       *BlockStatement
+	Parameters []*Parameter
+	// Rest collects remaining arguments, nil if absent
+	Rest *Identifier
+	Body *BlockStatement
+	// Generator is set if Body contains a yield statement
+	Generator bool
+	// Async is set if the function is declared with async,
+	// calling it returns a future i.e async fn f() { ... }
+	Async bool
 }
 
 func (fl *Function) expression()     {}
@@ -100,8 +136,19 @@ func (fl *Function) String() string {
 	for _, p := range fl.Parameters {
 		params = append(params, p.String())
 	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
+	if fl.Async {
+		out.WriteString("async ")
+	}
 	out.WriteString(fl.Literal())
-	out.WriteString(" " + fl.Name.String())
+	if fl.Receiver != nil {
+		out.WriteString(" " + fl.Receiver.String())
+	}
+	if fl.Name != nil {
+		out.WriteString(" " + fl.Name.String())
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
@@ -109,10 +156,17 @@ func (fl *Function) String() string {
 	return out.String()
 }
 
-// Dict i.e |"foo": "bar", "baz": 1|
+// Dict i.e {"foo": "bar", "baz": 1}
 type Dict struct {
 	Token token.T
-	Pairs map[Expression]Expression
+	// Pairs in the order they are written
+	Pairs []Pair
+}
+
+// Pair is a key and its value in a Dict
+type Pair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (d *Dict) expression()     {}
@@ -120,8 +174,8 @@ func (d *Dict) Literal() string { return d.Token.Literal }
 func (d *Dict) String() string {
 	var out bytes.Buffer
 	var pairs []string
-	for key, value := range d.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range d.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
 	}
 	out.WriteString("|")
 	out.WriteString(strings.Join(pairs, ", "))
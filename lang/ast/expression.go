@@ -13,11 +13,67 @@ type Expression interface {
 	expression()
 }
 
-// IndexExpression i.e Left[Index]
+// ExpressionToken returns the token of expr, the
+// one errors about expr are reported at
+func ExpressionToken(expr Expression) token.T {
+	switch expr := expr.(type) {
+	case *Identifier:
+		return expr.Token
+	case *Number:
+		return expr.Token
+	case *String:
+		return expr.Token
+	case *Boolean:
+		return expr.Token
+	case *Array:
+		return expr.Token
+	case *Function:
+		return expr.Token
+	case *Dict:
+		return expr.Token
+	case *Null:
+		return expr.Token
+	case *IndexExpression:
+		return expr.Token
+	case *SliceExpression:
+		return expr.Token
+	case *MemberExpression:
+		return expr.Token
+	case *TernaryExpression:
+		return expr.Token
+	case *RangeExpression:
+		return expr.Token
+	case *PrefixExpression:
+		return expr.Token
+	case *Spread:
+		return expr.Token
+	case *PropagateExpression:
+		return expr.Token
+	case *InfixExpression:
+		return expr.Token
+	case *IfExpression:
+		return expr.Token
+	case *ForExpression:
+		return expr.Token
+	case *NamedArgument:
+		return expr.Token
+	case *SpawnExpression:
+		return expr.Token
+	case *AwaitExpression:
+		return expr.Token
+	case *CallExpression:
+		return expr.Token
+	}
+	return token.T{}
+}
+
+// IndexExpression i.e Left[Index] or Left?[Index]
 type IndexExpression struct {
 	Token token.T
 	Left  Expression
 	Index Expression
+	// Optional evaluates to null if Left is null
+	Optional bool
 }
 
 func (ie *IndexExpression) expression()     {}
@@ -26,12 +82,123 @@ func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
 	return out.String()
 }
 
+// SliceExpression i.e Left[Start:End:Step], every part is optional
+type SliceExpression struct {
+	Token token.T
+	Left  Expression
+	// Start, End and Step are nil if omitted
+	Start Expression
+	End   Expression
+	Step  Expression
+	// Optional evaluates to null if Left is null
+	Optional bool
+}
+
+func (se *SliceExpression) expression()     {}
+func (se *SliceExpression) Literal() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	if se.Optional {
+		out.WriteString("?")
+	}
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	if se.Step != nil {
+		out.WriteString(":" + se.Step.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
+// MemberExpression i.e Left?.Member
+type MemberExpression struct {
+	Token  token.T
+	Left   Expression
+	Member *Identifier
+	// Optional evaluates to null if Left is null
+	Optional bool
+}
+
+func (me *MemberExpression) expression()     {}
+func (me *MemberExpression) Literal() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	op := "."
+	if me.Optional {
+		op = "?."
+	}
+	return "(" + me.Left.String() + op + me.Member.String() + ")"
+}
+
+// TernaryExpression i.e cond ? a : b
+type TernaryExpression struct {
+	Token       token.T
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (te *TernaryExpression) expression()     {}
+func (te *TernaryExpression) Literal() string { return te.Token.Literal }
+func (te *TernaryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(te.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(te.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(te.Alternative.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// RangeExpression i.e 0..10, 0..=10 step 2, ..5 or 1..
+type RangeExpression struct {
+	Token token.T
+	// Start is nil if the range is open at the start
+	Start Expression
+	// End is nil if the range is open at the end
+	End       Expression
+	Inclusive bool
+	// Step is nil if not given
+	Step Expression
+}
+
+func (re *RangeExpression) expression()     {}
+func (re *RangeExpression) Literal() string { return re.Token.Literal }
+func (re *RangeExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	if re.Start != nil {
+		out.WriteString(re.Start.String())
+	}
+	out.WriteString(re.Literal())
+	if re.End != nil {
+		out.WriteString(re.End.String())
+	}
+	if re.Step != nil {
+		out.WriteString(" step " + re.Step.String())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
 // PrefixExpression i.e !true
 type PrefixExpression struct {
 	Token    token.T
@@ -50,6 +217,31 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// Spread i.e ...args in a call, array literal or parameter list
+type Spread struct {
+	Token token.T
+	Value Expression
+}
+
+func (se *Spread) expression()     {}
+func (se *Spread) Literal() string { return se.Token.Literal }
+func (se *Spread) String() string {
+	return "..." + se.Value.String()
+}
+
+// PropagateExpression i.e parse(x)? unwraps an ok result
+// or returns an err result from the enclosing function
+type PropagateExpression struct {
+	Token token.T
+	Value Expression
+}
+
+func (pe *PropagateExpression) expression()     {}
+func (pe *PropagateExpression) Literal() string { return pe.Token.Literal }
+func (pe *PropagateExpression) String() string {
+	return "(" + pe.Value.String() + "?)"
+}
+
 // InfixExpression i.e 5 + 10
 type InfixExpression struct {
 	Token    token.T
@@ -121,11 +313,51 @@ func (fe *ForExpression) String() string {
 	return out.String()
 }
 
+// NamedArgument i.e port: 5432 in connect(host, port: 5432)
+type NamedArgument struct {
+	Token token.T
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) expression()     {}
+func (na *NamedArgument) Literal() string { return na.Token.Literal }
+func (na *NamedArgument) String() string {
+	return na.Name.String() + ": " + na.Value.String()
+}
+
+// SpawnExpression i.e spawn f(x)
+type SpawnExpression struct {
+	Token token.T
+	Call  *CallExpression
+}
+
+func (se *SpawnExpression) expression()     {}
+func (se *SpawnExpression) Literal() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	return "(" + se.Literal() + " " + se.Call.String() + ")"
+}
+
+// AwaitExpression i.e await f(x)
+type AwaitExpression struct {
+	Token token.T
+	Value Expression
+}
+
+func (ae *AwaitExpression) expression()     {}
+func (ae *AwaitExpression) Literal() string { return ae.Token.Literal }
+func (ae *AwaitExpression) String() string {
+	return "(" + ae.Literal() + " " + ae.Value.String() + ")"
+}
+
 // CallExpression i.e (foo, bar)
 type CallExpression struct {
 	Token     token.T
 	Function  Expression
 	Arguments []Expression
+	// Tail is set if the enclosing function returns
+	// the result of the call as is i.e return f(x);
+	Tail bool
 }
 
 func (ce *CallExpression) expression()     {}
@@ -136,10 +368,9 @@ func (ce *CallExpression) String() string {
 	for _, a := range ce.Arguments {
 		args = append(args, a.String())
 	}
-	switch f := ce.Function.(type) {
-	case *Function:
+	if f, ok := ce.Function.(*Function); ok && f.Name != nil {
 		out.WriteString(f.Name.Value)
-	default:
+	} else {
 		out.WriteString(ce.Function.String())
 	}
 	out.WriteString("(")
@@ -147,9 +147,9 @@ func TestExpressions(t *testing.T) {
 			},
 			&ExpressionStatement{
 				Expression: &Dict{
-					Pairs: map[Expression]Expression{
-						&String{Value: "foo"}: &String{Value: "bar"},
-						&String{Value: "baz"}: &String{Value: "qux"},
+					Pairs: []Pair{
+						{Key: &String{Value: "foo"}, Value: &String{Value: "bar"}},
+						{Key: &String{Value: "baz"}, Value: &String{Value: "qux"}},
 					},
 				},
 			},
@@ -12,6 +12,35 @@ type Statement interface {
 	statement()
 }
 
+// StatementToken returns the first token of stmt
+func StatementToken(stmt Statement) token.T {
+	switch stmt := stmt.(type) {
+	case *ExpressionStatement:
+		return stmt.Token
+	case *AssignStatement:
+		return stmt.Token
+	case *BlockStatement:
+		return stmt.Token
+	case *ReturnStatement:
+		return stmt.Token
+	case *YieldStatement:
+		return stmt.Token
+	case *ThrowStatement:
+		return stmt.Token
+	case *TryStatement:
+		return stmt.Token
+	case *StructStatement:
+		return stmt.Token
+	case *ImportStatement:
+		return stmt.Token
+	case *ExportStatement:
+		return stmt.Token
+	case *SelectStatement:
+		return stmt.Token
+	}
+	return token.T{}
+}
+
 // AssignStatement i.e let foo = 5, const foo = 5, foo = 5;
 type AssignStatement struct {
 	Token token.T
@@ -35,6 +64,70 @@ func (as *AssignStatement) String() string {
 	return out.String()
 }
 
+// StructStatement i.e struct Point { x, y }
+type StructStatement struct {
+	Token  token.T
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statement()      {}
+func (ss *StructStatement) Literal() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ss.Literal() + " " + ss.Name.String() + " {")
+	for i, field := range ss.Fields {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString(" " + field.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+// ImportStatement i.e import "lib/math" as math;
+type ImportStatement struct {
+	Token token.T
+	Path  *String
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statement()      {}
+func (is *ImportStatement) Literal() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return is.Literal() + " " + is.Path.String() + " as " + is.Alias.String() + ";"
+}
+
+// ExportStatement i.e export const pi = 3.14;
+type ExportStatement struct {
+	Token token.T
+	// Statement is the exported declaration,
+	// an assignment, a named function or a struct
+	Statement Statement
+}
+
+func (es *ExportStatement) statement()      {}
+func (es *ExportStatement) Literal() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.Literal() + " " + es.Statement.String()
+}
+
+// Names returns the names declared by the exported statement
+func (es *ExportStatement) Names() []string {
+	switch stmt := es.Statement.(type) {
+	case *AssignStatement:
+		return []string{stmt.Left.Value}
+	case *StructStatement:
+		return []string{stmt.Name.Value}
+	case *ExpressionStatement:
+		if fn, ok := stmt.Expression.(*Function); ok && fn.Name != nil {
+			return []string{fn.Name.Value}
+		}
+	}
+	return nil
+}
+
 // BlockStatement i.e { ...stuff }
 type BlockStatement struct {
 	Token      token.T
@@ -65,9 +158,9 @@ func (rs *ReturnStatement) Literal() string {
 }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
-	out.WriteString(rs.Literal() + " ")
+	out.WriteString(rs.Literal())
 	if rs.ReturnValue != nil {
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(" " + rs.ReturnValue.String())
 	}
 	out.WriteString(";")
 	return out.String()
@@ -88,3 +181,107 @@ func (es *ExpressionStatement) String() string {
 	}
 	return ""
 }
+
+// YieldStatement i.e yield x;
+type YieldStatement struct {
+	Token token.T
+	Value Expression
+}
+
+func (ys *YieldStatement) statement()      {}
+func (ys *YieldStatement) Literal() string { return ys.Token.Literal }
+func (ys *YieldStatement) String() string {
+	return ys.Literal() + " " + ys.Value.String() + ";"
+}
+
+// ThrowStatement i.e throw "failed";
+type ThrowStatement struct {
+	Token token.T
+	Value Expression
+}
+
+func (ts *ThrowStatement) statement()      {}
+func (ts *ThrowStatement) Literal() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.Literal() + " " + ts.Value.String() + ";"
+}
+
+// CatchClause i.e catch e { ... }
+type CatchClause struct {
+	Token token.T
+	// Param is bound to the caught error, nil if omitted
+	Param *Identifier
+	Body  *BlockStatement
+}
+
+// TryStatement i.e try { ... } catch e { ... } finally { ... }
+type TryStatement struct {
+	Token   token.T
+	Body    *BlockStatement
+	Catch   *CatchClause
+	Finally *BlockStatement
+}
+
+func (ts *TryStatement) statement()      {}
+func (ts *TryStatement) Literal() string { return ts.Token.Literal }
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(ts.Body.String())
+	if ts.Catch != nil {
+		out.WriteString(" catch ")
+		if ts.Catch.Param != nil {
+			out.WriteString(ts.Catch.Param.String() + " ")
+		}
+		out.WriteString(ts.Catch.Body.String())
+	}
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(ts.Finally.String())
+	}
+	return out.String()
+}
+
+// SelectCase i.e let v = ch.recv() { ... } or ch.send(x) { ... }
+type SelectCase struct {
+	Token token.T
+	// Binding declares the received value, nil if it is not bound
+	Binding *Identifier
+	// Call is the operation of the case i.e ch.recv() or ch.send(x)
+	Call *CallExpression
+	Body *BlockStatement
+}
+
+// Channel returns the channel expression of
+// the case and its operation, send or recv
+func (sc *SelectCase) Channel() (Expression, string) {
+	member := sc.Call.Function.(*MemberExpression)
+	return member.Left, member.Member.Value
+}
+
+// SelectStatement waits on the first ready case
+// i.e select { let v = a.recv() { ... } b.send(x) { ... } else { ... } }
+type SelectStatement struct {
+	Token token.T
+	Cases []*SelectCase
+	// Default is evaluated if no case is ready, nil if omitted
+	Default *BlockStatement
+}
+
+func (ss *SelectStatement) statement()      {}
+func (ss *SelectStatement) Literal() string { return ss.Token.Literal }
+func (ss *SelectStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("select { ")
+	for _, c := range ss.Cases {
+		if c.Binding != nil {
+			out.WriteString(c.Token.Literal + " " + c.Binding.String() + " = ")
+		}
+		out.WriteString(c.Call.String() + " " + c.Body.String() + " ")
+	}
+	if ss.Default != nil {
+		out.WriteString("else " + ss.Default.String() + " ")
+	}
+	out.WriteString("}")
+	return out.String()
+}
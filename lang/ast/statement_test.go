@@ -11,7 +11,9 @@ func TestStatements(t *testing.T) {
 		"{ const foo = bar; }" +
 		"return foo;" +
 		"foo" +
-		"foobar = true;"
+		"foobar = true;" +
+		"struct Point { x, y }" +
+		"fn (p Point) len() { p }"
 	program := &Program{
 		Statements: []Statement{
 			&AssignStatement{
@@ -77,6 +79,29 @@ func TestStatements(t *testing.T) {
 					Value: true,
 				},
 			},
+			&StructStatement{
+				Token: token.T{Type: token.STRUCT, Literal: "struct"},
+				Name:  &Identifier{Value: "Point"},
+				Fields: []*Identifier{
+					{Value: "x"},
+					{Value: "y"},
+				},
+			},
+			&ExpressionStatement{
+				Expression: &Function{
+					Token: token.T{Type: token.FN, Literal: "fn"},
+					Receiver: &Receiver{
+						Name: &Identifier{Value: "p"},
+						Type: &Identifier{Value: "Point"},
+					},
+					Name: &Identifier{Value: "len"},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{Expression: &Identifier{Value: "p"}},
+						},
+					},
+				},
+			},
 		},
 	}
 
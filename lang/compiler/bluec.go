@@ -0,0 +1,442 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// A .bluec file holds a compiled program:
+//
+//	magic     "BLUC"
+//	version   uint16, big endian
+//	constants count, then a tag and a payload for every constant
+//	globals   count, then every name
+//	main      the prototype of the top level
+//	checksum  CRC-32 (IEEE) of everything before it, big endian
+//
+// Counts and integers are unsigned varints, strings are prefixed by their
+// length. Numbers are stored as IEEE 754 bits and builtins by name, they
+// are bound to object.Builtins when the file is read.
+//
+// Unmarshal verifies every function before returning it: operands must
+// refer to what exists, jumps must land on instructions and the stack
+// must hold what every instruction pops, with the same depth on every
+// path into an instruction.
+const (
+	Magic   = "BLUC"
+	Version = 3
+)
+
+// Errors returned by Unmarshal, wrapped with a description
+var (
+	ErrFormat   = errors.New("not a bluec file")
+	ErrVersion  = errors.New("unsupported bluec version")
+	ErrChecksum = errors.New("bluec checksum mismatch")
+	ErrCorrupt  = errors.New("corrupt bluec file")
+)
+
+const (
+	tagNumber byte = iota + 1
+	tagString
+	tagBuiltin
+	tagFunction
+)
+
+// Marshal encodes bc in the bluec format
+func Marshal(bc *Bytecode) ([]byte, error) {
+	e := &encoder{buf: append([]byte(Magic), 0, 0)}
+	binary.BigEndian.PutUint16(e.buf[len(Magic):], Version)
+	e.uvarint(len(bc.Constants))
+	for i, c := range bc.Constants {
+		switch c := c.(type) {
+		case *object.Number:
+			e.byte(tagNumber)
+			e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(c.Value))
+		case *object.String:
+			e.byte(tagString)
+			e.string(c.Value)
+		case *object.Builtin:
+			e.byte(tagBuiltin)
+			e.string(c.Name)
+		case *Function:
+			e.byte(tagFunction)
+			e.function(c)
+		default:
+			return nil, fmt.Errorf("cannot marshal constant %d of type %s", i, c.Type())
+		}
+	}
+	e.uvarint(len(bc.Globals))
+	for _, name := range bc.Globals {
+		e.string(name)
+	}
+	e.function(bc.Main)
+	return binary.BigEndian.AppendUint32(e.buf, crc32.ChecksumIEEE(e.buf)), nil
+}
+
+// Unmarshal decodes a program encoded by Marshal. It fails if data
+// was written by another version, does not match its checksum or
+// holds instructions which do not refer to valid operands.
+func Unmarshal(data []byte) (*Bytecode, error) {
+	header := len(Magic) + 2
+	if len(data) < header+4 || string(data[:len(Magic)]) != Magic {
+		return nil, ErrFormat
+	}
+	if v := binary.BigEndian.Uint16(data[len(Magic):]); v != Version {
+		return nil, fmt.Errorf("%w: got %d, want %d", ErrVersion, v, Version)
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, ErrChecksum
+	}
+	d := &decoder{data: body, off: header}
+	bc := &Bytecode{}
+	bc.Constants = make([]object.Object, d.count())
+	for i := range bc.Constants {
+		switch tag := d.byte(); tag {
+		case tagNumber:
+			bc.Constants[i] = &object.Number{Value: math.Float64frombits(d.uint64())}
+		case tagString:
+			bc.Constants[i] = &object.String{Value: d.string()}
+		case tagBuiltin:
+			name := d.string()
+			builtin, ok := object.Builtins[name]
+			if !ok && d.err == nil {
+				d.fail("unknown builtin %q", name)
+			}
+			bc.Constants[i] = builtin
+		case tagFunction:
+			bc.Constants[i] = d.function()
+		default:
+			d.fail("unknown constant tag %d", tag)
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+	bc.Globals = make([]string, d.count())
+	for i := range bc.Globals {
+		bc.Globals[i] = d.string()
+	}
+	bc.Main = d.function()
+	if d.err == nil && d.off != len(d.data) {
+		d.fail("%d trailing bytes", len(d.data)-d.off)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := bc.verify(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	return bc, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) byte(b byte) { e.buf = append(e.buf, b) }
+
+func (e *encoder) uvarint(i int) { e.buf = binary.AppendUvarint(e.buf, uint64(i)) }
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.byte(1)
+	} else {
+		e.byte(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) function(fn *Function) {
+	e.string(fn.Name)
+	e.uvarint(len(fn.Instructions))
+	e.buf = append(e.buf, fn.Instructions...)
+	e.uvarint(fn.NumLocals)
+	e.uvarint(len(fn.Locals))
+	for _, name := range fn.Locals {
+		e.string(name)
+	}
+	e.uvarint(len(fn.Params))
+	for _, p := range fn.Params {
+		e.string(p.Name)
+		e.bool(p.Default)
+	}
+	e.bool(fn.Rest)
+	e.bool(fn.Method)
+	e.uvarint(fn.Caches)
+	e.uvarint(len(fn.Upvalues))
+	for _, uv := range fn.Upvalues {
+		e.bool(uv.Local)
+		e.uvarint(uv.Index)
+		e.string(uv.Name)
+	}
+	e.uvarint(len(fn.Lines))
+	for _, l := range fn.Lines {
+		e.uvarint(l.Offset)
+		e.uvarint(int(l.Token.Type))
+		e.string(l.Token.Literal)
+		e.uvarint(l.Token.Line)
+		e.uvarint(l.Token.Col)
+		e.uvarint(int(l.Token.Scope))
+	}
+}
+
+// decoder reads the body of a bluec file, the
+// first error stops decoding and is kept in err
+type decoder struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (d *decoder) fail(msg string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s at offset %d", ErrCorrupt, fmt.Sprintf(msg, args...), d.off)
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || d.off >= len(d.data) {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	d.off++
+	return d.data[d.off-1]
+}
+
+func (d *decoder) bool() bool {
+	switch b := d.byte(); b {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		d.fail("invalid boolean %d", b)
+		return false
+	}
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// uvarint reads an integer of at most math.MaxInt32
+func (d *decoder) uvarint() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.off:])
+	if n <= 0 || v > math.MaxInt32 {
+		d.fail("invalid integer")
+		return 0
+	}
+	d.off += n
+	return int(v)
+}
+
+// count reads the number of elements that follow, each taking
+// at least one byte, so a count never exceeds the bytes left
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > len(d.data)-d.off {
+		d.fail("count %d exceeds the remaining data", n)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.off {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	d.off += n
+	return d.data[d.off-n : d.off]
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.count()))
+}
+
+func (d *decoder) function() *Function {
+	fn := &Function{Name: d.string()}
+	fn.Instructions = append(Instructions(nil), d.bytes(d.count())...)
+	fn.NumLocals = d.uvarint()
+	fn.Locals = make([]string, d.count())
+	for i := range fn.Locals {
+		fn.Locals[i] = d.string()
+	}
+	fn.Params = make([]Param, d.count())
+	for i := range fn.Params {
+		fn.Params[i] = Param{Name: d.string(), Default: d.bool()}
+	}
+	fn.Rest = d.bool()
+	fn.Method = d.bool()
+	fn.Caches = d.uvarint()
+	fn.Upvalues = make([]Upvalue, d.count())
+	for i := range fn.Upvalues {
+		fn.Upvalues[i] = Upvalue{Local: d.bool(), Index: d.uvarint(), Name: d.string()}
+	}
+	fn.Lines = make(LineTable, d.count())
+	for i := range fn.Lines {
+		fn.Lines[i] = Line{Offset: d.uvarint(), Token: token.T{
+			Type:    token.Type(d.uvarint()),
+			Literal: d.string(),
+			Line:    d.uvarint(),
+			Col:     d.uvarint(),
+			Scope:   token.Scope(d.uvarint()),
+		}}
+	}
+	return fn
+}
+
+// verify checks that every instruction of bc is defined, complete
+// and only refers to constants, globals, slots, upvalues and
+// offsets that exist, and that the stack of every function is
+// balanced on every path through it
+func (bc *Bytecode) verify() error {
+	if len(bc.Main.Upvalues) > 0 {
+		return errors.New("main captures variables")
+	}
+	fns := []*Function{bc.Main}
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*Function); ok {
+			fns = append(fns, fn)
+		}
+	}
+	for _, fn := range fns {
+		if err := bc.verifyFunction(fn); err != nil {
+			return fmt.Errorf("fn %q: %s", fn.Name, err)
+		}
+	}
+	return nil
+}
+
+func (bc *Bytecode) verifyFunction(fn *Function) error {
+	slots := len(fn.Params)
+	if fn.Rest {
+		slots++
+	}
+	switch {
+	case fn.NumLocals != len(fn.Locals):
+		return fmt.Errorf("%d locals named, want %d", len(fn.Locals), fn.NumLocals)
+	case fn.NumLocals < slots || fn.NumLocals > math.MaxUint8+1:
+		return fmt.Errorf("invalid number of locals %d", fn.NumLocals)
+	case fn.Method && len(fn.Params) == 0:
+		return errors.New("method has no receiver")
+	case fn.Caches > math.MaxUint16+1:
+		return fmt.Errorf("invalid number of caches %d", fn.Caches)
+	}
+	ins := fn.Instructions
+	for i := 0; i < len(ins); {
+		op := Opcode(ins[i])
+		def, err := Lookup(op)
+		if err != nil {
+			return fmt.Errorf("%s at offset %d", err, i)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fmt.Errorf("truncated %s at offset %d", def.Name, i)
+		}
+		operands, _ := ReadOperands(def, ins[i+1:])
+		if err := bc.verifyOperands(fn, op, operands); err != nil {
+			return fmt.Errorf("%s at offset %d: %s", def.Name, i, err)
+		}
+		i += 1 + width
+		if (op == OpTailCall || op == OpTailInvoke) && (i == len(ins) || Opcode(ins[i]) != OpReturn) {
+			return fmt.Errorf("%s at offset %d is not followed by OpReturn", def.Name, i-1-width)
+		}
+	}
+	for i, l := range fn.Lines {
+		if l.Offset >= len(ins) || (i > 0 && l.Offset <= fn.Lines[i-1].Offset) {
+			return fmt.Errorf("line %d has invalid offset %d", i, l.Offset)
+		}
+	}
+	if len(ins) == 0 || Opcode(ins[len(ins)-1]) != OpReturn {
+		return errors.New("does not end with OpReturn")
+	}
+	n, err := maxStack(ins)
+	if err != nil {
+		return err
+	}
+	fn.MaxStack = n
+	return nil
+}
+
+func (bc *Bytecode) verifyOperands(fn *Function, op Opcode, operands []int) error {
+	var index, limit int
+	switch op {
+	case OpConstant:
+		index, limit = operands[0], len(bc.Constants)
+	case OpClosure:
+		if operands[0] >= len(bc.Constants) {
+			return fmt.Errorf("constant %d out of range", operands[0])
+		}
+		proto, ok := bc.Constants[operands[0]].(*Function)
+		if !ok {
+			return fmt.Errorf("constant %d is not a function", operands[0])
+		}
+		for i, uv := range proto.Upvalues {
+			if uv.Local && uv.Index >= fn.NumLocals || !uv.Local && uv.Index >= len(fn.Upvalues) {
+				return fmt.Errorf("upvalue %d of constant %d captures nothing", i, operands[0])
+			}
+		}
+		return nil
+	case OpStruct, OpMethod, OpGetMember, OpInvoke, OpTailInvoke:
+		if operands[0] >= len(bc.Constants) {
+			return fmt.Errorf("constant %d out of range", operands[0])
+		}
+		if _, ok := bc.Constants[operands[0]].(*object.String); !ok {
+			return fmt.Errorf("constant %d is not a name", operands[0])
+		}
+		switch op {
+		case OpGetMember:
+			index, limit = operands[1], fn.Caches
+		case OpInvoke, OpTailInvoke:
+			index, limit = operands[2], fn.Caches
+		default:
+			return nil
+		}
+	case OpGetGlobal, OpSetGlobal:
+		index, limit = operands[0], len(bc.Globals)
+	case OpGetLocal, OpSetLocal:
+		index, limit = operands[0], fn.NumLocals
+	case OpCloseUpvalues:
+		index, limit = operands[0], fn.NumLocals+1
+	case OpGetUpvalue, OpSetUpvalue:
+		index, limit = operands[0], len(fn.Upvalues)
+	case OpJump, OpJumpFalse, OpJumpNotNull, OpIterNext:
+		index, limit = operands[0], len(fn.Instructions)
+	case OpJumpSet:
+		if operands[0] >= len(fn.Params) {
+			return fmt.Errorf("parameter %d out of range", operands[0])
+		}
+		index, limit = operands[1], len(fn.Instructions)
+	default:
+		return nil
+	}
+	if index >= limit {
+		return fmt.Errorf("operand %d out of range", index)
+	}
+	return nil
+}
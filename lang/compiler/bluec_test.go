@@ -0,0 +1,181 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+
+	"github.com/lindeneg/blue/lang/object"
+)
+
+const bluecProgram = `let greeting = "hello";
+fn greet(who = "blue", ...rest) {
+	let n = len(rest);
+	return fn() { n = n + 1.5; return [greeting, who, n]; };
+}
+for const i = 0..=4 step 2 { greet(i); }
+greet()() ?? null;`
+
+const structProgram = `struct Point { x, y }
+fn (p Point) add(o) { return Point(p.x + o.x, p.y + o.y); }
+fn (p Point) len() { return p.add(p).x; }
+Point(1, 2).len;`
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, input := range []string{bluecProgram, structProgram} {
+		testMarshalRoundTrip(t, input)
+	}
+}
+
+func testMarshalRoundTrip(t *testing.T, input string) {
+	bc := compileProgram(t, input)
+	data, err := Marshal(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(Magic)) {
+		t.Fatalf("missing magic header, got=%q", data[:4])
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got bytes.Buffer
+	bc.Disassemble(&want)
+	decoded.Disassemble(&got)
+	if got.String() != want.String() {
+		t.Fatalf("disassembly differs\nwant=\n%s\ngot=\n%s", want.String(), got.String())
+	}
+	for i, c := range bc.Constants {
+		if decoded.Constants[i].Type() != c.Type() || decoded.Constants[i].String() != c.String() {
+			t.Errorf("constant %d differs, want=%s, got=%s", i, c, decoded.Constants[i])
+		}
+	}
+	for _, c := range decoded.Constants {
+		if b, ok := c.(*object.Builtin); ok && b != object.Builtins["len"] {
+			t.Errorf("builtin is not bound to object.Builtins, got=%v", b)
+		}
+	}
+	for i, l := range bc.Main.Lines {
+		if decoded.Main.Lines[i] != l {
+			t.Errorf("line %d differs, want=%+v, got=%+v", i, l, decoded.Main.Lines[i])
+		}
+	}
+	again, err := Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Error("encoding of the decoded program differs")
+	}
+}
+
+func TestUnmarshalRejects(t *testing.T) {
+	data, err := Marshal(compileProgram(t, bluecProgram))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), data...))
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"empty", nil, ErrFormat},
+		{"magic", modify(func(b []byte) []byte { b[0] = 'X'; return b }), ErrFormat},
+		{"version", modify(func(b []byte) []byte { b[5] = Version + 1; return withChecksum(b) }), ErrVersion},
+		{"flipped", modify(func(b []byte) []byte { b[20] ^= 0xff; return b }), ErrChecksum},
+		{"truncated", modify(func(b []byte) []byte { return withChecksum(b[:len(b)/2]) }), ErrCorrupt},
+		{"trailing", modify(func(b []byte) []byte { return withChecksum(append(b[:len(b)-4], 0)) }), ErrCorrupt},
+		{"tag", modify(func(b []byte) []byte { b[7] = 99; return withChecksum(b) }), ErrCorrupt},
+	}
+	for _, tt := range tests {
+		_, err := Unmarshal(tt.data)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: wrong error, want=%v, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestUnmarshalVerifiesInstructions(t *testing.T) {
+	tests := []struct {
+		main     *Function
+		expected string
+	}{
+		{&Function{Instructions: concat(Make(OpConstant, 3), Make(OpReturn))}, "operand 3 out of range"},
+		{&Function{Instructions: concat(Make(OpGetLocal, 0), Make(OpReturn))}, "operand 0 out of range"},
+		{&Function{Instructions: concat(Make(OpJump, 40), Make(OpReturn))}, "operand 40 out of range"},
+		{&Function{Instructions: concat(Make(OpClosure, 0), Make(OpReturn))}, "constant 0 is not a function"},
+		{&Function{Instructions: Instructions{byte(OpConstant), 0}}, "truncated OpConstant"},
+		{&Function{Instructions: Instructions{200}}, "opcode 200 undefined"},
+		{&Function{Instructions: concat(Make(OpNull))}, "does not end with OpReturn"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpTailCall, 0), Make(OpPop), Make(OpReturn))}, "not followed by OpReturn"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpGetMember, 0, 0), Make(OpReturn))}, "constant 0 is not a name"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpGetMember, 1, 0), Make(OpReturn))}, "operand 0 out of range"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpInvoke, 1, 0, 2), Make(OpReturn)), Caches: 2}, "operand 2 out of range"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpTailInvoke, 1, 0, 0), Make(OpPop), Make(OpReturn)), Caches: 1}, "not followed by OpReturn"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpReturn)), Method: true}, "method has no receiver"},
+		{&Function{Instructions: concat(Make(OpPop), Make(OpPop), Make(OpReturn))}, "OpPop at offset 0 underflows the stack, needs 1 and has 0"},
+		{&Function{Instructions: concat(Make(OpReturn))}, "OpReturn at offset 0 underflows the stack, needs 1 and has 0"},
+		{&Function{Instructions: concat(Make(OpIterNext, 3), Make(OpReturn))}, "OpIterNext at offset 0 underflows the stack, needs 1 and has 0"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpTrue), Make(OpJumpFalse, 6), Make(OpPop), Make(OpReturn))}, "offset 6 is reached with 1 and 0 values"},
+		{&Function{Instructions: concat(Make(OpJump, 1), Make(OpNull), Make(OpReturn))}, "offset 0 jumps into the middle of an instruction at offset 1"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpCall, 3), Make(OpReturn))}, "OpCall at offset 1 underflows the stack, needs 4 and has 1"},
+		{&Function{Instructions: concat(Make(OpNull), Make(OpReturn)), Upvalues: []Upvalue{{Index: 0}}}, "main captures variables"},
+	}
+	for _, tt := range tests {
+		bc := &Bytecode{Main: tt.main, Constants: []object.Object{&object.Number{Value: 1}, &object.String{Value: "x"}}}
+		data, err := Marshal(bc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Unmarshal(data)
+		if !errors.Is(err, ErrCorrupt) || !bytes.Contains([]byte(err.Error()), []byte(tt.expected)) {
+			t.Errorf("wrong error, want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestMarshalRejectsRuntimeConstants(t *testing.T) {
+	bc := &Bytecode{Main: &Function{}, Constants: []object.Object{&object.Array{}}}
+	if _, err := Marshal(bc); err == nil {
+		t.Fatal("expected an error for an array constant")
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	for _, input := range []string{bluecProgram, structProgram, "1 + 2;", "fn f(a) { return a; } f(1);", ""} {
+		data, err := Marshal(compileProgram(f, input))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Unmarshal(data)
+		// fix the checksum so the decoder sees the data
+		if len(data) < 4 {
+			return
+		}
+		bc, err := Unmarshal(withChecksum(data[:len(data)-4]))
+		if err != nil {
+			return
+		}
+		encoded, err := Marshal(bc)
+		if err != nil {
+			t.Fatalf("cannot encode decoded program: %s", err)
+		}
+		if _, err := Unmarshal(encoded); err != nil {
+			t.Fatalf("cannot decode encoded program: %s", err)
+		}
+	})
+}
+
+// withChecksum appends the checksum of b
+func withChecksum(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(b[:len(b):len(b)], crc32.ChecksumIEEE(b))
+}
@@ -0,0 +1,725 @@
+package compiler
+
+import (
+	"math"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/resolve"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// C lowers a resolved program into bytecode. The storage of every
+// identifier is taken from the symbol table of the resolver: globals
+// live in global slots, locals and parameters in the slots of the
+// function declaring them and are captured as upvalues by closures.
+//
+// Function bodies are compiled when their enclosing block closes, like
+// the resolver resolves them, as a closure may capture names declared
+// after it.
+type C struct {
+	l *lexer.L
+
+	sourceName string
+
+	table     *resolve.Table
+	constants []object.Object
+	// constant indexes of numbers, strings and builtins
+	constIndex map[constKey]int
+	globals    map[*resolve.Symbol]int
+	names      []string
+	locals     map[*resolve.Symbol]*local
+	fn         *funcState
+
+	errs []CompileErr
+}
+
+type constKey struct {
+	typ   object.Type
+	value string
+}
+
+// local is the slot of a local or parameter
+type local struct {
+	fn   *funcState
+	slot int
+	name string
+	// captured is set once a closure captures the slot
+	captured bool
+}
+
+// funcState is the function being compiled
+type funcState struct {
+	proto    *Function
+	outer    *funcState
+	block    *block
+	upvalues map[*local]int
+}
+
+// block mirrors a scope of the resolver
+type block struct {
+	outer  *block
+	locals []*local
+	// deferred function bodies
+	deferred []func()
+}
+
+// New creates a new compiler, l is used
+// to highlight the offending source lines
+func New(l *lexer.L, sourceName string) *C {
+	return &C{
+		l:          l,
+		sourceName: sourceName,
+		errs:       make([]CompileErr, 0),
+	}
+}
+
+// Errors returns the errors that occured during compilation
+func (c *C) Errors() []CompileErr {
+	return c.errs
+}
+
+// HasErrors returns true if there are any errors
+func (c *C) HasErrors() bool {
+	return len(c.errs) > 0
+}
+
+// Compile lowers program, resolved into table, into bytecode.
+// The top level of the program returns the value of its last
+// statement, like the evaluator.
+func (c *C) Compile(program *ast.Program, table *resolve.Table) *Bytecode {
+	c.table = table
+	c.constants = nil
+	c.constIndex = make(map[constKey]int)
+	c.globals = make(map[*resolve.Symbol]int)
+	c.names = nil
+	c.locals = make(map[*resolve.Symbol]*local)
+	main := &Function{Name: "main"}
+	c.fn = &funcState{proto: main, upvalues: make(map[*local]int)}
+	c.openBlock()
+	t := c.compileStatements(program.Statements)
+	c.closeBlock(t, false)
+	c.emit(t, OpReturn)
+	c.finish(t)
+	c.fn = nil
+	return &Bytecode{Main: main, Constants: c.constants, Globals: c.names}
+}
+
+// compile lowers a statement or an expression. A statement leaves
+// the stack as it was, an expression pushes exactly one value.
+func (c *C) compile(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if node.Expression != nil {
+			c.compile(node.Expression)
+			c.emit(node.Token, OpPop)
+		}
+	case *ast.AssignStatement:
+		c.compile(node.Right)
+		if node.Token.Type == token.LET || node.Token.Type == token.CONST {
+			c.declare(node.Left)
+		}
+		c.store(node.Left)
+	case *ast.BlockStatement:
+		c.compileBlock(node)
+		c.emit(node.Token, OpPop)
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(node.Token, OpNull)
+		} else {
+			c.compile(node.ReturnValue)
+		}
+		c.emit(node.Token, OpReturn)
+	case *ast.StructStatement:
+		c.compileStructStatement(node)
+	case *ast.Identifier:
+		c.load(node)
+	case *ast.Number:
+		c.emit(node.Token, OpConstant, c.constant(node.Token, &object.Number{Value: node.Value}))
+	case *ast.String:
+		c.emit(node.Token, OpConstant, c.constant(node.Token, &object.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(node.Token, OpTrue)
+		} else {
+			c.emit(node.Token, OpFalse)
+		}
+	case *ast.Null:
+		c.emit(node.Token, OpNull)
+	case *ast.Array:
+		c.compileArguments(node.Elements)
+		if c.fits(node.Token, len(node.Elements), math.MaxUint16, "array elements") {
+			c.emit(node.Token, OpArray, len(node.Elements))
+		}
+	case *ast.Dict:
+		for _, pair := range node.Pairs {
+			c.compile(pair.Key)
+			c.compile(pair.Value)
+		}
+		if c.fits(node.Token, len(node.Pairs), math.MaxUint16, "dict pairs") {
+			c.emit(node.Token, OpDict, len(node.Pairs))
+		}
+	case *ast.PrefixExpression:
+		c.compilePrefixExpression(node)
+	case *ast.InfixExpression:
+		c.compileInfixExpression(node)
+	case *ast.TernaryExpression:
+		c.compile(node.Condition)
+		alt := c.emit(node.Token, OpJumpFalse, 0)
+		c.compile(node.Consequence)
+		end := c.emit(node.Token, OpJump, 0)
+		c.patch(node.Token, alt)
+		c.compile(node.Alternative)
+		c.patch(node.Token, end)
+	case *ast.IndexExpression:
+		if node.Optional {
+			cerr(c, node.Token, "compiler does not support optional index expressions")
+			return
+		}
+		c.compile(node.Left)
+		c.compile(node.Index)
+		c.emit(node.Token, OpIndex)
+	case *ast.MemberExpression:
+		if node.Optional {
+			cerr(c, node.Token, "compiler does not support optional member expressions")
+			return
+		}
+		c.compile(node.Left)
+		c.emit(node.Member.Token, OpGetMember, c.name(node.Member), c.cache(node.Member.Token))
+	case *ast.RangeExpression:
+		c.compileRangeExpression(node)
+	case *ast.IfExpression:
+		c.compileIfExpression(node)
+	case *ast.ForExpression:
+		c.compileForExpression(node)
+	case *ast.Function:
+		c.compileFunction(node)
+	case *ast.CallExpression:
+		if member, ok := node.Function.(*ast.MemberExpression); ok && !member.Optional {
+			c.compileInvoke(node, member)
+			return
+		}
+		c.compile(node.Function)
+		c.compileArguments(node.Arguments)
+		if !c.fits(node.Token, len(node.Arguments), math.MaxUint8, "arguments") {
+			return
+		}
+		if node.Tail {
+			// the OpReturn following a tail call is only
+			// executed if the callee is not a closure
+			c.emit(node.Token, OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(node.Token, OpCall, len(node.Arguments))
+		}
+	default:
+		c.unsupported(node)
+	}
+}
+
+// compileStatements compiles statements and pushes the value of the
+// last one, which is null unless it is an expression or a block. It
+// returns the token of the last statement.
+func (c *C) compileStatements(statements []ast.Statement) token.T {
+	var t token.T
+	for i, stmt := range statements {
+		t = ast.StatementToken(stmt)
+		if i < len(statements)-1 {
+			c.compile(stmt)
+			continue
+		}
+		switch stmt := stmt.(type) {
+		case *ast.ExpressionStatement:
+			if stmt.Expression != nil {
+				c.compile(stmt.Expression)
+				return t
+			}
+		case *ast.BlockStatement:
+			c.compileBlock(stmt)
+			return t
+		default:
+			c.compile(stmt)
+		}
+	}
+	c.emit(t, OpNull)
+	return t
+}
+
+// compileBlock compiles b in a new block and pushes its value
+func (c *C) compileBlock(b *ast.BlockStatement) {
+	c.openBlock()
+	c.compileStatements(b.Statements)
+	c.closeBlock(b.Token, true)
+}
+
+func (c *C) compilePrefixExpression(node *ast.PrefixExpression) {
+	c.compile(node.Right)
+	switch node.Operator {
+	case "-":
+		c.emit(node.Token, OpMinus)
+	case "!":
+		c.emit(node.Token, OpNot)
+	default:
+		cerr(c, node.Token, "unknown operator: %s", node.Operator)
+	}
+}
+
+var infixOps = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	"<=": OpLessEqual,
+	">":  OpGreater,
+	">=": OpGreaterEqual,
+}
+
+// compileInfixExpression compiles a binary operation, the right
+// operand of ?? is only evaluated if the left operand is null
+func (c *C) compileInfixExpression(node *ast.InfixExpression) {
+	c.compile(node.Left)
+	if node.Operator == "??" {
+		end := c.emit(node.Token, OpJumpNotNull, 0)
+		c.emit(node.Token, OpPop)
+		c.compile(node.Right)
+		c.patch(node.Token, end)
+		return
+	}
+	c.compile(node.Right)
+	op, ok := infixOps[node.Operator]
+	if !ok {
+		cerr(c, node.Token, "unknown operator: %s", node.Operator)
+		return
+	}
+	c.emit(node.Token, op)
+}
+
+// compileRangeExpression pushes the bounds given and
+// describes which are on the stack with the range flags
+func (c *C) compileRangeExpression(node *ast.RangeExpression) {
+	flags := 0
+	bounds := []struct {
+		expr ast.Expression
+		flag int
+	}{
+		{node.Start, RangeStart},
+		{node.End, RangeEnd},
+		{node.Step, RangeStep},
+	}
+	for _, b := range bounds {
+		if b.expr != nil {
+			c.compile(b.expr)
+			flags |= b.flag
+		}
+	}
+	if node.Inclusive {
+		flags |= RangeInclusive
+	}
+	c.emit(node.Token, OpRange, flags)
+}
+
+// compileIfExpression jumps past every branch whose condition is
+// falsy and pushes the value of the branch taken, or null
+func (c *C) compileIfExpression(node *ast.IfExpression) {
+	var ends []int
+	branches := append([]ast.Conditional{node.If}, node.Elifs...)
+	for _, branch := range branches {
+		c.compile(branch.Condition)
+		next := c.emit(node.Token, OpJumpFalse, 0)
+		c.compileBlock(branch.Body)
+		ends = append(ends, c.emit(node.Token, OpJump, 0))
+		c.patch(node.Token, next)
+	}
+	if node.Else != nil {
+		c.compileBlock(node.Else)
+	} else {
+		c.emit(node.Token, OpNull)
+	}
+	for _, end := range ends {
+		c.patch(node.Token, end)
+	}
+}
+
+// compileForExpression iterates the iterable left on the stack. The
+// loop variable is stored in its own block, which is closed at the end
+// of every iteration so closures capture the value of that iteration.
+func (c *C) compileForExpression(node *ast.ForExpression) {
+	t := node.Assignment.Token
+	c.compile(node.Assignment.Right)
+	c.emit(t, OpIter)
+	loop := len(c.fn.proto.Instructions)
+	end := c.emit(t, OpIterNext, 0)
+	c.openBlock()
+	c.declare(node.Assignment.Left)
+	c.store(node.Assignment.Left)
+	c.compileBlock(node.Body)
+	c.emit(node.Body.Token, OpPop)
+	c.closeBlock(node.Body.Token, true)
+	c.emit(node.Token, OpJump, loop)
+	c.patch(t, end)
+	c.emit(node.Token, OpNull)
+}
+
+// compileStructStatement pushes the field names and declares
+// the struct type created from them
+func (c *C) compileStructStatement(node *ast.StructStatement) {
+	for _, field := range node.Fields {
+		c.emit(field.Token, OpConstant, c.name(field))
+	}
+	if !c.fits(node.Token, len(node.Fields), math.MaxUint8, "fields") {
+		return
+	}
+	c.emit(node.Token, OpStruct, c.name(node.Name), len(node.Fields))
+	c.declare(node.Name)
+	c.store(node.Name)
+}
+
+// compileInvoke calls the member of an instance without creating
+// a bound method, the receiver is left below the arguments
+func (c *C) compileInvoke(node *ast.CallExpression, member *ast.MemberExpression) {
+	c.compile(member.Left)
+	c.compileArguments(node.Arguments)
+	if !c.fits(node.Token, len(node.Arguments), math.MaxUint8-1, "arguments") {
+		return
+	}
+	op := OpInvoke
+	if node.Tail {
+		op = OpTailInvoke
+	}
+	c.emit(node.Token, op, c.name(member.Member), len(node.Arguments), c.cache(node.Token))
+}
+
+// compileFunction pushes a closure of a prototype which is filled in
+// once the enclosing block closes. A named function is also declared,
+// a method is added to the struct of its receiver instead.
+func (c *C) compileFunction(node *ast.Function) {
+	switch {
+	case node.Generator:
+		cerr(c, node.Token, "compiler does not support generators")
+		return
+	case node.Async:
+		cerr(c, node.Token, "compiler does not support async functions")
+		return
+	}
+	proto := &Function{}
+	if node.Name != nil {
+		proto.Name = node.Name.Value
+	}
+	if node.Receiver != nil {
+		proto.Name = node.Receiver.Type.Value + "." + proto.Name
+		proto.Method = true
+		c.load(node.Receiver.Type)
+	}
+	c.emit(node.Token, OpClosure, c.addConstant(node.Token, proto))
+	if node.Receiver != nil {
+		c.emit(node.Name.Token, OpMethod, c.name(node.Name))
+	} else if node.Name != nil {
+		c.declare(node.Name)
+		c.store(node.Name)
+		c.load(node.Name)
+	}
+	outer := c.fn
+	outer.block.deferred = append(outer.block.deferred, func() {
+		c.compileBody(node, proto, outer)
+	})
+}
+
+// compileBody compiles the parameters and body of node into proto.
+// Parameters take up the first slots, the prologue assigns defaults
+// to parameters that were not given by the caller.
+func (c *C) compileBody(node *ast.Function, proto *Function, outer *funcState) {
+	enclosing := c.fn
+	c.fn = &funcState{proto: proto, outer: outer, upvalues: make(map[*local]int)}
+	c.openBlock()
+	if node.Receiver != nil {
+		c.declare(node.Receiver.Name)
+		proto.Params = append(proto.Params, Param{Name: node.Receiver.Name.Value})
+	}
+	for _, param := range node.Parameters {
+		c.declare(param.Name)
+		proto.Params = append(proto.Params, Param{Name: param.Name.Value, Default: param.Default != nil})
+	}
+	if node.Rest != nil {
+		c.declare(node.Rest)
+		proto.Rest = true
+	}
+	for _, param := range node.Parameters {
+		if param.Default == nil {
+			continue
+		}
+		l, ok := c.localOf(param.Name)
+		if !ok {
+			continue
+		}
+		given := c.emit(param.Name.Token, OpJumpSet, l.slot, 0)
+		c.compile(param.Default)
+		c.emit(param.Name.Token, OpSetLocal, l.slot)
+		c.patchOperand(param.Name.Token, given, 1)
+	}
+	for _, stmt := range node.Body.Statements {
+		c.compile(stmt)
+	}
+	c.closeBlock(node.Body.Token, false)
+	c.emit(node.Body.Token, OpNull)
+	c.emit(node.Body.Token, OpReturn)
+	c.finish(node.Body.Token)
+	c.fn = enclosing
+}
+
+// finish sets the stack space of the function being compiled. The
+// instructions of a function that failed to compile are incomplete,
+// so only the stack of a function compiled without errors is checked.
+func (c *C) finish(t token.T) {
+	proto := c.fn.proto
+	n, err := maxStack(proto.Instructions)
+	if err != nil {
+		if !c.HasErrors() {
+			cerr(c, t, "invalid stack in %q: %s", proto.Name, err)
+		}
+		return
+	}
+	proto.MaxStack = n
+}
+
+// compileArguments pushes expressions in order
+func (c *C) compileArguments(expressions []ast.Expression) {
+	for _, e := range expressions {
+		switch e := e.(type) {
+		case *ast.Spread:
+			cerr(c, e.Token, "compiler does not support spread arguments")
+		case *ast.NamedArgument:
+			cerr(c, e.Token, "compiler does not support named arguments")
+		default:
+			c.compile(e)
+		}
+	}
+}
+
+// unsupported reports a node the compiler cannot lower
+func (c *C) unsupported(node ast.Node) {
+	if node == nil {
+		return
+	}
+	var t token.T
+	switch node := node.(type) {
+	case ast.Statement:
+		t = ast.StatementToken(node)
+	case ast.Expression:
+		t = ast.ExpressionToken(node)
+	}
+	cerr(c, t, "compiler does not support %q", node.Literal())
+}
+
+// declare allocates the storage of a declared identifier
+func (c *C) declare(ident *ast.Identifier) {
+	ref, ok := c.table.Lookup(ident)
+	if !ok {
+		cerr(c, ident.Token, "unresolved identifier %q", ident.Value)
+		return
+	}
+	if ref.Kind == resolve.GLOBAL {
+		c.global(ref.Symbol)
+		return
+	}
+	proto := c.fn.proto
+	c.fits(ident.Token, proto.NumLocals+1, math.MaxUint8+1, "local variables")
+	l := &local{fn: c.fn, slot: proto.NumLocals, name: ident.Value}
+	proto.NumLocals++
+	proto.Locals = append(proto.Locals, ident.Value)
+	c.locals[ref.Symbol] = l
+	c.fn.block.locals = append(c.fn.block.locals, l)
+}
+
+// load pushes the value of ident
+func (c *C) load(ident *ast.Identifier) {
+	ref, ok := c.table.Lookup(ident)
+	if !ok {
+		cerr(c, ident.Token, "unresolved identifier %q", ident.Value)
+		return
+	}
+	switch ref.Kind {
+	case resolve.GLOBAL:
+		c.emit(ident.Token, OpGetGlobal, c.global(ref.Symbol))
+	case resolve.BUILTIN:
+		c.emit(ident.Token, OpConstant, c.builtin(ident.Token, ref.Symbol))
+	default:
+		if l, ok := c.localOf(ident); ok {
+			if l.fn == c.fn {
+				c.emit(ident.Token, OpGetLocal, l.slot)
+			} else if i, ok := c.upvalue(ident.Token, c.fn, l); ok {
+				c.emit(ident.Token, OpGetUpvalue, i)
+			}
+		}
+	}
+}
+
+// store pops the top of the stack into ident
+func (c *C) store(ident *ast.Identifier) {
+	ref, ok := c.table.Lookup(ident)
+	if !ok {
+		cerr(c, ident.Token, "unresolved identifier %q", ident.Value)
+		return
+	}
+	switch ref.Kind {
+	case resolve.GLOBAL:
+		c.emit(ident.Token, OpSetGlobal, c.global(ref.Symbol))
+	case resolve.BUILTIN:
+		cerr(c, ident.Token, "cannot assign to builtin %q", ident.Value)
+	default:
+		if l, ok := c.localOf(ident); ok {
+			if l.fn == c.fn {
+				c.emit(ident.Token, OpSetLocal, l.slot)
+			} else if i, ok := c.upvalue(ident.Token, c.fn, l); ok {
+				c.emit(ident.Token, OpSetUpvalue, i)
+			}
+		}
+	}
+}
+
+// localOf returns the slot of the local or parameter ident refers to
+func (c *C) localOf(ident *ast.Identifier) (*local, bool) {
+	ref, _ := c.table.Lookup(ident)
+	l, ok := c.locals[ref.Symbol]
+	if !ok {
+		cerr(c, ident.Token, "%q has no storage", ident.Value)
+	}
+	return l, ok
+}
+
+// upvalue returns the upvalue of fs capturing l, adding it to fs
+// and to every function between fs and the function declaring l
+func (c *C) upvalue(t token.T, fs *funcState, l *local) (int, bool) {
+	if i, ok := fs.upvalues[l]; ok {
+		return i, true
+	}
+	uv := Upvalue{Local: true, Index: l.slot, Name: l.name}
+	if fs.outer == l.fn {
+		l.captured = true
+	} else {
+		i, ok := c.upvalue(t, fs.outer, l)
+		if !ok {
+			return 0, false
+		}
+		uv = Upvalue{Index: i, Name: l.name}
+	}
+	i := len(fs.proto.Upvalues)
+	if !c.fits(t, i+1, math.MaxUint8+1, "captured variables") {
+		return 0, false
+	}
+	fs.proto.Upvalues = append(fs.proto.Upvalues, uv)
+	fs.upvalues[l] = i
+	return i, true
+}
+
+// global returns the global slot of sym, assigned on first use
+func (c *C) global(sym *resolve.Symbol) int {
+	if i, ok := c.globals[sym]; ok {
+		return i
+	}
+	i := len(c.names)
+	c.globals[sym] = i
+	c.names = append(c.names, sym.Name)
+	return i
+}
+
+// name returns the constant index of the name of ident
+func (c *C) name(ident *ast.Identifier) int {
+	return c.constant(ident.Token, &object.String{Value: ident.Value})
+}
+
+// cache allocates an inline cache of the function being compiled
+func (c *C) cache(t token.T) int {
+	proto := c.fn.proto
+	c.fits(t, proto.Caches+1, math.MaxUint16+1, "member accesses in a function")
+	proto.Caches++
+	return proto.Caches - 1
+}
+
+// builtin returns the constant index of the builtin of sym
+func (c *C) builtin(t token.T, sym *resolve.Symbol) int {
+	return c.constant(t, object.Builtins[sym.Name])
+}
+
+// constant returns the index of obj in the constant pool,
+// numbers, strings and builtins are only added once
+func (c *C) constant(t token.T, obj object.Object) int {
+	key := constKey{obj.Type(), obj.String()}
+	if i, ok := c.constIndex[key]; ok {
+		return i
+	}
+	i := c.addConstant(t, obj)
+	c.constIndex[key] = i
+	return i
+}
+
+// addConstant appends obj to the constant pool
+func (c *C) addConstant(t token.T, obj object.Object) int {
+	c.fits(t, len(c.constants)+1, math.MaxUint16+1, "constants")
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// fits reports an error at t if n exceeds max
+func (c *C) fits(t token.T, n, max int, what string) bool {
+	if n > max {
+		cerr(c, t, "too many %s, the limit is %d", what, max)
+		return false
+	}
+	return true
+}
+
+// emit appends an instruction compiled from t and returns its offset
+func (c *C) emit(t token.T, op Opcode, operands ...int) int {
+	proto := c.fn.proto
+	pos := len(proto.Instructions)
+	proto.Instructions = append(proto.Instructions, Make(op, operands...)...)
+	proto.Lines.add(pos, t)
+	return pos
+}
+
+// patch sets the target of the jump at pos to the next instruction
+func (c *C) patch(t token.T, pos int) {
+	c.patchOperand(t, pos, 0)
+}
+
+// patchOperand sets operand i of the jump
+// at pos to the offset of the next instruction
+func (c *C) patchOperand(t token.T, pos, i int) {
+	ins := c.fn.proto.Instructions
+	target := len(ins)
+	if !c.fits(t, target, math.MaxUint16, "instructions in a function") {
+		return
+	}
+	def, _ := Lookup(Opcode(ins[pos]))
+	operands, _ := ReadOperands(def, ins[pos+1:])
+	operands[i] = target
+	copy(ins[pos:], Make(Opcode(ins[pos]), operands...))
+}
+
+func (c *C) openBlock() {
+	c.fn.block = &block{outer: c.fn.block}
+}
+
+// closeBlock compiles the deferred function bodies of the current
+// block and returns to the enclosing block. If closing is set and a
+// closure captured a local of the block, the captured slots are
+// closed, so the next run of the block gets fresh variables.
+func (c *C) closeBlock(t token.T, closing bool) {
+	b := c.fn.block
+	for _, fn := range b.deferred {
+		fn()
+	}
+	c.fn.block = b.outer
+	if !closing {
+		return
+	}
+	for _, l := range b.locals {
+		if l.captured {
+			c.emit(t, OpCloseUpvalues, b.locals[0].slot)
+			return
+		}
+	}
+}
@@ -0,0 +1,594 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/parser"
+	"github.com/lindeneg/blue/lang/resolve"
+)
+
+type compilerTest struct {
+	input        string
+	constants    []any
+	instructions []byte
+}
+
+func TestCompileExpressions(t *testing.T) {
+	tests := []compilerTest{
+		{
+			"1 + 2;",
+			[]any{1, 2},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpConstant, 1),
+				Make(OpAdd),
+				Make(OpReturn),
+			),
+		},
+		{
+			"1; 2 * 1;",
+			[]any{1, 2},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpPop),
+				Make(OpConstant, 1),
+				Make(OpConstant, 0),
+				Make(OpMul),
+				Make(OpReturn),
+			),
+		},
+		{
+			`-1 < 2 == !true; "a" + "a";`,
+			[]any{1, 2, "a"},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpMinus),
+				Make(OpConstant, 1),
+				Make(OpLess),
+				Make(OpTrue),
+				Make(OpNot),
+				Make(OpEqual),
+				Make(OpPop),
+				Make(OpConstant, 2),
+				Make(OpConstant, 2),
+				Make(OpAdd),
+				Make(OpReturn),
+			),
+		},
+		{
+			"null ?? 1;",
+			[]any{1},
+			concat(
+				Make(OpNull),
+				Make(OpJumpNotNull, 8),
+				Make(OpPop),
+				Make(OpConstant, 0),
+				Make(OpReturn),
+			),
+		},
+		{
+			"true ? 1 : 2;",
+			[]any{1, 2},
+			concat(
+				Make(OpTrue),
+				Make(OpJumpFalse, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 13),
+				Make(OpConstant, 1),
+				Make(OpReturn),
+			),
+		},
+		{
+			"[1, 2][0];",
+			[]any{1, 2, 0},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpConstant, 1),
+				Make(OpArray, 2),
+				Make(OpConstant, 2),
+				Make(OpIndex),
+				Make(OpReturn),
+			),
+		},
+		{
+			`({"a": 1});`,
+			[]any{"a", 1},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpConstant, 1),
+				Make(OpDict, 1),
+				Make(OpReturn),
+			),
+		},
+		{
+			"0..=10 step 2; ..5;",
+			[]any{0, 10, 2, 5},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpConstant, 1),
+				Make(OpConstant, 2),
+				Make(OpRange, RangeStart|RangeEnd|RangeStep|RangeInclusive),
+				Make(OpPop),
+				Make(OpConstant, 3),
+				Make(OpRange, RangeEnd),
+				Make(OpReturn),
+			),
+		},
+		{
+			"len([]);",
+			[]any{object.Builtins["len"]},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpArray, 0),
+				Make(OpCall, 1),
+				Make(OpReturn),
+			),
+		},
+		{
+			"",
+			[]any{},
+			concat(
+				Make(OpNull),
+				Make(OpReturn),
+			),
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestCompileGlobalsAndLocals(t *testing.T) {
+	tests := []compilerTest{
+		{
+			"let a = 1; const b = a; a = b;",
+			[]any{1},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpSetGlobal, 0),
+				Make(OpGetGlobal, 0),
+				Make(OpSetGlobal, 1),
+				Make(OpGetGlobal, 1),
+				Make(OpSetGlobal, 0),
+				Make(OpNull),
+				Make(OpReturn),
+			),
+		},
+		{
+			"{ let a = 1; a; }",
+			[]any{1},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpSetLocal, 0),
+				Make(OpGetLocal, 0),
+				Make(OpReturn),
+			),
+		},
+		{
+			"{ let a = 1; } { let a = 2; a; }",
+			[]any{1, 2},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpSetLocal, 0),
+				Make(OpNull),
+				Make(OpPop),
+				Make(OpConstant, 1),
+				Make(OpSetLocal, 1),
+				Make(OpGetLocal, 1),
+				Make(OpReturn),
+			),
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestCompileConditionals(t *testing.T) {
+	tests := []compilerTest{
+		{
+			"if true { 1 }",
+			[]any{1},
+			concat(
+				Make(OpTrue),
+				Make(OpJumpFalse, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 11),
+				Make(OpNull),
+				Make(OpReturn),
+			),
+		},
+		{
+			"if false { 1 } elif true { 2 } else { 3 }",
+			[]any{1, 2, 3},
+			concat(
+				Make(OpFalse),
+				Make(OpJumpFalse, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 23),
+				Make(OpTrue),
+				Make(OpJumpFalse, 20),
+				Make(OpConstant, 1),
+				Make(OpJump, 23),
+				Make(OpConstant, 2),
+				Make(OpReturn),
+			),
+		},
+		{
+			"for let i = 0..3 { i; }",
+			[]any{0, 3},
+			concat(
+				Make(OpConstant, 0),
+				Make(OpConstant, 1),
+				Make(OpRange, RangeStart|RangeEnd),
+				Make(OpIter),
+				Make(OpIterNext, 20),
+				Make(OpSetLocal, 0),
+				Make(OpGetLocal, 0),
+				Make(OpPop),
+				Make(OpJump, 9),
+				Make(OpNull),
+				Make(OpReturn),
+			),
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestCompileFunctions(t *testing.T) {
+	bc := compileProgram(t, `fn add(a, b = 2, ...rest) { return a + b; }
+add(1);`)
+	expectInstructions(t, bc.Main.Instructions, concat(
+		Make(OpClosure, 0),
+		Make(OpSetGlobal, 0),
+		Make(OpGetGlobal, 0),
+		Make(OpPop),
+		Make(OpGetGlobal, 0),
+		Make(OpConstant, 1),
+		Make(OpCall, 1),
+		Make(OpReturn),
+	))
+	fn, ok := bc.Constants[0].(*Function)
+	if !ok {
+		t.Fatalf("constant is not a function, got=%T", bc.Constants[0])
+	}
+	if fn.Name != "add" || fn.NumLocals != 3 || !fn.Rest {
+		t.Fatalf("wrong prototype, name=%q, locals=%d, rest=%t", fn.Name, fn.NumLocals, fn.Rest)
+	}
+	expectedParams := []Param{{"a", false}, {"b", true}}
+	if fmt.Sprint(fn.Params) != fmt.Sprint(expectedParams) {
+		t.Fatalf("wrong params, want=%v, got=%v", expectedParams, fn.Params)
+	}
+	expectInstructions(t, fn.Instructions, concat(
+		Make(OpJumpSet, 1, 9),
+		Make(OpConstant, 2),
+		Make(OpSetLocal, 1),
+		Make(OpGetLocal, 0),
+		Make(OpGetLocal, 1),
+		Make(OpAdd),
+		Make(OpReturn),
+		Make(OpNull),
+		Make(OpReturn),
+	))
+	if bc.Globals[0] != "add" {
+		t.Errorf("wrong global name, want=%q, got=%q", "add", bc.Globals[0])
+	}
+}
+
+func TestCompileTailCalls(t *testing.T) {
+	bc := compileProgram(t, `fn f(n) {
+	if n { return f(n); }
+	return 1 + f(n);
+}`)
+	fn := bc.Constants[0].(*Function)
+	expectInstructions(t, fn.Instructions, concat(
+		Make(OpGetLocal, 0),
+		Make(OpJumpFalse, 17),
+		Make(OpGetGlobal, 0),
+		Make(OpGetLocal, 0),
+		Make(OpTailCall, 1),
+		Make(OpReturn),
+		Make(OpNull),
+		Make(OpJump, 18),
+		Make(OpNull),
+		Make(OpPop),
+		Make(OpConstant, 1),
+		Make(OpGetGlobal, 0),
+		Make(OpGetLocal, 0),
+		Make(OpCall, 1),
+		Make(OpAdd),
+		Make(OpReturn),
+		Make(OpNull),
+		Make(OpReturn),
+	))
+}
+
+func TestCompileStructs(t *testing.T) {
+	bc := compileProgram(t, `struct P { x, y }
+fn (p P) sum(k) { return p.x + p.y.z(k); }
+P(1, 2).sum(3);`)
+	expectInstructions(t, bc.Main.Instructions, concat(
+		Make(OpConstant, 0),
+		Make(OpConstant, 1),
+		Make(OpStruct, 2, 2),
+		Make(OpSetGlobal, 0),
+		Make(OpGetGlobal, 0),
+		Make(OpClosure, 3),
+		Make(OpMethod, 4),
+		Make(OpPop),
+		Make(OpGetGlobal, 0),
+		Make(OpConstant, 5),
+		Make(OpConstant, 6),
+		Make(OpCall, 2),
+		Make(OpConstant, 7),
+		Make(OpInvoke, 4, 1, 0),
+		Make(OpReturn),
+	))
+	sum := bc.Constants[3].(*Function)
+	if sum.Name != "P.sum" || !sum.Method || len(sum.Params) != 2 || sum.Params[0].Name != "p" {
+		t.Errorf("wrong method prototype, got name=%q method=%t params=%v", sum.Name, sum.Method, sum.Params)
+	}
+	if bc.Main.Caches != 1 || sum.Caches != 3 {
+		t.Errorf("wrong number of caches, want=1 and 3, got=%d and %d", bc.Main.Caches, sum.Caches)
+	}
+	expectInstructions(t, sum.Instructions, concat(
+		Make(OpGetLocal, 0),
+		Make(OpGetMember, 0, 0),
+		Make(OpGetLocal, 0),
+		Make(OpGetMember, 1, 1),
+		Make(OpGetLocal, 1),
+		Make(OpInvoke, 8, 1, 2),
+		Make(OpAdd),
+		Make(OpReturn),
+		Make(OpNull),
+		Make(OpReturn),
+	))
+}
+
+func TestMaxStack(t *testing.T) {
+	bc := compileProgram(t, `fn f(a) { return [a, [a, a], a + 1]; }
+f(1) ?? [1, 2];`)
+	f := bc.Constants[0].(*Function)
+	// the call may insert a receiver above its arguments
+	if f.MaxStack != 4 || bc.Main.MaxStack != 3 {
+		t.Errorf("wrong stack size, want=4 and 3, got=%d and %d", f.MaxStack, bc.Main.MaxStack)
+	}
+}
+
+func TestCompileClosures(t *testing.T) {
+	bc := compileProgram(t, `fn outer() {
+	let x = 1;
+	return fn() {
+		return fn() { x = x + 1; return x; };
+	};
+}`)
+	outer := bc.Constants[0].(*Function)
+	middle := bc.Constants[2].(*Function)
+	inner := bc.Constants[3].(*Function)
+	expectInstructions(t, outer.Instructions, concat(
+		Make(OpConstant, 1),
+		Make(OpSetLocal, 0),
+		Make(OpClosure, 2),
+		Make(OpReturn),
+		Make(OpNull),
+		Make(OpReturn),
+	))
+	expectInstructions(t, middle.Instructions, concat(
+		Make(OpClosure, 3),
+		Make(OpReturn),
+		Make(OpNull),
+		Make(OpReturn),
+	))
+	expectInstructions(t, inner.Instructions, concat(
+		Make(OpGetUpvalue, 0),
+		Make(OpConstant, 1),
+		Make(OpAdd),
+		Make(OpSetUpvalue, 0),
+		Make(OpGetUpvalue, 0),
+		Make(OpReturn),
+		Make(OpNull),
+		Make(OpReturn),
+	))
+	if fmt.Sprint(middle.Upvalues) != fmt.Sprint([]Upvalue{{Local: true, Index: 0, Name: "x"}}) {
+		t.Errorf("wrong upvalues of middle, got=%v", middle.Upvalues)
+	}
+	if fmt.Sprint(inner.Upvalues) != fmt.Sprint([]Upvalue{{Local: false, Index: 0, Name: "x"}}) {
+		t.Errorf("wrong upvalues of inner, got=%v", inner.Upvalues)
+	}
+}
+
+func TestCompileClosesCapturedLocals(t *testing.T) {
+	bc := compileProgram(t, `let fns = [];
+for let i = 0..3 { fns = [fn() { return i; }]; }`)
+	expectInstructions(t, bc.Main.Instructions, concat(
+		Make(OpArray, 0),
+		Make(OpSetGlobal, 0),
+		Make(OpConstant, 0),
+		Make(OpConstant, 1),
+		Make(OpRange, RangeStart|RangeEnd),
+		Make(OpIter),
+		Make(OpIterNext, 36),
+		Make(OpSetLocal, 0),
+		Make(OpClosure, 2),
+		Make(OpArray, 1),
+		Make(OpSetGlobal, 0),
+		Make(OpNull),
+		Make(OpPop),
+		Make(OpCloseUpvalues, 0),
+		Make(OpJump, 15),
+		Make(OpNull),
+		Make(OpReturn),
+	))
+	fn := bc.Constants[2].(*Function)
+	if fmt.Sprint(fn.Upvalues) != fmt.Sprint([]Upvalue{{Local: true, Index: 0, Name: "i"}}) {
+		t.Errorf("wrong upvalues, got=%v", fn.Upvalues)
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	bc := compileProgram(t, `let a = 1;
+let b = a +
+	2;`)
+	tests := []struct {
+		offset int
+		line   int
+		col    int
+	}{
+		{0, 1, 9},   // OpConstant 1
+		{3, 1, 5},   // OpSetGlobal a
+		{6, 2, 9},   // OpGetGlobal a
+		{9, 3, 2},   // OpConstant 2
+		{12, 2, 11}, // OpAdd
+		{13, 2, 5},  // OpSetGlobal b
+	}
+	for _, tt := range tests {
+		tok, ok := bc.Main.Lines.Lookup(tt.offset)
+		if !ok {
+			t.Fatalf("no line for offset %d", tt.offset)
+		}
+		if tok.Line != tt.line || tok.Col != tt.col {
+			t.Errorf("wrong position of offset %d, want=L%d:C%d, got=L%d:C%d",
+				tt.offset, tt.line, tt.col, tok.Line, tok.Col)
+		}
+	}
+	if _, ok := bc.Main.Lines.Lookup(-1); ok {
+		t.Error("expected no line before the first instruction")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1; } catch e { }`, `compiler does not support "try"`},
+		{`let a = [1]; a?[0];`, "compiler does not support optional index expressions"},
+		{`fn gen() { yield 1; }`, "compiler does not support generators"},
+		{`async fn f() { }`, "compiler does not support async functions"},
+		{`fn f(a) { } f(a: 1);`, "compiler does not support named arguments"},
+		{`[...[1]];`, "compiler does not support spread arguments"},
+		{`let p = null; p?.x;`, "compiler does not support optional member expressions"},
+	}
+	for i, tt := range tests {
+		name := fmt.Sprintf("compile-error-%d", i)
+		c, _ := compile(t, tt.input, name)
+		errs := c.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("wrong number of errors for %q, want=1, got=%d", tt.input, len(errs))
+		}
+		if !strings.Contains(errs[0].Msg, tt.expected) || !strings.Contains(errs[0].Msg, name) {
+			t.Errorf("unexpected error\nwant=%q\ngot=%q", tt.expected, errs[0].Msg)
+		}
+	}
+}
+
+// TestUnsupportedPositions checks that a node the compiler
+// cannot lower is reported at its own token
+func TestUnsupportedPositions(t *testing.T) {
+	tests := []struct {
+		input     string
+		line, col int
+		highlight string
+	}{
+		{`"héllo"[1:3];`, 1, 9, "\"héllo\"\x1b[31m[\x1b[0m1:3];"},
+		{"let a = [1, 2, 3];\na[5:];", 2, 2, "a\x1b[31m[\x1b[0m5:];"},
+		{"fn f() { return 1; }\nf()?;", 2, 4, "f()\x1b[31m?\x1b[0m;"},
+		{"fn f() { }\nlet t = spawn f();", 2, 9, "let t = \x1b[31mspawn\x1b[0m f();"},
+		{"let x = 1;\ntry { x; } catch e { }", 2, 1, "\x1b[31mtry\x1b[0m { x; } catch e { }"},
+	}
+	for i, tt := range tests {
+		c, _ := compile(t, tt.input, fmt.Sprintf("unsupported-%d", i))
+		errs := c.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("wrong number of errors for %q, want=1, got=%d", tt.input, len(errs))
+		}
+		if errs[0].T.Line != tt.line || errs[0].T.Col != tt.col {
+			t.Errorf("wrong position for %q, want=L%d:C%d, got=L%d:C%d",
+				tt.input, tt.line, tt.col, errs[0].T.Line, errs[0].T.Col)
+		}
+		if errs[0].Line != tt.highlight {
+			t.Errorf("wrong highlight for %q\nwant=%q\ngot=%q", tt.input, tt.highlight, errs[0].Line)
+		}
+	}
+}
+
+func TestTooManyLocals(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("{ ")
+	for i := 0; i < 257; i++ {
+		fmt.Fprintf(&input, "let x%d = 1; ", i)
+	}
+	input.WriteString("}")
+	c, _ := compile(t, input.String(), "locals")
+	if len(c.Errors()) != 1 || !strings.Contains(c.Errors()[0].Msg, "too many local variables") {
+		t.Fatalf("expected too many local variables, got=%v", c.Errors())
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTest) {
+	t.Helper()
+	for _, tt := range tests {
+		bc := compileProgram(t, tt.input)
+		expectInstructions(t, bc.Main.Instructions, tt.instructions)
+		if len(bc.Constants) != len(tt.constants) {
+			t.Fatalf("wrong number of constants for %q, want=%d, got=%d",
+				tt.input, len(tt.constants), len(bc.Constants))
+		}
+		for i, want := range tt.constants {
+			expectConstant(t, bc.Constants[i], want)
+		}
+	}
+}
+
+func expectInstructions(t *testing.T, got Instructions, want []byte) {
+	t.Helper()
+	if got.String() != Instructions(want).String() {
+		t.Fatalf("wrong instructions\nwant=\n%s\ngot=\n%s", Instructions(want), got)
+	}
+}
+
+func expectConstant(t *testing.T, got object.Object, want any) {
+	t.Helper()
+	switch want := want.(type) {
+	case int:
+		n, ok := got.(*object.Number)
+		if !ok || n.Value != float64(want) {
+			t.Errorf("wrong constant, want=%d, got=%s", want, got)
+		}
+	case string:
+		s, ok := got.(*object.String)
+		if !ok || s.Value != want {
+			t.Errorf("wrong constant, want=%q, got=%s", want, got)
+		}
+	case object.Object:
+		if got != want {
+			t.Errorf("wrong constant, want=%s, got=%s", want, got)
+		}
+	}
+}
+
+func compileProgram(t testing.TB, input string) *Bytecode {
+	t.Helper()
+	c, bc := compile(t, input, "compiler-test")
+	for _, err := range c.Errors() {
+		t.Fatal(err.Msg)
+	}
+	return bc
+}
+
+func compile(t testing.TB, input, name string) (*C, *Bytecode) {
+	t.Helper()
+	l := lexer.FromString(input)
+	p := parser.New(l, name)
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Fatal(err.Msg)
+	}
+	r := resolve.New(l, name)
+	table := r.Resolve(program)
+	for _, err := range r.Errors() {
+		t.Fatal(err.Msg)
+	}
+	c := New(l, name)
+	return c, c.Compile(program, table)
+}
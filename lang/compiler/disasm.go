@@ -0,0 +1,143 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/blue/lang/object"
+)
+
+// Disassemble writes the instructions of main followed by every function
+// of the constant pool. Each instruction is printed with its offset,
+// decoded operands, what the operands refer to and the position it was
+// compiled from, which is only printed when it changes i.e
+//
+//	0003 OpSetGlobal     0       ; add             L1:C4
+func (bc *Bytecode) Disassemble(w io.Writer) error {
+	d := &disassembler{w: w, bc: bc}
+	d.function(bc.Main)
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*Function); ok {
+			d.printf("\n")
+			d.function(fn)
+		}
+	}
+	return d.err
+}
+
+type disassembler struct {
+	w   io.Writer
+	bc  *Bytecode
+	err error
+}
+
+func (d *disassembler) printf(format string, args ...any) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, args...)
+	}
+}
+
+// function writes the header and instructions of fn
+func (d *disassembler) function(fn *Function) {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	var params []string
+	for _, p := range fn.Params {
+		if p.Default {
+			params = append(params, p.Name+"?")
+		} else {
+			params = append(params, p.Name)
+		}
+	}
+	if fn.Rest {
+		params = append(params, "...")
+	}
+	d.printf("== %s(%s) locals=%d upvalues=%d ==\n",
+		name, strings.Join(params, ", "), fn.NumLocals, len(fn.Upvalues))
+	line := -1
+	for i := 0; i < len(fn.Instructions); {
+		def, err := Lookup(Opcode(fn.Instructions[i]))
+		if err != nil {
+			d.printf("%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, fn.Instructions[i+1:])
+		ops := make([]string, len(operands))
+		for j, o := range operands {
+			ops[j] = strconv.Itoa(o)
+		}
+		pos := ""
+		if t, ok := fn.Lines.Lookup(i); ok && t.Line != line {
+			pos = fmt.Sprintf("L%d:C%d", t.Line, t.Col)
+			line = t.Line
+		}
+		out := fmt.Sprintf("%04d %-15s %-7s %-17s %s", i, def.Name,
+			strings.Join(ops, " "), d.comment(fn, Opcode(fn.Instructions[i]), operands), pos)
+		d.printf("%s\n", strings.TrimRight(out, " "))
+		i += 1 + read
+	}
+}
+
+// comment describes what the operands of op refer to
+func (d *disassembler) comment(fn *Function, op Opcode, operands []int) string {
+	describe := ""
+	switch op {
+	case OpConstant, OpClosure, OpStruct, OpMethod, OpGetMember, OpInvoke, OpTailInvoke:
+		describe = d.constant(operands[0])
+	case OpGetGlobal, OpSetGlobal:
+		if operands[0] < len(d.bc.Globals) {
+			describe = d.bc.Globals[operands[0]]
+		}
+	case OpGetUpvalue, OpSetUpvalue:
+		if operands[0] < len(fn.Upvalues) {
+			describe = fn.Upvalues[operands[0]].Name
+		}
+	case OpGetLocal, OpSetLocal, OpJumpSet, OpCloseUpvalues:
+		if operands[0] < len(fn.Locals) {
+			describe = fn.Locals[operands[0]]
+		}
+	case OpRange:
+		var flags []string
+		for _, f := range []struct {
+			flag int
+			name string
+		}{
+			{RangeStart, "start"},
+			{RangeEnd, "end"},
+			{RangeStep, "step"},
+			{RangeInclusive, "inclusive"},
+		} {
+			if operands[0]&f.flag != 0 {
+				flags = append(flags, f.name)
+			}
+		}
+		describe = strings.Join(flags, "|")
+	}
+	if describe == "" {
+		return ""
+	}
+	return "; " + describe
+}
+
+// constant returns the constant at i as written in source
+func (d *disassembler) constant(i int) string {
+	if i >= len(d.bc.Constants) {
+		return "<missing>"
+	}
+	switch c := d.bc.Constants[i].(type) {
+	case *object.String:
+		return strconv.Quote(c.Value)
+	case *Function:
+		if c.Name == "" {
+			return "fn <anonymous>"
+		}
+		return "fn " + c.Name
+	default:
+		return c.String()
+	}
+}
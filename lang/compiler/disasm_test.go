@@ -0,0 +1,65 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	bc := compileProgram(t, `let name = "blue";
+fn greet(who = name) {
+	let n = 0;
+	return fn() {
+		n = n + 1;
+		return who;
+	};
+}
+for const i = ..=2 { greet(); }`)
+	expected := `== main() locals=1 upvalues=0 ==
+0000 OpConstant      0       ; "blue"          L1:C12
+0003 OpSetGlobal     0       ; name
+0006 OpClosure       1       ; fn greet        L2:C1
+0009 OpSetGlobal     1       ; greet
+0012 OpGetGlobal     1       ; greet
+0015 OpPop
+0016 OpConstant      2       ; 2               L9:C18
+0019 OpRange         10      ; end|inclusive
+0021 OpIter
+0022 OpIterNext      36
+0025 OpSetLocal      0       ; i
+0027 OpGetGlobal     1       ; greet
+0030 OpCall          0
+0032 OpPop
+0033 OpJump          22
+0036 OpNull
+0037 OpReturn
+
+== greet(who?) locals=2 upvalues=0 ==
+0000 OpJumpSet       0 9     ; who             L2:C10
+0004 OpGetGlobal     0       ; name
+0007 OpSetLocal      0       ; who
+0009 OpConstant      3       ; 0               L3:C10
+0012 OpSetLocal      1       ; n
+0014 OpClosure       4       ; fn <anonymous>  L4:C9
+0017 OpReturn
+0018 OpNull                                    L2:C22
+0019 OpReturn
+
+== <anonymous>() locals=0 upvalues=2 ==
+0000 OpGetUpvalue    0       ; n               L5:C7
+0002 OpConstant      5       ; 1
+0005 OpAdd
+0006 OpSetUpvalue    0       ; n
+0008 OpGetUpvalue    1       ; who             L6:C10
+0010 OpReturn
+0011 OpNull                                    L4:C14
+0012 OpReturn
+`
+	var out bytes.Buffer
+	if err := bc.Disassemble(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong disassembly\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,27 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// CompileErr describes an error encountered during compilation
+type CompileErr struct {
+	token.T
+	Msg  string
+	Line string
+}
+
+// newCompileErr formats an error with sourceName, line, col and message.
+func newCompileErr(c *C, t token.T, msg string, args ...any) CompileErr {
+	l := t.HighlightErr(c.l.Line(t.Line))
+	m := fmt.Sprintf(msg, args...)
+	m = fmt.Sprintf("CompileError: %s at\n\t%s:L%d:C%d ------> %s",
+		m, c.sourceName, t.Line, t.Col, l)
+	return CompileErr{T: t, Msg: m, Line: l}
+}
+
+func cerr(c *C, t token.T, msg string, args ...any) {
+	c.errs = append(c.errs, newCompileErr(c, t, msg, args...))
+}
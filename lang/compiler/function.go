@@ -0,0 +1,70 @@
+package compiler
+
+import (
+	"github.com/lindeneg/blue/lang/object"
+)
+
+// Function is the prototype of a compiled function, the
+// virtual machine creates a closure of it for every OpClosure
+type Function struct {
+	// Name is empty for anonymous functions,
+	// methods are named Struct.method
+	Name         string
+	Instructions Instructions
+	Lines        LineTable
+	// NumLocals is the number of slots of a frame,
+	// parameters take up the first slots in order
+	NumLocals int
+	// Locals holds the name of every slot
+	Locals []string
+	// MaxStack is the number of slots the operands of a frame
+	// use above its locals, set by the compiler and by Unmarshal
+	MaxStack int
+	Params   []Param
+	// Rest is set if the slot after the parameters
+	// collects the remaining arguments
+	Rest bool
+	// Method is set if the first parameter is the receiver
+	Method bool
+	// Caches is the number of inline caches of the
+	// member accesses and method calls of the function
+	Caches int
+	// Upvalues are the captured variables of
+	// the enclosing functions, in operand order
+	Upvalues []Upvalue
+}
+
+func (f *Function) Type() object.Type { return object.COMPILED }
+func (f *Function) String() string {
+	if f.Name == "" {
+		return "<compiled fn>"
+	}
+	return "<compiled fn " + f.Name + ">"
+}
+
+// Param is a parameter of a compiled function
+type Param struct {
+	Name string
+	// Default is set if the prologue of the
+	// function assigns a default value
+	Default bool
+}
+
+// Upvalue describes how a closure captures a variable
+type Upvalue struct {
+	// Local is set if Index is a slot of the enclosing function,
+	// otherwise Index is an upvalue of the enclosing function
+	Local bool
+	Index int
+	// Name of the captured variable
+	Name string
+}
+
+// Bytecode is the result of compiling a program
+type Bytecode struct {
+	// Main is the top level of the program
+	Main      *Function
+	Constants []object.Object
+	// Globals holds the name of every global slot
+	Globals []string
+}
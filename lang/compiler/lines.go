@@ -0,0 +1,38 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// Line maps the instructions from Offset up to
+// the offset of the next Line back to Token
+type Line struct {
+	Offset int
+	Token  token.T
+}
+
+// LineTable maps instruction offsets back to the
+// tokens they were compiled from, ordered by offset
+type LineTable []Line
+
+// add records that the instruction at offset was compiled
+// from t, a run of instructions from one token is one Line
+func (lt *LineTable) add(offset int, t token.T) {
+	if n := len(*lt); n > 0 && (*lt)[n-1].Token == t {
+		return
+	}
+	*lt = append(*lt, Line{Offset: offset, Token: t})
+}
+
+// Lookup returns the token the instruction at offset was compiled from
+func (lt LineTable) Lookup(offset int) (token.T, bool) {
+	i := sort.Search(len(lt), func(i int) bool {
+		return lt[i].Offset > offset
+	})
+	if i == 0 {
+		return token.T{}, false
+	}
+	return lt[i-1].Token, true
+}
@@ -0,0 +1,210 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Opcode is the first byte of an instruction
+type Opcode byte
+
+const (
+	OpConstant      Opcode = iota // push constant i
+	OpNull                        // push null
+	OpTrue                        // push true
+	OpFalse                       // push false
+	OpPop                         // discard the top of the stack
+	OpAdd                         // a + b
+	OpSub                         // a - b
+	OpMul                         // a * b
+	OpDiv                         // a / b
+	OpEqual                       // a == b
+	OpNotEqual                    // a != b
+	OpLess                        // a < b
+	OpLessEqual                   // a <= b
+	OpGreater                     // a > b
+	OpGreaterEqual                // a >= b
+	OpMinus                       // -a
+	OpNot                         // !a
+	OpJump                        // jump to offset
+	OpJumpFalse                   // pop a, jump to offset if a is falsy
+	OpJumpNotNull                 // jump to offset if the top of the stack is not null
+	OpJumpSet                     // jump to offset if local i was given by the caller
+	OpGetGlobal                   // push global i
+	OpSetGlobal                   // pop into global i
+	OpGetLocal                    // push local i
+	OpSetLocal                    // pop into local i
+	OpGetUpvalue                  // push upvalue i
+	OpSetUpvalue                  // pop into upvalue i
+	OpCloseUpvalues               // close upvalues of locals i and above
+	OpArray                       // pop n elements into an array
+	OpIndex                       // a[i]
+	OpRange                       // pop the bounds given by flags into a range
+	OpIter                        // replace an iterable with an iterator over it
+	OpIterNext                    // push the next value, or pop the iterator and jump to offset
+	OpClosure                     // push a closure of function constant i
+	OpCall                        // call with n arguments
+	OpReturn                      // return the top of the stack
+	OpTailCall                    // call with n arguments in place of the current call
+	OpStruct                      // pop n field names into a struct named by constant i
+	OpMethod                      // pop a closure into the methods of a struct as constant i
+	OpGetMember                   // replace an instance with its member constant i, using cache c
+	OpInvoke                      // call member constant i of an instance with n arguments, using cache c
+	OpTailInvoke                  // OpInvoke in place of the current call
+	OpDict                        // pop n keys and values into a dict
+)
+
+// Range flags are the operand of OpRange
+const (
+	RangeStart     = 1 << iota // the start is on the stack
+	RangeEnd                   // the end is on the stack
+	RangeStep                  // the step is on the stack
+	RangeInclusive             // the end is included
+)
+
+// Definition describes an opcode, OperandWidths
+// holds the number of bytes of every operand
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:      {"OpConstant", []int{2}},
+	OpNull:          {"OpNull", []int{}},
+	OpTrue:          {"OpTrue", []int{}},
+	OpFalse:         {"OpFalse", []int{}},
+	OpPop:           {"OpPop", []int{}},
+	OpAdd:           {"OpAdd", []int{}},
+	OpSub:           {"OpSub", []int{}},
+	OpMul:           {"OpMul", []int{}},
+	OpDiv:           {"OpDiv", []int{}},
+	OpEqual:         {"OpEqual", []int{}},
+	OpNotEqual:      {"OpNotEqual", []int{}},
+	OpLess:          {"OpLess", []int{}},
+	OpLessEqual:     {"OpLessEqual", []int{}},
+	OpGreater:       {"OpGreater", []int{}},
+	OpGreaterEqual:  {"OpGreaterEqual", []int{}},
+	OpMinus:         {"OpMinus", []int{}},
+	OpNot:           {"OpNot", []int{}},
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpFalse:     {"OpJumpFalse", []int{2}},
+	OpJumpNotNull:   {"OpJumpNotNull", []int{2}},
+	OpJumpSet:       {"OpJumpSet", []int{1, 2}},
+	OpGetGlobal:     {"OpGetGlobal", []int{2}},
+	OpSetGlobal:     {"OpSetGlobal", []int{2}},
+	OpGetLocal:      {"OpGetLocal", []int{1}},
+	OpSetLocal:      {"OpSetLocal", []int{1}},
+	OpGetUpvalue:    {"OpGetUpvalue", []int{1}},
+	OpSetUpvalue:    {"OpSetUpvalue", []int{1}},
+	OpCloseUpvalues: {"OpCloseUpvalues", []int{1}},
+	OpArray:         {"OpArray", []int{2}},
+	OpIndex:         {"OpIndex", []int{}},
+	OpRange:         {"OpRange", []int{1}},
+	OpIter:          {"OpIter", []int{}},
+	OpIterNext:      {"OpIterNext", []int{2}},
+	OpClosure:       {"OpClosure", []int{2}},
+	OpCall:          {"OpCall", []int{1}},
+	OpReturn:        {"OpReturn", []int{}},
+	OpTailCall:      {"OpTailCall", []int{1}},
+	OpStruct:        {"OpStruct", []int{2, 1}},
+	OpMethod:        {"OpMethod", []int{2}},
+	OpGetMember:     {"OpGetMember", []int{2, 2}},
+	OpInvoke:        {"OpInvoke", []int{2, 1, 2}},
+	OpTailInvoke:    {"OpTailInvoke", []int{2, 1, 2}},
+	OpDict:          {"OpDict", []int{2}},
+}
+
+// Lookup returns the definition of op
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes op and its operands into an instruction,
+// it returns an empty instruction if op is undefined
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+	ins := make([]byte, length)
+	ins[0] = byte(op)
+	offset := 1
+	for i, o := range operands {
+		switch w := def.OperandWidths[i]; w {
+		case 1:
+			ins[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(ins[offset:], uint16(o))
+		}
+		offset += def.OperandWidths[i]
+	}
+	return ins
+}
+
+// ReadOperands decodes the operands of def from ins and
+// returns them with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, w := range def.OperandWidths {
+		switch w {
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		}
+		offset += w
+	}
+	return operands, offset
+}
+
+// ReadUint8 decodes a one byte operand
+func ReadUint8(ins Instructions) uint8 { return ins[0] }
+
+// ReadUint16 decodes a two byte operand
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// Instructions is a sequence of encoded instructions
+type Instructions []byte
+
+// String returns one instruction per line prefixed by its offset
+// i.e 0000 OpConstant 1
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+	for i := 0; i < len(ins); {
+		def, err := Lookup(Opcode(ins[i]))
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), len(def.OperandWidths))
+	}
+	out := def.Name
+	for _, o := range operands {
+		out += fmt.Sprintf(" %d", o)
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+package compiler
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpJumpSet, []int{3, 258}, []byte{byte(OpJumpSet), 3, 1, 2}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+	}
+	for _, tt := range tests {
+		ins := Make(tt.op, tt.operands...)
+		if len(ins) != len(tt.expected) {
+			t.Fatalf("wrong instruction length, want=%d, got=%d", len(tt.expected), len(ins))
+		}
+		for i, b := range tt.expected {
+			if ins[i] != b {
+				t.Errorf("wrong byte at %d, want=%d, got=%d", i, b, ins[i])
+			}
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		read     int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpCall, []int{255}, 1},
+		{OpJumpSet, []int{7, 1024}, 3},
+	}
+	for _, tt := range tests {
+		ins := Make(tt.op, tt.operands...)
+		def, err := Lookup(tt.op)
+		if err != nil {
+			t.Fatalf("definition not found: %s", err)
+		}
+		operands, read := ReadOperands(def, ins[1:])
+		if read != tt.read {
+			t.Fatalf("wrong number of bytes read, want=%d, got=%d", tt.read, read)
+		}
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("wrong operand %d, want=%d, got=%d", i, want, operands[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	ins := concat(
+		Make(OpConstant, 1),
+		Make(OpGetLocal, 2),
+		Make(OpJumpSet, 0, 12),
+		Make(OpAdd),
+		Make(OpReturn),
+	)
+	expected := `0000 OpConstant 1
+0003 OpGetLocal 2
+0005 OpJumpSet 0 12
+0009 OpAdd
+0010 OpReturn
+`
+	if ins.String() != expected {
+		t.Errorf("wrong instructions\nwant=%q\ngot=%q", expected, ins.String())
+	}
+}
+
+func TestLookupUndefined(t *testing.T) {
+	if _, err := Lookup(Opcode(255)); err == nil {
+		t.Fatal("expected an error for an undefined opcode")
+	}
+	if ins := Make(Opcode(255)); len(ins) != 0 {
+		t.Fatalf("expected an empty instruction, got=%v", ins)
+	}
+}
+
+func concat(instructions ...[]byte) Instructions {
+	var out Instructions
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
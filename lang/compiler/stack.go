@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// stackEffect returns the number of values the instruction op pops and
+// pushes when it continues with the next instruction, and the number
+// of slots it may use above the values it pops while it executes
+func stackEffect(op Opcode, operands []int) (pop, push, peak int) {
+	switch op {
+	case OpConstant, OpNull, OpTrue, OpFalse, OpGetGlobal, OpGetLocal,
+		OpGetUpvalue, OpClosure:
+		return 0, 1, 1
+	case OpPop, OpSetGlobal, OpSetLocal, OpSetUpvalue, OpJumpFalse, OpReturn:
+		return 1, 0, 0
+	case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpNotEqual, OpLess,
+		OpLessEqual, OpGreater, OpGreaterEqual, OpIndex:
+		return 2, 1, 1
+	case OpMinus, OpNot, OpJumpNotNull, OpIter, OpGetMember:
+		return 1, 1, 1
+	case OpArray:
+		return operands[0], 1, 1
+	case OpDict:
+		return 2 * operands[0], 1, 1
+	case OpRange:
+		n := bits.OnesCount(uint(operands[0] & (RangeStart | RangeEnd | RangeStep)))
+		return n, 1, 1
+	case OpIterNext:
+		// the iterator stays below the value, the jump pops it
+		return 1, 2, 2
+	case OpCall, OpTailCall:
+		// a bound method inserts its receiver before the arguments
+		return operands[0] + 1, 1, operands[0] + 2
+	case OpInvoke, OpTailInvoke:
+		return operands[1] + 1, 1, operands[1] + 2
+	case OpStruct:
+		return operands[1], 1, 1
+	case OpMethod:
+		return 2, 1, 1
+	}
+	return 0, 0, 0
+}
+
+// maxStack returns the maximum number of slots the operand stack of
+// ins uses. It follows every path from the first instruction and fails
+// if the stack underflows, if paths reach an instruction with different
+// depths or if control continues anywhere but at an instruction.
+func maxStack(ins Instructions) (int, error) {
+	start := make([]bool, len(ins))
+	for i := 0; i < len(ins); {
+		def, err := Lookup(Opcode(ins[i]))
+		if err != nil {
+			return 0, fmt.Errorf("%s at offset %d", err, i)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return 0, fmt.Errorf("truncated %s at offset %d", def.Name, i)
+		}
+		start[i] = true
+		i += 1 + width
+	}
+	// depths holds the depth before every instruction reached plus one
+	depths := make([]int, len(ins))
+	var work []int
+	reach := func(from, at, depth int) error {
+		switch {
+		case at >= len(ins):
+			return fmt.Errorf("offset %d continues past the end", from)
+		case !start[at]:
+			return fmt.Errorf("offset %d jumps into the middle of an instruction at offset %d", from, at)
+		case depths[at] == 0:
+			depths[at] = depth + 1
+			work = append(work, at)
+		case depths[at] != depth+1:
+			return fmt.Errorf("offset %d is reached with %d and %d values on the stack", at, depths[at]-1, depth)
+		}
+		return nil
+	}
+	high := 0
+	if err := reach(0, 0, 0); err != nil {
+		return 0, err
+	}
+	for len(work) > 0 {
+		at := work[len(work)-1]
+		work = work[:len(work)-1]
+		depth := depths[at] - 1
+		op := Opcode(ins[at])
+		def, _ := Lookup(op)
+		operands, n := ReadOperands(def, ins[at+1:])
+		next := at + 1 + n
+		pop, push, peak := stackEffect(op, operands)
+		if depth < pop {
+			return 0, fmt.Errorf("%s at offset %d underflows the stack, needs %d and has %d", def.Name, at, pop, depth)
+		}
+		high = max(high, depth-pop+peak)
+		after := depth - pop + push
+		var err error
+		switch op {
+		case OpReturn:
+		case OpJump:
+			err = reach(at, operands[0], after)
+		case OpJumpFalse, OpJumpNotNull:
+			if err = reach(at, next, after); err == nil {
+				err = reach(at, operands[0], after)
+			}
+		case OpJumpSet:
+			if err = reach(at, next, after); err == nil {
+				err = reach(at, operands[1], after)
+			}
+		case OpIterNext:
+			if err = reach(at, next, after); err == nil {
+				err = reach(at, operands[0], depth-1)
+			}
+		default:
+			err = reach(at, next, after)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return high, nil
+}
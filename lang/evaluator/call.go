@@ -0,0 +1,280 @@
+package evaluator
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// evalFunction creates a closure capturing env. A named
+// function is also declared in env, which allows recursion.
+func evalFunction(node *ast.Function, env *object.Environment) object.Object {
+	if node.Receiver != nil {
+		return evalMethod(node, env)
+	}
+	fn := &object.Function{Node: node, Env: env}
+	if node.Name != nil && !env.Declare(node.Name.Value, fn, false) {
+		return object.NewError(node.Name.Token, "%q is already declared in this scope", node.Name.Value)
+	}
+	return fn
+}
+
+func evalCallExpression(node *ast.CallExpression, env *object.Environment) object.Object {
+	callee, args, kwargs, err := evalCall(node, env)
+	if err != nil {
+		return err
+	}
+	return applyFunction(node.Token, callee, args, kwargs)
+}
+
+// evalCall evaluates the callee, positional and named arguments of node
+func evalCall(node *ast.CallExpression, env *object.Environment) (object.Object, []object.Object, map[string]object.Object, object.Object) {
+	callee := Eval(node.Function, env)
+	if isAbrupt(callee) {
+		return nil, nil, nil, callee
+	}
+	var (
+		positional []ast.Expression
+		named      []*ast.NamedArgument
+	)
+	for _, arg := range node.Arguments {
+		if n, ok := arg.(*ast.NamedArgument); ok {
+			named = append(named, n)
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	args, err := evalExpressions(positional, env)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	kwargs := make(map[string]object.Object, len(named))
+	for _, n := range named {
+		val := Eval(n.Value, env)
+		if isAbrupt(val) {
+			return nil, nil, nil, val
+		}
+		kwargs[n.Name.Value] = val
+	}
+	return callee, args, kwargs, nil
+}
+
+// applyFunction calls fn with positional args and named kwargs
+func applyFunction(t token.T, fn object.Object, args []object.Object, kwargs map[string]object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		return callFunction(t, fn, nil, args, kwargs)
+	case *object.Method:
+		return callFunction(t, fn.Fn, fn.Receiver, args, kwargs)
+	case *object.Struct:
+		return construct(t, fn, args, kwargs)
+	case *object.Builtin:
+		if len(kwargs) > 0 {
+			return object.NewError(t, "builtin %q does not accept named arguments", fn.Name)
+		}
+		return applyBuiltin(t, fn, args)
+	}
+	return object.NewError(t, "not a function: %s", fn.Type())
+}
+
+// callFunction calls fn, receiver is nil unless fn is a method.
+// Calling a generator returns an iterator and calling an async
+// function returns a future, both without evaluating fn.
+func callFunction(t token.T, fn *object.Function, receiver object.Object, args []object.Object, kwargs map[string]object.Object) object.Object {
+	switch {
+	case fn.Node.Generator:
+		return generator(t, fn, receiver, args, kwargs)
+	case fn.Node.Async:
+		return async(t, fn, receiver, args, kwargs)
+	}
+	return evalBody(t, fn, receiver, args, kwargs)
+}
+
+// evalBody binds args and evaluates the body of fn. A call in tail
+// position is made once the body is left, in place of the call of fn,
+// so tail recursion runs in constant stack space. The stack of an
+// error does not hold the calls replaced by tail calls.
+func evalBody(t token.T, fn *object.Function, receiver object.Object, args []object.Object, kwargs map[string]object.Object) object.Object {
+	// at is the call of fn or the tail call which replaced it
+	at := t
+	for {
+		env, err := bindArguments(at, fn, receiver, args, kwargs)
+		if err != nil {
+			if at != t {
+				err.Stack = append(err.Stack, t)
+			}
+			return err
+		}
+		result := evalStatements(fn.Node.Body.Statements, env)
+		if tc, ok := result.(*tailCall); ok {
+			if next, recv, ok := tailCallee(tc.fn); ok {
+				fn, receiver, args, kwargs, at = next, recv, tc.args, tc.kwargs, tc.t
+				continue
+			}
+			result = applyFunction(tc.t, tc.fn, tc.args, tc.kwargs)
+			if _, ok := result.(*object.Error); !ok {
+				return result
+			}
+		}
+		if r, ok := result.(*object.Return); ok {
+			return r.Value
+		}
+		if err, ok := result.(*object.Error); ok {
+			err.Stack = append(err.Stack, t)
+			return err
+		}
+		return object.Nil
+	}
+}
+
+// tailCall is the result of a return statement whose value is a call
+// in tail position. It propagates up like a return and the call is
+// made by evalBody once the frame of the returning function is left.
+type tailCall struct {
+	t      token.T
+	fn     object.Object
+	args   []object.Object
+	kwargs map[string]object.Object
+}
+
+func (tc *tailCall) Type() object.Type { return object.RETURN }
+func (tc *tailCall) String() string    { return "<tail call>" }
+
+// tailCallee returns the function a tail call of callee evaluates,
+// ok is false unless callee evaluates its body when called
+func tailCallee(callee object.Object) (fn *object.Function, receiver object.Object, ok bool) {
+	switch callee := callee.(type) {
+	case *object.Function:
+		fn = callee
+	case *object.Method:
+		fn, receiver = callee.Fn, callee.Receiver
+	default:
+		return nil, nil, false
+	}
+	return fn, receiver, !fn.Node.Generator && !fn.Node.Async
+}
+
+// generator returns an iterator over the values yielded by fn. The
+// iterator is single-use: the first iteration binds args in a new
+// frame and evaluates the body of fn until it returns, raises an error
+// or the consumer stops, every later iteration yields nothing.
+func generator(t token.T, fn *object.Function, receiver object.Object, args []object.Object, kwargs map[string]object.Object) object.Object {
+	name := "generator"
+	if fn.Node.Name != nil {
+		name += " " + fn.Node.Name.Value
+	}
+	started := false
+	return object.FromSeq(name, func(yield func(object.Object) bool) {
+		if started {
+			return
+		}
+		started = true
+		done := false
+		next := func(val object.Object) bool {
+			// a finally block may yield after the consumer stopped
+			done = done || !yield(val)
+			return !done
+		}
+		genFn := &object.Function{Node: fn.Node, Env: object.NewGenerator(fn.Env, next)}
+		result := evalBody(t, genFn, receiver, args, kwargs)
+		if err, ok := result.(*object.Error); ok && !done {
+			yield(err)
+		}
+	})
+}
+
+// async returns a future of the result of fn, which is evaluated
+// in a new coroutine of the event loop of the program
+func async(t token.T, fn *object.Function, receiver object.Object, args []object.Object, kwargs map[string]object.Object) object.Object {
+	name := "async"
+	if fn.Node.Name != nil {
+		name += " " + fn.Node.Name.Value
+	}
+	return fn.Env.StartLoop().Go(t, name, func(co *object.Coroutine) object.Object {
+		asyncFn := &object.Function{Node: fn.Node, Env: object.NewCoroutine(fn.Env, co)}
+		return evalBody(t, asyncFn, receiver, args, kwargs)
+	})
+}
+
+// applyBuiltin calls the native function fn. A Go error returned
+// or a panic raised by fn is surfaced as a catchable runtime error.
+func applyBuiltin(t token.T, fn *object.Builtin, args []object.Object) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = object.NewError(t, "builtin %q panicked: %v", fn.Name, r)
+		}
+	}()
+	call := func(callee object.Object, args ...object.Object) object.Object {
+		return applyFunction(t, callee, args, nil)
+	}
+	result, err := fn.Fn(call, args...)
+	if err != nil {
+		return object.NewError(t, "%s", err)
+	}
+	if result == nil {
+		return object.Nil
+	}
+	return result
+}
+
+// bindArguments creates the frame for a call to fn, enclosed by the
+// environment fn was defined in. Defaults are evaluated in the new frame
+// so they may refer to preceding parameters and the receiver of a method.
+func bindArguments(t token.T, fn *object.Function, receiver object.Object, args []object.Object, kwargs map[string]object.Object) (*object.Environment, *object.Error) {
+	env := object.NewEnclosed(fn.Env)
+	if fn.Node.Receiver != nil {
+		env.Declare(fn.Node.Receiver.Name.Value, receiver, false)
+	}
+	params := fn.Node.Parameters
+	if len(args) > len(params) && fn.Node.Rest == nil {
+		return nil, object.NewError(t, "too many arguments, want=%d, got=%d", len(params), len(args))
+	}
+	for name := range kwargs {
+		if !hasParameter(params, name) {
+			return nil, object.NewError(t, "unknown named argument %q", name)
+		}
+	}
+	for i, param := range params {
+		name := param.Name.Value
+		val, named := kwargs[name]
+		switch {
+		case i < len(args) && named:
+			return nil, object.NewError(t, "argument %q given both by position and by name", name)
+		case i < len(args):
+			val = args[i]
+		case named:
+		case param.Default != nil:
+			val = Eval(param.Default, env)
+			switch val := val.(type) {
+			case *object.Error:
+				return nil, val
+			case *object.Return:
+				return nil, object.NewError(param.Name.Token, "cannot propagate from default value of %q", name)
+			}
+		default:
+			return nil, object.NewError(t, "missing argument %q", name)
+		}
+		if !env.Declare(name, val, false) {
+			return nil, object.NewError(param.Name.Token, "duplicate parameter %q", name)
+		}
+	}
+	if fn.Node.Rest != nil {
+		rest := &object.Array{}
+		if len(args) > len(params) {
+			rest.Elements = append(rest.Elements, args[len(params):]...)
+		}
+		if !env.Declare(fn.Node.Rest.Value, rest, false) {
+			return nil, object.NewError(fn.Node.Rest.Token, "duplicate parameter %q", fn.Node.Rest.Value)
+		}
+	}
+	return env, nil
+}
+
+func hasParameter(params []*ast.Parameter, name string) bool {
+	for _, param := range params {
+		if param.Name.Value == name {
+			return true
+		}
+	}
+	return false
+}
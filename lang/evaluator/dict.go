@@ -0,0 +1,37 @@
+package evaluator
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// evalDict creates a dict from the pairs of node in order,
+// a key given twice holds the last of its values
+func evalDict(node *ast.Dict, env *object.Environment) object.Object {
+	dict := object.NewDict()
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isAbrupt(key) {
+			return key
+		}
+		s, ok := key.(*object.String)
+		if !ok {
+			return object.NewError(node.Token, "dict key must be a STRING, got %s", key.Type())
+		}
+		val := Eval(pair.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		dict.Set(s.Value, val)
+	}
+	return dict
+}
+
+// dictGet returns the value of key in dict, errors are reported at t
+func dictGet(t token.T, dict *object.Dict, key string) object.Object {
+	if val, ok := dict.Get(key); ok {
+		return val
+	}
+	return object.NewError(t, "%s has no key %q", object.DICT, key)
+}
@@ -0,0 +1,387 @@
+package evaluator
+
+import (
+	"slices"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// Eval evaluates node in env and returns the resulting object.
+// Runtime errors are returned as *object.Error.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		if node.Expression == nil {
+			return object.Nil
+		}
+		return Eval(node.Expression, env)
+	case *ast.AssignStatement:
+		return evalAssignStatement(node, env)
+	case *ast.BlockStatement:
+		return evalStatements(node.Statements, object.NewEnclosed(env))
+	case *ast.ReturnStatement:
+		return evalReturnStatement(node, env)
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+	case *ast.YieldStatement:
+		return evalYieldStatement(node, env)
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+	case *ast.StructStatement:
+		return evalStructStatement(node, env)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.SelectStatement:
+		return evalSelectStatement(node, env)
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.Number:
+		return &object.Number{Value: node.Value}
+	case *ast.String:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return object.Bool(node.Value)
+	case *ast.Null:
+		return object.Nil
+	case *ast.Array:
+		elements, err := evalExpressions(node.Elements, env)
+		if err != nil {
+			return err
+		}
+		return &object.Array{Elements: elements}
+	case *ast.Dict:
+		return evalDict(node, env)
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return evalPrefixExpression(node, right)
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		if node.Operator == "??" && left.Type() != object.NULL {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return evalInfixExpression(node, left, right)
+	case *ast.PropagateExpression:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return evalPropagateExpression(node, val)
+	case *ast.TernaryExpression:
+		cond := Eval(node.Condition, env)
+		if isAbrupt(cond) {
+			return cond
+		}
+		if isTruthy(cond) {
+			return Eval(node.Consequence, env)
+		}
+		return Eval(node.Alternative, env)
+	case *ast.MemberExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		return evalMemberExpression(node, left, env)
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		if node.Optional && left.Type() == object.NULL {
+			return object.Nil
+		}
+		index := Eval(node.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		return evalIndexExpression(node, left, index)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+	case *ast.RangeExpression:
+		return evalRangeExpression(node, env)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+	case *ast.ForExpression:
+		return evalForExpression(node, env)
+	case *ast.Function:
+		return evalFunction(node, env)
+	case *ast.CallExpression:
+		return evalCallExpression(node, env)
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+	case *ast.AwaitExpression:
+		return evalAwaitExpression(node, env)
+	}
+	return object.Nil
+}
+
+// evalProgram evaluates all statements in the global frame env and
+// unwraps the value of a top-level return. If the program called async
+// functions or spawned tasks, it waits for them and fails if any of
+// them failed.
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	if rt := env.Runtime(); rt != nil {
+		// a program evaluated before in env released the lock
+		rt.Acquire()
+	}
+	result := evalStatements(program.Statements, env)
+	if r, ok := result.(*object.Return); ok {
+		result = r.Value
+	}
+	if loop := env.Loop(); loop != nil {
+		if err := loop.Run(); err != nil && result.Type() != object.ERROR {
+			result = err
+		}
+	}
+	if rt := env.Runtime(); rt != nil {
+		err := rt.Wait()
+		rt.Release()
+		if err != nil && result.Type() != object.ERROR {
+			return err
+		}
+	}
+	return result
+}
+
+// evalStatements evaluates statements in env, stopping early
+// at a return or an error which is passed on to the caller
+func evalStatements(statements []ast.Statement, env *object.Environment) object.Object {
+	var result object.Object = object.Nil
+	for _, stmt := range statements {
+		result = Eval(stmt, env)
+		switch result.Type() {
+		case object.RETURN, object.ERROR:
+			return result
+		}
+	}
+	return result
+}
+
+// evalIfExpression evaluates the body of the first branch whose
+// condition is truthy, or the else block if there is none
+func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
+	branches := append([]ast.Conditional{node.If}, node.Elifs...)
+	for _, branch := range branches {
+		cond := Eval(branch.Condition, env)
+		if isAbrupt(cond) {
+			return cond
+		}
+		if isTruthy(cond) {
+			return Eval(branch.Body, env)
+		}
+	}
+	if node.Else != nil {
+		return Eval(node.Else, env)
+	}
+	return object.Nil
+}
+
+func evalAssignStatement(node *ast.AssignStatement, env *object.Environment) object.Object {
+	val := Eval(node.Right, env)
+	if isAbrupt(val) {
+		return val
+	}
+	name := node.Left.Value
+	switch node.Token.Type {
+	case token.LET, token.CONST:
+		if !env.Declare(name, val, node.Token.Type == token.CONST) {
+			return object.NewError(node.Left.Token, "%q is already declared in this scope", name)
+		}
+	default:
+		if b, ok := env.Assign(name, val); !ok {
+			if b == nil {
+				return object.NewError(node.Left.Token, "assignment to undeclared identifier %q", name)
+			}
+			return object.NewError(node.Left.Token, "assignment to constant %q", name)
+		}
+	}
+	return object.Nil
+}
+
+// evalImportStatement checks that the alias of node is bound. Imported
+// modules are bound by the loader before the importing module is
+// evaluated, so import statements have no effect of their own.
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Alias.Value); ok && val.Type() == object.MODULE {
+		return object.Nil
+	}
+	return object.NewError(node.Token, "cannot import %q without a module loader", node.Path.Value)
+}
+
+func evalReturnStatement(node *ast.ReturnStatement, env *object.Environment) object.Object {
+	if node.ReturnValue == nil {
+		return &object.Return{Value: object.Nil}
+	}
+	if call, ok := node.ReturnValue.(*ast.CallExpression); ok && call.Tail {
+		callee, args, kwargs, err := evalCall(call, env)
+		if err != nil {
+			return err
+		}
+		return &tailCall{t: call.Token, fn: callee, args: args, kwargs: kwargs}
+	}
+	val := Eval(node.ReturnValue, env)
+	if isAbrupt(val) {
+		return val
+	}
+	return &object.Return{Value: val}
+}
+
+// evalYieldStatement passes a value to the consumer of the generator.
+// If the consumer stopped, the generator returns to end the iteration.
+func evalYieldStatement(node *ast.YieldStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	if !env.Yield(val) {
+		return &object.Return{Value: object.Nil}
+	}
+	return object.Nil
+}
+
+// evalAwaitExpression returns the value of a future, a rejected
+// future raises its error at the await expression
+func evalAwaitExpression(node *ast.AwaitExpression, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	future, ok := val.(*object.Future)
+	if !ok {
+		return object.NewError(node.Token, "await requires a FUTURE, got %s", val.Type())
+	}
+	result, err := env.StartLoop().Await(future, env.Coroutine())
+	if err != nil {
+		return object.NewError(node.Token, "%s", err)
+	}
+	if err, ok := result.(*object.Error); ok {
+		// a future may be awaited more than once
+		raised := *err
+		if raised.Token.Line == 0 {
+			// rejected by a host function
+			raised.Token = node.Token
+		} else {
+			raised.Stack = append(slices.Clip(err.Stack), node.Token)
+		}
+		return &raised
+	}
+	return result
+}
+
+func evalThrowStatement(node *ast.ThrowStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	return &object.Error{Token: node.Token, Msg: val.String(), Value: val}
+}
+
+// evalTryStatement evaluates the try block and, if it raised an error,
+// the catch block with the error bound to the catch parameter. The
+// finally block is always evaluated last and a return or error from
+// it takes precedence over the result of the try or catch blocks.
+func evalTryStatement(node *ast.TryStatement, env *object.Environment) object.Object {
+	result := Eval(node.Body, env)
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := object.NewEnclosed(env)
+		if node.Catch.Param != nil {
+			catchEnv.Declare(node.Catch.Param.Value, caught(err), false)
+		}
+		result = evalStatements(node.Catch.Body.Statements, catchEnv)
+	}
+	if node.Finally != nil {
+		finally := Eval(node.Finally, env)
+		switch finally.Type() {
+		case object.RETURN, object.ERROR:
+			return finally
+		}
+	}
+	return result
+}
+
+// caught returns the value a catch parameter is bound to, which is
+// the thrown value or the message of an error raised by the runtime
+func caught(err *object.Error) object.Object {
+	if err.Value != nil {
+		return err.Value
+	}
+	return &object.String{Value: err.Msg}
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if builtin, ok := object.Builtins[node.Value]; ok {
+		return builtin
+	}
+	return object.NewError(node.Token, "identifier not found: %q", node.Value)
+}
+
+// evalExpressions evaluates expressions in order, expanding any
+// spread array elements, and returns the first error encountered
+func evalExpressions(expressions []ast.Expression, env *object.Environment) ([]object.Object, object.Object) {
+	var result []object.Object
+	for _, e := range expressions {
+		if spread, ok := e.(*ast.Spread); ok {
+			val := Eval(spread.Value, env)
+			if isAbrupt(val) {
+				return nil, val
+			}
+			if arr, ok := val.(*object.Array); ok {
+				result = append(result, arr.Elements...)
+				continue
+			}
+			if _, ok := val.(*object.Iterator); !ok {
+				return nil, object.NewError(spread.Token, "cannot spread %s", val.Type())
+			}
+			if err := iterate(spread.Token, val, func(el object.Object) bool {
+				result = append(result, el)
+				return true
+			}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		val := Eval(e, env)
+		if isAbrupt(val) {
+			return nil, val
+		}
+		result = append(result, val)
+	}
+	return result, nil
+}
+
+// isTruthy returns false for false and null, true otherwise
+func isTruthy(obj object.Object) bool {
+	return object.Truthy(obj)
+}
+
+// isAbrupt reports whether obj interrupts evaluation, which is
+// an error or a return propagated by a ? expression, and must
+// be passed on to the caller unchanged
+func isAbrupt(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.ERROR, object.RETURN:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,1059 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/parser"
+)
+
+func TestEvalNumberExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"5", 5},
+		{"-5", -5},
+		{"2.5 * 2", 5},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"let x = 5; x * 2", 10},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("number-expression-%d", i))
+		testNumberObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"!true", false},
+		{"!!5", true},
+		{"1 < 2", true},
+		{"1 >= 2", false},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"(1 < 2) == true", true},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("boolean-expression-%d", i))
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{
+			// counter captures n by reference
+			`fn counter() {
+				let n = 0;
+				return fn() { n = n + 1; return n; };
+			}
+			const next = counter();
+			next(); next();
+			next()`,
+			3,
+		},
+		{
+			// each call of a factory gets its own frame
+			`fn counter() {
+				let n = 0;
+				return fn() { n = n + 1; return n; };
+			}
+			const a = counter();
+			const b = counter();
+			a(); a(); b();
+			a() * 10 + b()`,
+			32,
+		},
+		{
+			// closures created in the same frame share bindings
+			`fn pair() {
+				let n = 0;
+				return [fn() { n = n + 1; }, fn() { return n; }];
+			}
+			const p = pair();
+			const inc = p[0];
+			inc(); inc();
+			p[1]()`,
+			2,
+		},
+		{
+			// nested closures see every enclosing frame
+			`fn adder(a) {
+				return fn(b) {
+					return fn(c) { return a + b + c; };
+				};
+			}
+			adder(1)(10)(100)`,
+			111,
+		},
+		{
+			// assignment in a nested closure updates the outermost binding
+			`let total = 0;
+			fn outer() {
+				return fn() {
+					return fn() { total = total + 5; };
+				};
+			}
+			outer()()();
+			outer()()();
+			total`,
+			10,
+		},
+		{
+			// captured after declaration, so later updates are visible
+			`let x = 1;
+			const get = fn() { return x; };
+			x = 42;
+			get()`,
+			42,
+		},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("closure-%d", i))
+		testNumberObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestShadowing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"let x = 1; { let x = 2; } x", 1},
+		{"let x = 1; { let x = 2; { x = 3; } } x", 1},
+		{"let x = 1; { x = 2; } x", 2},
+		{"let x = 1; { let y = 2; { let x = 10; x = x + y; } x = x + y; } x", 3},
+		{"let x = 1; const f = fn(x) { return x; }; f(5) + x", 6},
+		{
+			`let x = 1;
+			const f = fn() {
+				let x = 2;
+				return fn() { let x = 3; return x; }() * 10 + x;
+			};
+			f() * 10 + x`,
+			321,
+		},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("shadowing-%d", i))
+		testNumberObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestCallArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn f(a, b = 2) { return [a, b]; } f(1)", "[1, 2]"},
+		{"fn f(a, b = a * 2) { return [a, b]; } f(3)", "[3, 6]"},
+		{"fn f(a, b = 2, c = 3) { return [a, b, c]; } f(1, c: 30)", "[1, 2, 30]"},
+		{"fn f(a, b) { return [a, b]; } f(b: 1, a: 2)", "[2, 1]"},
+		{"fn f(a, ...rest) { return rest; } f(1, 2, 3)", "[2, 3]"},
+		{"fn f(a, ...rest) { return rest; } f(1)", "[]"},
+		{"fn f(a, b, c) { return [a, b, c]; } const xs = [2, 3]; f(1, ...xs)", "[1, 2, 3]"},
+		{"const a = [1]; const b = [3]; [...a, 2, ...b]", "[1, 2, 3]"},
+		{`len("four") + len([1, 2])`, "6"},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("call-arguments-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar", `identifier not found: "foobar"`},
+		{"const x = 1; x = 2;", `assignment to constant "x"`},
+		{"x = 2;", `assignment to undeclared identifier "x"`},
+		{"let x = 1; let x = 2;", `"x" is already declared in this scope`},
+		{"5 + true", "unknown operator: NUMBER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"1 / 0", "division by zero"},
+		{"[1, 2][2]", "index 2 out of range [0:2]"},
+		{"fn f(a) { } f()", `missing argument "a"`},
+		{"fn f(a) { } f(1, 2)", "too many arguments, want=1, got=2"},
+		{"fn f(a) { } f(1, a: 2)", `argument "a" given both by position and by name`},
+		{"fn f(a) { } f(b: 2)", `unknown named argument "b"`},
+		{"len(1)", "argument to len not supported, got NUMBER"},
+		{"const f = fn() { const c = 1; return fn() { c = 2; }; }; f()()", `assignment to constant "c"`},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("error-handling-%d", i))
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if err.Msg != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, err.Msg)
+		}
+		if !strings.HasPrefix(err.String(), "RuntimeError: ") {
+			t.Errorf("wrong error format. got=%q", err.String())
+		}
+	}
+}
+
+func TestTryCatchFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let r = 0; try { throw 42; } catch e { r = e; } r", "42"},
+		{`let r = ""; try { 1 / 0; } catch e { r = e; } r`, "division by zero"},
+		{`let r = ""; try { len(1); } catch e { r = e; } r`, "argument to len not supported, got NUMBER"},
+		{"let r = 0; try { throw 1; } catch { r = 3; } r", "3"},
+		{"let r = 0; try { r = 1; } catch e { r = 2; } r", "1"},
+		{"let x = 0; try { x = 1; } finally { x = x * 10; } x", "10"},
+		{"let x = 0; try { try { throw 1; } finally { x = 5; } } catch e { x = x + e; } x", "6"},
+		{"let x = 0; try { throw 1; } catch e { throw e + 1; } finally { x = 1; }", "RuntimeError: 2 at L1:C39"},
+		{"let x = 0; fn f() { try { return 1; } finally { x = 2; } } f() * 10 + x", "12"},
+		{"fn f() { try { throw 1; } finally { return 2; } } f()", "2"},
+		{"fn f() { try { return 1; } catch e { return 2; } } f()", "1"},
+		{
+			`fn fail(msg) { throw msg; }
+			fn wrap() { return fn() { return fail("inner"); }; }
+			let r = "";
+			try { wrap()(); } catch e { r = "caught " + e; }
+			r`,
+			"caught inner",
+		},
+		{"let e = 1; try { throw 2; } catch e { e = e + 1; } e", "1"},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("try-catch-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `fn a() {
+	throw "boom";
+}
+fn b() {
+	a();
+}
+b();`
+	evaluated := testEval(t, input, "stack-trace")
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if err.Msg != "boom" || err.Token.Line != 2 {
+		t.Errorf("unexpected error, got=%q at line %d", err.Msg, err.Token.Line)
+	}
+	if s, ok := err.Value.(*object.String); !ok || s.Value != "boom" {
+		t.Errorf("unexpected thrown value, got=%v", err.Value)
+	}
+	wantLines := []int{5, 7}
+	if len(err.Stack) != len(wantLines) {
+		t.Fatalf("wrong stack depth, want=%d, got=%d", len(wantLines), len(err.Stack))
+	}
+	for i, line := range wantLines {
+		if err.Stack[i].Line != line {
+			t.Errorf("stack[%d] wrong line, want=%d, got=%d", i, line, err.Stack[i].Line)
+		}
+	}
+	want := "RuntimeError: boom at L2:C2\n\tcalled at L5:C3\n\tcalled at L7:C2"
+	if err.String() != want {
+		t.Errorf("unexpected error string\nwant=%q\ngot=%q", want, err.String())
+	}
+}
+
+// TestTailCalls recurses deeper than the Go stack allows
+// without tail calls running in constant stack space
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`fn count(n, acc) {
+				if n == 0 {
+					return acc;
+				}
+				return count(n - 1, acc + 1);
+			}
+			count(1000000, 0)`,
+			"1000000",
+		},
+		{
+			`fn even(n) {
+				if n == 0 { return true; } elif n == 1 { return false; } else { return odd(n - 1); }
+			}
+			fn odd(n) {
+				if n == 0 { return false; } else { { return even(n - 1); } }
+			}
+			[even(200000), odd(200001)]`,
+			"[true, true]",
+		},
+		{
+			`struct C { n }
+			fn (c C) loop(k) { if k == 0 { return c.n; } return c.loop(k - 1); }
+			C(7).loop(200000)`,
+			"7",
+		},
+		{"fn f(xs, n) { if n == 0 { return len(xs); } return f([xs], n - 1); } f([], 3)", "1"},
+		{"fn f(a, b = a * 2) { return [a, b]; } fn g(a) { return f(a); } g(2)", "[2, 4]"},
+		{"fn f(n) { if n == 0 { return 1; } return f(n - 1, b: 2); } f(2)", `RuntimeError: unknown named argument "b" at L1:C43` + "\n\tcalled at L1:C61"},
+		{"fn g() { yield 1; yield 2; } fn f() { return g(); } [...f()]", "[1, 2]"},
+		// the finally block runs after the call
+		{"let x = 0; fn g() { return x; } fn f() { try { return g(); } finally { x = 1; } } [f(), x]", "[0, 1]"},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("tail-call-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestTailCallStackTrace(t *testing.T) {
+	input := `fn a() {
+	throw "boom";
+}
+fn b() {
+	return a();
+}
+b();`
+	evaluated := testEval(t, input, "tail-call-stack-trace")
+	want := "RuntimeError: boom at L2:C2\n\tcalled at L7:C2"
+	if evaluated.String() != want {
+		t.Errorf("unexpected error string\nwant=%q\ngot=%q", want, evaluated.String())
+	}
+}
+
+func TestBuiltinErrorsAreCatchable(t *testing.T) {
+	object.Builtins["explode"] = &object.Builtin{
+		Name: "explode",
+		Fn: func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			panic("kaboom")
+		},
+	}
+	defer delete(object.Builtins, "explode")
+	input := `let r = ""; try { explode(); } catch e { r = e; } r`
+	evaluated := testEval(t, input, "builtin-panic")
+	want := `builtin "explode" panicked: kaboom`
+	if evaluated.String() != want {
+		t.Errorf("unexpected result, want=%q, got=%q", want, evaluated.String())
+	}
+}
+
+func TestResultPropagation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ok(1)", "ok(1)"},
+		{`err("failed")`, `err(failed)`},
+		{"ok()", "ok(null)"},
+		{"fn f() { return ok(1)? + 1; } f()", "2"},
+		{`fn f() { return err("failed")? + 1; } f()`, "err(failed)"},
+		{
+			`fn parse(ok_) { return ok_; }
+			fn sum(a, b) { return ok(parse(a)? + parse(b)?); }
+			[sum(ok(1), ok(2)), sum(ok(1), err("bad b")), sum(err("bad a"), err("bad b"))]`,
+			"[ok(3), err(bad b), err(bad a)]",
+		},
+		{
+			// propagation only leaves the innermost function
+			`fn inner() { let x = err(1)?; return ok(x); }
+			fn outer() { const r = inner(); return ok([r]); }
+			outer()`,
+			"ok([err(1)])",
+		},
+		{"let x = 0; fn f() { x = err(2)?; } f(); x", "0"},
+		{"fn f() { [1, err(3)?]; return 1; } f()", "err(3)"},
+		{"ok(1) == ok(1)", "true"},
+		{"ok(1) == err(1)", "false"},
+		{"1?", "RuntimeError: ? applied to non-result NUMBER at L1:C2"},
+		{"fn f(a = err(1)?) { } f()", `RuntimeError: cannot propagate from default value of "a" at L1:C6`},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("result-propagation-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestConditionalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"true ? 1 : 2", "1"},
+		{"null ? 1 : 2", "2"},
+		{"1 > 2 ? 1 : 2 > 1 ? 3 : 4", "3"},
+		{"let x = 0; fn set() { x = 1; } false ? set() : 2; x", "0"},
+		{"null ?? 5", "5"},
+		{"0 ?? 5", "0"},
+		{"false ?? 5", "false"},
+		{"null ?? null ?? 3", "3"},
+		{"let xs = null; xs?[0] ?? 7", "7"},
+		{"let xs = [4]; xs?[0] ?? 7", "4"},
+		{"let o = null; o?.name ?? \"none\"", "none"},
+		{"fn f() { return 1; } f() ?? g()", "1"},
+		{"1?.name", "RuntimeError: member access not supported: NUMBER at L1:C2"},
+		{"foo ? 1 : 2", `RuntimeError: identifier not found: "foo" at L1:C1`},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("conditional-operator-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestIfExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if true { 10 }", "10"},
+		{"if false { 10 }", "null"},
+		{"if 1 < 2 { 10 } else { 20 }", "10"},
+		{"if null { 10 } else { 20 }", "20"},
+		{"let x = 3; if x < 2 { 1 } elif x < 4 { 2 } elif x < 6 { 3 } else { 4 }", "2"},
+		{"let x = 9; if x < 2 { 1 } elif x < 4 { 2 } else { 4 }", "4"},
+		{"let x = 1; if true { let x = 2; } x", "1"},
+		{"fn sign(n) { if n < 0 { return -1; } elif n == 0 { return 0; } return 1; } [sign(-5), sign(0), sign(5)]", "[-1, 0, 1]"},
+		{"const v = if 2 > 1 { \"yes\" } else { \"no\" }; v", "yes"},
+		{"if y { 1 }", `RuntimeError: identifier not found: "y" at L1:C4`},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("if-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3] |> len", "3"},
+		{"fn add(a, b) { return a + b; } 1 |> add(2) |> add(3)", "6"},
+		{"fn sub(a, b) { return a - b; } 10 |> sub(3)", "7"},
+		{"fn wrap(x, ...rest) { return [x, ...rest]; } 1 |> wrap(2, 3)", "[1, 2, 3]"},
+		{"fn f(a, b = 2) { return a * b; } 3 |> f(b: 5)", "15"},
+		{"fn adder(n) { return fn(x) { return x + n; }; } 1 |> adder(10)()", "11"},
+		{"1 |> 2", "RuntimeError: not a function: NUMBER at L1:C3"},
+		{"fn f() { } 1 |>\nf()", "RuntimeError: too many arguments, want=0, got=1 at L1:C14"},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("pipeline-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestRangesAndForLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0..10", "0..10"},
+		{"0..=10 step 2", "0..=10 step 2"},
+		{"let s = 0; for let i = 0..5 { s = s + i; } s", "10"},
+		{"let s = 0; for let i = 0..=5 { s = s + i; } s", "15"},
+		{"let s = 0; for let i = 0..10 step 3 { s = s + i; } s", "18"},
+		{"let s = 0; for let i = 5..0 step -2 { s = s * 10 + i; } s", "531"},
+		{"let s = 0; for let i = 5..=1 step -2 { s = s * 10 + i; } s", "531"},
+		{"let s = 0; for let i = 5..0 { s = s + 1; } s", "0"},
+		{"let s = 0; for let x = [1, 2, 3] { s = s * 10 + x; } s", "123"},
+		{`let s = ""; for let c = "abc" { s = c + s; } s`, "cba"},
+		{"let n = 3; let s = 0; for let i = 0..n * 2 { s = s + 1; } s", "6"},
+		{"fn first(xs) { for let x = xs { return x; } return null; } first([7, 8])", "7"},
+		{
+			`let fs = [];
+			let s = 0;
+			for let i = 0..3 { fs = [...fs, fn() { return i; }]; }
+			for let f = fs { s = s * 10 + f(); }
+			s`,
+			"12",
+		},
+		{"[1, 2, 3, 4, 5][1..3]", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][1..=3]", "[2, 3, 4]"},
+		{"[1, 2, 3, 4, 5][..2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3..]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][.. step 2]", "[1, 3, 5]"},
+		{`"hello world"[..5]`, "hello"},
+		{`"hello world"[6..]`, "world"},
+		{`"hello"[1..1]`, ""},
+		{"for let i = 0.. { }", "RuntimeError: cannot iterate over unbounded range 0.. at L1:C5"},
+		{"for let i = 5 { }", "RuntimeError: cannot iterate over NUMBER at L1:C5"},
+		{"0..10 step 0", "RuntimeError: range step cannot be zero at L1:C2"},
+		{"0..1.5", "RuntimeError: range bound must be an integer, got 1.5 at L1:C2"},
+		{"[1, 2][1..3]", "RuntimeError: slice bounds out of range [1..3] with length 2 at L1:C7"},
+		{"[1, 2, 3][.. step -1]", "[3, 2, 1]"},
+		{"[1, 2, 3][-2..]", "[2, 3]"},
+		{"for const i = 0..2 { i = 1; }", `RuntimeError: assignment to constant "i" at L1:C22`},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("range-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:]", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][::2]", "[1, 3, 5]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:-1]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4, 5][::-1]", "[5, 4, 3, 2, 1]"},
+		{"[1, 2, 3, 4, 5][3:0:-1]", "[4, 3, 2]"},
+		{"[1, 2, 3, 4, 5][-1:-4:-2]", "[5, 3]"},
+		{"[1, 2, 3, 4, 5][3:1]", "[]"},
+		{"[][:]", "[]"},
+		{"[][::-1]", "[]"},
+		{`"hello world"[:5]`, "hello"},
+		{`"hello world"[-5:]`, "world"},
+		{`"hello"[::-1]`, "olleh"},
+		{`"hello"[1:-1:2]`, "el"},
+		{"let a = [1, 2, 3]; let n = 1; a[n:n + 1]", "[2]"},
+		{"let a = null; a?[1:]", "null"},
+		{"[1, 2][1:3]", "RuntimeError: slice bounds out of range [1:3:1] with length 2 at L1:C7"},
+		{"[1, 2][-3:]", "RuntimeError: slice bounds out of range [-3::1] with length 2 at L1:C7"},
+		{"[1, 2][2::-1]", "RuntimeError: slice bounds out of range [2::-1] with length 2 at L1:C7"},
+		{`"ab"[::0]`, "RuntimeError: slice step cannot be zero at L1:C5"},
+		{"[1][0.5:]", "RuntimeError: slice index must be an integer, got 0.5 at L1:C4"},
+		{"5[1:]", "RuntimeError: slice operator not supported: NUMBER at L1:C2"},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("slice-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y } Point(1, 2)", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y } Point(y: 2, x: 1)", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y } Point(1, y: 2).y", "2"},
+		{"struct Point { x, y } Point", "struct Point { x, y }"},
+		{"struct Empty {} Empty()", "Empty{}"},
+		{
+			`struct Point { x, y }
+			fn (p Point) add(o) { return Point(p.x + o.x, p.y + o.y); }
+			fn (p Point) len() { return p.x + p.y; }
+			Point(1, 2).add(Point(3, 4)).len()`,
+			"10",
+		},
+		{
+			`struct Counter { n }
+			fn (c Counter) next(by = c.n) { return Counter(c.n + by); }
+			Counter(1).next().next(5)`,
+			"Counter{n: 7}",
+		},
+		{
+			`struct Point { x, y }
+			let p = Point(1, 2);
+			fn (p Point) sum() { return p.x + p.y; }
+			const f = p.sum;
+			f()`,
+			"3",
+		},
+		{"struct P { x } let a = P(1); let b = a; a == b", "true"},
+		{"struct P { x } P(1) == P(1)", "false"},
+		{"struct P { x } let p = null; p?.x", "null"},
+		{"struct P { x } P(1).y", `RuntimeError: P has no field or method "y" at L1:C21`},
+		{"struct P { x } P(1, 2)", "RuntimeError: too many arguments to P, want=1, got=2 at L1:C17"},
+		{"struct P { x, y } P(1)", `RuntimeError: missing field "y" of P at L1:C20`},
+		{"struct P { x } P(z: 1)", `RuntimeError: P has no field "z" at L1:C17`},
+		{"struct P { x } P(1, x: 1)", `RuntimeError: field "x" given both by position and by name at L1:C17`},
+		{"struct P { x } P = 1", `RuntimeError: assignment to constant "P" at L1:C16`},
+		{"let P = 1; fn (p P) f() {}", `RuntimeError: "P" is not a struct, got NUMBER at L1:C18`},
+		{"struct P { x } fn (p P) x() {}", `RuntimeError: method "x" conflicts with field of P at L1:C25`},
+		{"struct P { x } fn (p P) f() {} fn (p P) f() {}", `RuntimeError: method "f" is already declared on P at L1:C41`},
+		{"1.x", "RuntimeError: member access not supported: NUMBER at L1:C2"},
+		{"export struct P { x } export const p = P(1); p.x", "1"},
+		{`import "m" as m;`, `RuntimeError: cannot import "m" without a module loader at L1:C1`},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("struct-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestDicts(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`({"a": 1, "b": [2, 3]})`, "{a: 1, b: [2, 3]}"},
+		{"const d = {}; [d, len(d)]", "[{}, 0]"},
+		{`const k = "b"; const d = {"a": 1, k: 2, "a": 3}; [d, len(d)]`, "[{a: 3, b: 2}, 2]"},
+		{`const d = {"x": 1, "y": 2}; d.x + d["y"]`, "3"},
+		{`const d = {"f": fn(x) { return x * 2; }}; d.f(21)`, "42"},
+		{`const d = {"a": {"b": "c"}}; d.a.b + d["a"]["b"]`, "cc"},
+		{`let d = null; d?.a`, "null"},
+		{`const d = {"a": 1}; d == d`, "true"},
+		{`let d = {"a": 1} == {"a": 1}; d`, "false"},
+		{`let r = []; for const x = [1, 2] { r = [...r, {"x": x}]; } r`, "[{x: 1}, {x: 2}]"},
+		{`const d = {"a": 1}; d.b`, `RuntimeError: DICT has no key "b" at L1:C23`},
+		{`const d = {"a": 1}; d["b"]`, `RuntimeError: DICT has no key "b" at L1:C22`},
+		{`const d = {"a": 1}; d[0]`, "RuntimeError: dict key must be a STRING, got NUMBER at L1:C22"},
+		{`let d = {"a": 1, 2: 3};`, "RuntimeError: dict key must be a STRING, got NUMBER at L1:C9"},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("dict-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn gen() { yield 1; yield 2; } gen()", "<generator gen>"},
+		{"fn gen() { yield 1; yield 2; } [...gen()]", "[1, 2]"},
+		{"fn gen(n) { for let i = 0..n { yield i * i; } } [...gen(4)]", "[0, 1, 4, 9]"},
+		{"fn gen() { yield 1; return; yield 2; } [...gen()]", "[1]"},
+		{"const g = fn() { yield 1; }; [...g(), ...g()]", "[1, 1]"},
+		{"fn gen() { const inner = fn() { return 5; }; yield inner(); } [...gen()]", "[5]"},
+		{"fn outer() { fn inner() { yield 1; } return inner(); } [...outer()]", "[1]"},
+		{"fn gen() { let s = 0; for let x = [1, 2] { s = s + x; } return s; } gen()", "3"},
+		{
+			`fn count() { let n = 0; for let i = 0..1000000000 { yield i; } }
+			let s = 0;
+			for let x = take(count(), 5) { s = s + x; }
+			s`,
+			"10",
+		},
+		{
+			`fn gen() { try { yield 1; yield 2; } finally { yield 3; } }
+			[...take(gen(), 1)]`,
+			"[1]",
+		},
+		{
+			`struct R { lo, hi }
+			fn (r R) each() { for let i = r.lo..r.hi { yield i; } }
+			[...R(1, 4).each()]`,
+			"[1, 2, 3]",
+		},
+		{"[...map([1, 2, 3], fn(x) { return x * 10; })]", "[10, 20, 30]"},
+		{"[...filter(0..6, fn(x) { return x > 3; })]", "[4, 5]"},
+		{`[...map("ab", fn(c) { return c + c; })]`, `[aa, bb]`},
+		{"[...zip([1, 2, 3], 5..7)]", "[[1, 5], [2, 6]]"},
+		{"[...zip(0..3, map(0..3, fn(x) { return x * 10; }), [7, 8, 9])]", "[[0, 0, 7], [1, 10, 8], [2, 20, 9]]"},
+		{"[...take(map(0.., fn(x) { return x * 2; }), 3)]", "RuntimeError: cannot iterate over unbounded range 0.. at L1:C13"},
+		{"[...take(zip(0..1000000000, 0..1000000000), 2)]", "[[0, 0], [1, 1]]"},
+		{"[...take([1, 2], 0)]", "[]"},
+		{"const m = map([1, 2], fn(x) { return x + 1; }); [...m, ...m]", "[2, 3, 2, 3]"},
+		{"let s = 0; for let x = map(1..=3, fn(x) { return x * x; }) { s = s + x; } s", "14"},
+		{
+			`fn gen() { yield 1; throw "boom"; }
+			let r = [];
+			try { for let x = gen() { r = [...r, x]; } } catch e { r = [...r, e]; }
+			r`,
+			"[1, boom]",
+		},
+		{"fn gen(a) { yield a; } [...gen()]", `RuntimeError: missing argument "a" at L1:C31`},
+		{"[...map([1, 0], fn(x) { return 1 / x; })]", "RuntimeError: division by zero at L1:C34\n\tcalled at L1:C8"},
+		{"map([1], 2)", "RuntimeError: second argument to map must be a function, got NUMBER at L1:C4"},
+		{"take([1], -1)", "RuntimeError: second argument to take must be a non-negative integer, got -1 at L1:C5"},
+		{"zip([1])", "RuntimeError: wrong number of arguments to zip, want at least 2, got=1 at L1:C4"},
+		{"[...5]", "RuntimeError: cannot spread NUMBER at L1:C2"},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("generator-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+// TestGeneratorRunsOnce counts the runs of generator bodies,
+// ranging over a generator a second time must not run it again
+func TestGeneratorRunsOnce(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let runs = 0;
+			fn gen() { runs = runs + 1; yield 1; yield 2; }
+			const g = gen();
+			[[...g], [...g], runs]`,
+			"[[1, 2], [], 1]",
+		},
+		{
+			`let runs = 0;
+			let closed = 0;
+			fn gen() { runs = runs + 1; try { yield 1; yield 2; } finally { closed = closed + 1; } }
+			const g = gen();
+			[[...take(g, 1)], [...g], runs, closed]`,
+			"[[1], [], 1, 1]",
+		},
+		{
+			`let runs = 0;
+			fn gen() { runs = runs + 1; yield 1; }
+			const m = map(gen(), fn(x) { return x * 10; });
+			let s = [];
+			for let x = m { for let y = m { s = [...s, y]; } s = [...s, x]; }
+			[s, runs]`,
+			"[[10], 1]",
+		},
+		{
+			`let runs = 0;
+			fn gen() { runs = runs + 1; yield runs; }
+			[...gen(), ...gen(), runs]`,
+			"[1, 2, 2]",
+		},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("generator-once-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn f(x) { return x * 2; } (spawn f(21)).wait()", "42"},
+		{"fn f(x) { return x * 2; } const t = spawn f(21); [t.wait(), t]", "[42, task(done)]"},
+		{
+			`const c = channel();
+			fn produce(n) { for let i = 0..n { c.send(i); } c.close(); }
+			spawn produce(4);
+			let r = [];
+			for let x = c { r = [...r, x]; }
+			r`,
+			"[0, 1, 2, 3]",
+		},
+		{"const c = channel(2); c.send(1); c.send(2); c.close(); [c.recv(), c.recv(), c.recv()]", "[1, 2, null]"},
+		{
+			`const c = channel();
+			let counter = 0;
+			fn work(n) { for let i = 0..n { counter = counter + 1; } c.send(n); }
+			for let i = 0..50 { spawn work(100); }
+			let s = 0;
+			for let i = 0..50 { s = s + c.recv(); }
+			[counter, s]`,
+			"[5000, 5000]",
+		},
+		{
+			`const a = channel(); const b = channel();
+			spawn fn() { b.send("b"); }();
+			select { let v = a.recv() { "a" + v } let v = b.recv() { v } }`,
+			"b",
+		},
+		{
+			`const a = channel(1);
+			select { a.send(1) { } }
+			const c = channel();
+			select { c.recv() { 1 } else { [a.recv(), 2] } }`,
+			"[1, 2]",
+		},
+		{
+			`const c = channel(); c.close();
+			select { let v = c.recv() { [v] } }`,
+			"[null]",
+		},
+		{"const c = channel(); c.recv()", "RuntimeError: deadlock: all tasks are blocked at L1:C28"},
+		{"const c = channel(1); c.send(1); c.send(2)", "RuntimeError: deadlock: all tasks are blocked at L1:C40"},
+		{"select {}", "RuntimeError: deadlock: all tasks are blocked at L1:C1"},
+		{"const c = channel(); fn f() { c.recv(); } spawn f(); 1", "RuntimeError: deadlock: all tasks are blocked at L1:C43"},
+		{"const c = channel(); try { c.recv(); } catch e { e }", "deadlock: all tasks are blocked"},
+		{"fn f() { throw \"boom\"; } spawn f(); 1", "RuntimeError: boom at L1:C10\n\tcalled at L1:C33"},
+		{"fn f() { throw \"boom\"; } const t = spawn f(); try { t.wait(); } catch e { e }", "boom"},
+		{"const c = channel(); c.close(); c.close()", "RuntimeError: close of closed channel at L1:C40"},
+		{"const c = channel(); c.close(); c.send(1)", "RuntimeError: send on closed channel at L1:C39"},
+		{"channel().foo", `RuntimeError: CHANNEL has no method "foo" at L1:C11`},
+		{"channel(-1)", "RuntimeError: capacity of channel must be a non-negative integer, got -1 at L1:C8"},
+		{"select { 5.recv() { } }", "RuntimeError: select case must operate on a CHANNEL, got NUMBER at L1:C16"},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("concurrency-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestAsyncAwait(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"async fn f(x) { return x * 2; } await f(21)", "42"},
+		{"async fn f() { return 1; } f()", "<future async f>"},
+		{"const f = async fn() { return 1; }; const x = f(); [await x, await x]", "[1, 1]"},
+		{
+			`let log = [];
+			async fn worker(name, n) {
+				for let i = 0..n { log = [...log, [name, i]]; await tick(); }
+				return name;
+			}
+			async fn tick() { }
+			const a = worker("a", 3);
+			const b = worker("b", 2);
+			[await a, await b, log]`,
+			"[a, b, [[a, 0], [b, 0], [a, 1], [b, 1], [a, 2]]]",
+		},
+		{
+			`let log = [];
+			async fn f() { log = [...log, "f"]; }
+			f();
+			log = [...log, "main"];
+			log`,
+			"[main]",
+		},
+		{
+			`let log = [];
+			async fn f() { log = [...log, "f"]; }
+			f();
+			log`,
+			"[]",
+		},
+		{
+			`struct C { n }
+			async fn (c C) add(x) { return c.n + x; }
+			async fn sum(xs) { let s = 0; for let x = xs { s = s + await C(x).add(1); } return s; }
+			await sum([1, 2, 3])`,
+			"9",
+		},
+		{
+			`async fn f() { throw "boom"; }
+			try { await f(); } catch e { "caught " + e }`,
+			"caught boom",
+		},
+		{
+			`async fn f() { throw "boom"; }
+			async fn g() { return await f(); }
+			await g()`,
+			"RuntimeError: boom at L1:C16\n\tcalled at L2:C33\n\tcalled at L2:C26\n\tcalled at L3:C11\n\tcalled at L3:C4",
+		},
+		{"async fn f() { throw \"boom\"; } f(); 1", "RuntimeError: boom at L1:C16\n\tcalled at L1:C33"},
+		{"await 1", "RuntimeError: await requires a FUTURE, got NUMBER at L1:C1"},
+		{
+			`let f = null;
+			async fn a() { return await f; }
+			f = a();
+			await f`,
+			"RuntimeError: deadlock: all tasks are blocked at L4:C4",
+		},
+		{
+			`let f = null;
+			async fn a() { return await f; }
+			f = a();
+			1`,
+			"RuntimeError: deadlock: all tasks are blocked at L3:C9",
+		},
+	}
+	for i, tt := range tests {
+		evaluated := testEval(t, tt.input, fmt.Sprintf("async-%d", i))
+		if evaluated.String() != tt.expected {
+			t.Errorf("unexpected result for %q, want=%q, got=%q",
+				tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestHostFutures(t *testing.T) {
+	// later settles its future from another goroutine after
+	// the given number of milliseconds, rejecting negative ones
+	object.Builtins["later"] = &object.Builtin{
+		Name: "later",
+		Fn: func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			ms := args[0].(*object.Number).Value
+			future, settle := object.NewFuture("later")
+			go func() {
+				time.Sleep(time.Duration(math.Abs(ms)) * time.Millisecond)
+				if ms < 0 {
+					settle(nil, fmt.Errorf("rejected after %gms", -ms))
+					return
+				}
+				settle(args[0], nil)
+			}()
+			return future, nil
+		},
+	}
+	defer delete(object.Builtins, "later")
+	// settled returns a future which is already settled
+	object.Builtins["settled"] = &object.Builtin{
+		Name: "settled",
+		Fn: func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			future, settle := object.NewFuture("settled")
+			settle(args[0], nil)
+			return future, nil
+		},
+	}
+	defer delete(object.Builtins, "settled")
+	// gate returns a future which open settles, or which
+	// is rejected if open is not called within a second
+	var open func(val object.Object, err error)
+	object.Builtins["gate"] = &object.Builtin{
+		Name: "gate",
+		Fn: func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			future, settle := object.NewFuture("gate")
+			time.AfterFunc(time.Second, func() { settle(nil, errors.New("gate was never opened")) })
+			open = settle
+			return future, nil
+		},
+	}
+	defer delete(object.Builtins, "gate")
+	object.Builtins["open"] = &object.Builtin{
+		Name: "open",
+		Fn: func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			open(args[0], nil)
+			return object.Nil, nil
+		},
+	}
+	defer delete(object.Builtins, "open")
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"await later(1)", "1"},
+		{
+			`let log = [];
+			async fn wait(ms) { const v = await later(ms); log = [...log, v]; }
+			wait(20); wait(1);
+			await later(40);
+			log`,
+			"[1, 20]",
+		},
+		{
+			// settled before the loop is idle, observed in the order awaited
+			`let log = [];
+			const fs = [settled(1), settled(2), settled(3)];
+			async fn wait(f) { const v = await f; log = [...log, v]; }
+			const ws = [wait(fs[2]), wait(fs[0]), wait(fs[1])];
+			for let w = ws { await w; }
+			log`,
+			"[3, 1, 2]",
+		},
+		{"try { await later(-1); } catch e { e }", "rejected after 1ms"},
+		{"async fn f() { return await later(-1); } await f()", "RuntimeError: rejected after 1ms at L1:C23\n\tcalled at L1:C49\n\tcalled at L1:C42"},
+		{"let r = 0; async fn f() { r = await later(5); } f(); r", "0"},
+		{
+			// spawned tasks keep running while a host future is awaited
+			`const g = gate();
+			let log = ["main"];
+			fn work() { log = [...log, "task"]; open("opened"); }
+			spawn work();
+			[await g, log]`,
+			"[opened, [main, task]]",
+		},
+		{
+			// a coroutine created by a task runs while the loop waits
+			`const g = gate();
+			async fn opener() { open("opened"); }
+			fn work() { opener(); }
+			spawn work();
+			await g`,
+			"opened",
+		},
+	}
+	for i, tt := range tests {
+		for range 3 {
+			evaluated := testEval(t, tt.input, fmt.Sprintf("host-future-%d", i))
+			if evaluated.String() != tt.expected {
+				t.Errorf("unexpected result for %q, want=%q, got=%q",
+					tt.input, tt.expected, evaluated.String())
+			}
+		}
+	}
+}
+
+func testEval(t *testing.T, input, name string) object.Object {
+	t.Helper()
+	p := parser.New(lexer.FromString(input), name)
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Fatal(err.Msg)
+	}
+	return Eval(program, object.NewEnvironment())
+}
+
+func testNumberObject(t *testing.T, obj object.Object, expected float64) bool {
+	t.Helper()
+	result, ok := obj.(*object.Number)
+	if !ok {
+		t.Errorf("object is not Number. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	t.Helper()
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package evaluator
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/object"
+)
+
+func evalPrefixExpression(node *ast.PrefixExpression, right object.Object) object.Object {
+	switch node.Operator {
+	case "!":
+		return object.Bool(!isTruthy(right))
+	case "-":
+		if n, ok := right.(*object.Number); ok {
+			return &object.Number{Value: -n.Value}
+		}
+	}
+	return object.NewError(node.Token, "unknown operator: %s%s", node.Operator, right.Type())
+}
+
+func evalInfixExpression(node *ast.InfixExpression, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.NUMBER && right.Type() == object.NUMBER:
+		return evalNumberInfixExpression(node, left.(*object.Number).Value, right.(*object.Number).Value)
+	case left.Type() == object.STRING && right.Type() == object.STRING:
+		return evalStringInfixExpression(node, left.(*object.String).Value, right.(*object.String).Value)
+	case node.Operator == "??":
+		return right
+	case node.Operator == "==":
+		return object.Bool(equals(left, right))
+	case node.Operator == "!=":
+		return object.Bool(!equals(left, right))
+	}
+	return object.NewError(node.Token, "unknown operator: %s %s %s",
+		left.Type(), node.Operator, right.Type())
+}
+
+func evalNumberInfixExpression(node *ast.InfixExpression, left, right float64) object.Object {
+	switch node.Operator {
+	case "+":
+		return &object.Number{Value: left + right}
+	case "-":
+		return &object.Number{Value: left - right}
+	case "*":
+		return &object.Number{Value: left * right}
+	case "/":
+		if right == 0 {
+			return object.NewError(node.Token, "division by zero")
+		}
+		return &object.Number{Value: left / right}
+	case "<":
+		return object.Bool(left < right)
+	case "<=":
+		return object.Bool(left <= right)
+	case ">":
+		return object.Bool(left > right)
+	case ">=":
+		return object.Bool(left >= right)
+	case "==":
+		return object.Bool(left == right)
+	case "!=":
+		return object.Bool(left != right)
+	}
+	return object.NewError(node.Token, "unknown operator: %s %s %s",
+		object.NUMBER, node.Operator, object.NUMBER)
+}
+
+func evalStringInfixExpression(node *ast.InfixExpression, left, right string) object.Object {
+	switch node.Operator {
+	case "+":
+		return &object.String{Value: left + right}
+	case "<":
+		return object.Bool(left < right)
+	case "<=":
+		return object.Bool(left <= right)
+	case ">":
+		return object.Bool(left > right)
+	case ">=":
+		return object.Bool(left >= right)
+	case "==":
+		return object.Bool(left == right)
+	case "!=":
+		return object.Bool(left != right)
+	}
+	return object.NewError(node.Token, "unknown operator: %s %s %s",
+		object.STRING, node.Operator, object.STRING)
+}
+
+// evalPropagateExpression unwraps an ok result, an err result
+// is returned from the enclosing function as is
+func evalPropagateExpression(node *ast.PropagateExpression, val object.Object) object.Object {
+	result, ok := val.(*object.Result)
+	if !ok {
+		return object.NewError(node.Token, "? applied to non-result %s", val.Type())
+	}
+	if !result.Ok {
+		return &object.Return{Value: result}
+	}
+	return result.Value
+}
+
+func evalIndexExpression(node *ast.IndexExpression, left, index object.Object) object.Object {
+	if r, ok := index.(*object.Range); ok {
+		return evalRangeIndexExpression(node, left, r)
+	}
+	if dict, ok := left.(*object.Dict); ok {
+		key, ok := index.(*object.String)
+		if !ok {
+			return object.NewError(node.Token, "dict key must be a STRING, got %s", index.Type())
+		}
+		return dictGet(node.Token, dict, key.Value)
+	}
+	i, ok := toInt(index)
+	if !ok {
+		return object.NewError(node.Token, "index must be an integer, got %s", index)
+	}
+	switch left := left.(type) {
+	case *object.Array:
+		if i < 0 || i >= len(left.Elements) {
+			return object.NewError(node.Token, "index %d out of range [0:%d]", i, len(left.Elements))
+		}
+		return left.Elements[i]
+	case *object.String:
+		if i < 0 || i >= len(left.Value) {
+			return object.NewError(node.Token, "index %d out of range [0:%d]", i, len(left.Value))
+		}
+		return &object.String{Value: string(left.Value[i])}
+	}
+	return object.NewError(node.Token, "index operator not supported: %s", left.Type())
+}
+
+// equals compares scalars by value and everything else by identity
+func equals(left, right object.Object) bool {
+	switch l := left.(type) {
+	case *object.Number:
+		r, ok := right.(*object.Number)
+		return ok && l.Value == r.Value
+	case *object.String:
+		r, ok := right.(*object.String)
+		return ok && l.Value == r.Value
+	case *object.Boolean:
+		r, ok := right.(*object.Boolean)
+		return ok && l.Value == r.Value
+	case *object.Null:
+		return right.Type() == object.NULL
+	case *object.Result:
+		r, ok := right.(*object.Result)
+		return ok && l.Ok == r.Ok && equals(l.Value, r.Value)
+	}
+	return left == right
+}
@@ -0,0 +1,104 @@
+package evaluator
+
+import (
+	"math"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+func evalRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
+	r := &object.Range{
+		Step:      1,
+		OpenStart: node.Start == nil,
+		OpenEnd:   node.End == nil,
+		Inclusive: node.Inclusive,
+	}
+	bounds := []struct {
+		expr ast.Expression
+		dst  *int
+	}{
+		{node.Start, &r.Start},
+		{node.End, &r.End},
+		{node.Step, &r.Step},
+	}
+	for _, b := range bounds {
+		if b.expr == nil {
+			continue
+		}
+		val := Eval(b.expr, env)
+		if isAbrupt(val) {
+			return val
+		}
+		i, ok := toInt(val)
+		if !ok {
+			return object.NewError(node.Token, "range bound must be an integer, got %s", val)
+		}
+		*b.dst = i
+	}
+	if r.Step == 0 {
+		return object.NewError(node.Token, "range step cannot be zero")
+	}
+	return r
+}
+
+// evalForExpression evaluates the body once for every value of the
+// iterable. Every iteration gets its own frame holding the loop
+// variable, so closures created in the body capture that iteration.
+func evalForExpression(node *ast.ForExpression, env *object.Environment) object.Object {
+	iterable := Eval(node.Assignment.Right, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	name := node.Assignment.Left.Value
+	isConst := node.Assignment.Token.Type == token.CONST
+	var result object.Object = object.Nil
+	body := func(val object.Object) bool {
+		iterEnv := object.NewEnclosed(env)
+		iterEnv.Declare(name, val, isConst)
+		result = Eval(node.Body, iterEnv)
+		return !isAbrupt(result)
+	}
+	var err *object.Error
+	if ch, ok := iterable.(*object.Channel); ok {
+		err = iterateChannel(node.Assignment.Token, ch, env, body)
+	} else {
+		err = iterate(node.Assignment.Token, iterable, body)
+	}
+	if err != nil {
+		return err
+	}
+	if isAbrupt(result) {
+		return result
+	}
+	return object.Nil
+}
+
+// iterate calls yield with every value of iterable until all values
+// are consumed or yield returns false. An error yielded by an iterator
+// ends the iteration and is returned.
+func iterate(t token.T, iterable object.Object, yield func(object.Object) bool) *object.Error {
+	values, err := object.Values(iterable)
+	if err != nil {
+		return object.NewError(t, "%s", err)
+	}
+	for val := range values {
+		if err, ok := val.(*object.Error); ok {
+			return err
+		}
+		if !yield(val) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// toInt converts an integral number to int
+func toInt(obj object.Object) (int, bool) {
+	n, ok := obj.(*object.Number)
+	if !ok || n.Value != math.Trunc(n.Value) {
+		return 0, false
+	}
+	return int(n.Value), true
+}
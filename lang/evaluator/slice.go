@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	if node.Optional && left.Type() == object.NULL {
+		return object.Nil
+	}
+	b := object.Bounds{Step: 1}
+	parts := []struct {
+		expr ast.Expression
+		dst  **int
+	}{
+		{node.Start, &b.Start},
+		{node.End, &b.End},
+	}
+	for _, part := range parts {
+		if part.expr == nil {
+			continue
+		}
+		val := Eval(part.expr, env)
+		if isAbrupt(val) {
+			return val
+		}
+		i, ok := toInt(val)
+		if !ok {
+			return object.NewError(node.Token, "slice index must be an integer, got %s", val)
+		}
+		*part.dst = &i
+	}
+	if node.Step != nil {
+		val := Eval(node.Step, env)
+		if isAbrupt(val) {
+			return val
+		}
+		i, ok := toInt(val)
+		if !ok {
+			return object.NewError(node.Token, "slice step must be an integer, got %s", val)
+		}
+		if i == 0 {
+			return object.NewError(node.Token, "slice step cannot be zero")
+		}
+		b.Step = i
+	}
+	return slice(node.Token, left, b, b.String())
+}
+
+// evalRangeIndexExpression slices an array or a string by r,
+// left[a..b step c] is equivalent to left[a:b:c]
+func evalRangeIndexExpression(node *ast.IndexExpression, left object.Object, r *object.Range) object.Object {
+	return slice(node.Token, left, r.Bounds(), r.String())
+}
+
+// slice returns the part of an array or a string selected by b.
+// Errors are reported at t, describing the bounds as desc
+func slice(t token.T, obj object.Object, b object.Bounds, desc string) object.Object {
+	result, err := object.Slice(obj, b, desc)
+	if err != nil {
+		return object.NewError(t, "%s", err)
+	}
+	return result
+}
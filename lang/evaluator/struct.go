@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// evalStructStatement declares the struct type as a constant in env
+func evalStructStatement(node *ast.StructStatement, env *object.Environment) object.Object {
+	fields := make([]string, len(node.Fields))
+	for i, field := range node.Fields {
+		fields[i] = field.Value
+	}
+	s := object.NewStruct(node.Name.Value, fields)
+	if !env.Declare(s.Name, s, true) {
+		return object.NewError(node.Name.Token, "%q is already declared in this scope", s.Name)
+	}
+	return object.Nil
+}
+
+// evalMethod attaches the method node to the struct type named by its receiver
+func evalMethod(node *ast.Function, env *object.Environment) object.Object {
+	typ := node.Receiver.Type
+	val, ok := env.Get(typ.Value)
+	if !ok {
+		return object.NewError(typ.Token, "undeclared identifier %q", typ.Value)
+	}
+	s, ok := val.(*object.Struct)
+	if !ok {
+		return object.NewError(typ.Token, "%q is not a struct, got %s", typ.Value, val.Type())
+	}
+	name := node.Name.Value
+	if s.HasField(name) {
+		return object.NewError(node.Name.Token, "method %q conflicts with field of %s", name, s.Name)
+	}
+	if _, ok := s.Methods[name]; ok {
+		return object.NewError(node.Name.Token, "method %q is already declared on %s", name, s.Name)
+	}
+	fn := &object.Function{Node: node, Env: env}
+	s.Methods[name] = fn
+	return fn
+}
+
+// evalMemberExpression looks up a field or a method of a
+// struct instance, a key of a dict or an export of a module
+func evalMemberExpression(node *ast.MemberExpression, left object.Object, env *object.Environment) object.Object {
+	if node.Optional && left.Type() == object.NULL {
+		return object.Nil
+	}
+	name := node.Member.Value
+	if m, ok := left.(*object.Module); ok {
+		val, ok := m.Env.Get(name)
+		if !ok || !m.Exported(name) {
+			return object.NewError(node.Member.Token, "module %q does not export %q", m.Path, name)
+		}
+		return val
+	}
+	switch left := left.(type) {
+	case *object.Channel:
+		return evalChannelMember(node, left, env)
+	case *object.Task:
+		return evalTaskMember(node, left)
+	case *object.Dict:
+		return dictGet(node.Member.Token, left, name)
+	}
+	instance, ok := left.(*object.Instance)
+	if !ok {
+		return object.NewError(node.Token, "member access not supported: %s", left.Type())
+	}
+	if val, ok := instance.Field(name); ok {
+		return val
+	}
+	if fn, ok := instance.Struct.Methods[name].(*object.Function); ok {
+		return &object.Method{Receiver: instance, Fn: fn}
+	}
+	return object.NewError(node.Member.Token, "%s has no field or method %q", instance.Struct.Name, name)
+}
+
+// construct creates an instance of s, every field
+// must be given either by position or by name
+func construct(t token.T, s *object.Struct, args []object.Object, kwargs map[string]object.Object) object.Object {
+	if len(args) > len(s.Fields) {
+		return object.NewError(t, "too many arguments to %s, want=%d, got=%d", s.Name, len(s.Fields), len(args))
+	}
+	for name := range kwargs {
+		if !s.HasField(name) {
+			return object.NewError(t, "%s has no field %q", s.Name, name)
+		}
+	}
+	instance := &object.Instance{Struct: s, Values: make([]object.Object, len(s.Fields))}
+	for i, name := range s.Fields {
+		val, named := kwargs[name]
+		switch {
+		case i < len(args) && named:
+			return object.NewError(t, "field %q given both by position and by name", name)
+		case i < len(args):
+			val = args[i]
+		case !named:
+			return object.NewError(t, "missing field %q of %s", name, s.Name)
+		}
+		instance.Values[i] = val
+	}
+	return instance
+}
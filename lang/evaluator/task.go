@@ -0,0 +1,172 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// evalSpawnExpression evaluates the callee and arguments of the call
+// in the current task and calls the callee in a new task
+func evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	callee, args, kwargs, err := evalCall(node.Call, env)
+	if err != nil {
+		return err
+	}
+	t := node.Call.Token
+	return env.StartRuntime().Spawn(node.Token, func() object.Object {
+		return applyFunction(t, callee, args, kwargs)
+	})
+}
+
+// evalChannelMember returns the method name of ch, bound to the runtime
+// of env i.e ch.send(x), ch.recv() or ch.close()
+func evalChannelMember(node *ast.MemberExpression, ch *object.Channel, env *object.Environment) object.Object {
+	if err := ch.Bind(env.StartRuntime()); err != nil {
+		return object.NewError(node.Token, "%s", err)
+	}
+	var fn object.BuiltinFn
+	switch name := node.Member.Value; name {
+	case "send":
+		fn = func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("wrong number of arguments to send, want=1, got=%d", len(args))
+			}
+			return nil, ch.Send(args[0])
+		}
+	case "recv":
+		fn = func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("wrong number of arguments to recv, want=0, got=%d", len(args))
+			}
+			val, _, err := ch.Recv()
+			return val, err
+		}
+	case "close":
+		fn = func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("wrong number of arguments to close, want=0, got=%d", len(args))
+			}
+			return nil, ch.Close()
+		}
+	default:
+		return object.NewError(node.Member.Token, "%s has no method %q", ch.Type(), name)
+	}
+	return &object.Builtin{Name: node.Member.Value, Fn: fn}
+}
+
+// evalTaskMember returns the method name of task i.e task.wait()
+func evalTaskMember(node *ast.MemberExpression, task *object.Task) object.Object {
+	if node.Member.Value != "wait" {
+		return object.NewError(node.Member.Token, "%s has no method %q", task.Type(), node.Member.Value)
+	}
+	return &object.Builtin{Name: "wait", Fn: func(_ object.Caller, args ...object.Object) (object.Object, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("wrong number of arguments to wait, want=0, got=%d", len(args))
+		}
+		return task.Wait()
+	}}
+}
+
+// selectCase is an evaluated case of a select statement
+type selectCase struct {
+	node *ast.SelectCase
+	ch   *object.Channel
+	send bool
+	// val is the value to send
+	val object.Object
+}
+
+func (c *selectCase) ready() bool {
+	if c.send {
+		return c.ch.CanSend()
+	}
+	return c.ch.CanRecv()
+}
+
+// evalSelectStatement evaluates the channels and sent values of every
+// case in order, then blocks until a case is ready unless there is an
+// else case. The body of the first ready case is evaluated in a new
+// frame, with the received value bound if the case declares a name.
+func evalSelectStatement(node *ast.SelectStatement, env *object.Environment) object.Object {
+	rt := env.StartRuntime()
+	cases := make([]*selectCase, len(node.Cases))
+	for i, n := range node.Cases {
+		left, op := n.Channel()
+		val := Eval(left, env)
+		if isAbrupt(val) {
+			return val
+		}
+		ch, ok := val.(*object.Channel)
+		if !ok {
+			return object.NewError(n.Call.Token, "select case must operate on a CHANNEL, got %s", val.Type())
+		}
+		if err := ch.Bind(rt); err != nil {
+			return object.NewError(n.Call.Token, "%s", err)
+		}
+		c := &selectCase{node: n, ch: ch, send: op == "send"}
+		if c.send {
+			if c.val = Eval(n.Call.Arguments[0], env); isAbrupt(c.val) {
+				return c.val
+			}
+		}
+		cases[i] = c
+	}
+	var chosen *selectCase
+	ready := func() bool {
+		for _, c := range cases {
+			if c.ready() {
+				chosen = c
+				return true
+			}
+		}
+		return false
+	}
+	if !ready() {
+		if node.Default != nil {
+			return Eval(node.Default, env)
+		}
+		if err := blockSelect(rt, cases, ready); err != nil {
+			return object.NewError(node.Token, "%s", err)
+		}
+	}
+	caseEnv := object.NewEnclosed(env)
+	if chosen.send {
+		if err := chosen.ch.TrySend(chosen.val); err != nil {
+			return object.NewError(chosen.node.Call.Token, "%s", err)
+		}
+	} else if val, _ := chosen.ch.TryRecv(); chosen.node.Binding != nil {
+		caseEnv.Declare(chosen.node.Binding.Value, val, chosen.node.Token.Type == token.CONST)
+	}
+	return evalStatements(chosen.node.Body.Statements, caseEnv)
+}
+
+// blockSelect waits as a receiver on every receiving case until ready
+func blockSelect(rt *object.Runtime, cases []*selectCase, ready func() bool) error {
+	for _, c := range cases {
+		if !c.send {
+			c.ch.Waiting(1)
+			defer c.ch.Waiting(-1)
+		}
+	}
+	return rt.Block(ready)
+}
+
+// iterateChannel calls yield with every value received
+// from ch until ch is closed or yield returns false
+func iterateChannel(t token.T, ch *object.Channel, env *object.Environment, yield func(object.Object) bool) *object.Error {
+	if err := ch.Bind(env.StartRuntime()); err != nil {
+		return object.NewError(t, "%s", err)
+	}
+	for {
+		val, ok, err := ch.Recv()
+		if err != nil {
+			return object.NewError(t, "%s", err)
+		}
+		if !ok || !yield(val) {
+			return nil
+		}
+	}
+}
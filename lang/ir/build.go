@@ -0,0 +1,551 @@
+package ir
+
+import (
+	"strconv"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/resolve"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// B builds the IR of a resolved program. Variables are converted to
+// SSA form while the blocks are built: an assignment records the value
+// of the variable in the current block and a read looks the value up in
+// the predecessors, placing a phi where several definitions meet. A
+// block is sealed once all of its predecessors are known, phis placed
+// in a block before it is sealed are completed when it is.
+type B struct {
+	l *lexer.L
+
+	sourceName string
+
+	table   *resolve.Table
+	program *Program
+	fn      *funcState
+	// captured symbols are locals accessed by a function
+	// other than the one declaring them
+	captured map[*resolve.Symbol]bool
+	// number of functions of each name, used to make names unique
+	names map[string]int
+
+	errs []BuildErr
+}
+
+// funcState is the function being built
+type funcState struct {
+	f   *Func
+	cur *Block
+	// defs is the value of each variable at the end of a block
+	defs   map[*resolve.Symbol]map[*Block]*Value
+	sealed map[*Block]bool
+	// incomplete phis of blocks that are not sealed yet
+	incomplete map[*Block]map[*resolve.Symbol]*Value
+}
+
+// New creates a new builder, l is used
+// to highlight the offending source lines
+func New(l *lexer.L, sourceName string) *B {
+	return &B{
+		l:          l,
+		sourceName: sourceName,
+		errs:       make([]BuildErr, 0),
+	}
+}
+
+// Errors returns the errors that occured while building
+func (b *B) Errors() []BuildErr {
+	return b.errs
+}
+
+// HasErrors returns true if there are any errors
+func (b *B) HasErrors() bool {
+	return len(b.errs) > 0
+}
+
+// Build returns the IR of program, resolved into table. The top
+// level returns the value of its last statement, like the compiler.
+func (b *B) Build(program *ast.Program, table *resolve.Table) *Program {
+	b.table = table
+	b.program = &Program{}
+	b.captured = make(map[*resolve.Symbol]bool)
+	b.names = make(map[string]int)
+	c := &captures{table: table, owner: make(map[*resolve.Symbol]*ast.Function)}
+	for _, stmt := range program.Statements {
+		c.walk(stmt, nil)
+	}
+	for _, u := range c.uses {
+		if c.owner[u.sym] != u.fn {
+			b.captured[u.sym] = true
+		}
+	}
+	b.openFunc("main")
+	t, v := b.statements(program.Statements)
+	b.terminate(t, OpReturn, v)
+	b.closeFunc()
+	return b.program
+}
+
+// statements builds statements and returns the token and value of the
+// last one, which is null unless it is an expression or a block
+func (b *B) statements(statements []ast.Statement) (token.T, *Value) {
+	var t token.T
+	for i, stmt := range statements {
+		t = ast.StatementToken(stmt)
+		if i < len(statements)-1 {
+			b.statement(stmt)
+			continue
+		}
+		switch stmt := stmt.(type) {
+		case *ast.ExpressionStatement:
+			if stmt.Expression != nil {
+				return t, b.expression(stmt.Expression)
+			}
+		case *ast.BlockStatement:
+			return t, b.block(stmt)
+		default:
+			b.statement(stmt)
+		}
+	}
+	return t, b.null(t)
+}
+
+func (b *B) statement(node ast.Statement) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if node.Expression != nil {
+			b.expression(node.Expression)
+		}
+	case *ast.AssignStatement:
+		b.assign(node.Left, b.expression(node.Right))
+	case *ast.BlockStatement:
+		b.block(node)
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			b.terminate(node.Token, OpReturn, b.null(node.Token))
+		} else {
+			b.terminate(node.Token, OpReturn, b.expression(node.ReturnValue))
+		}
+	default:
+		b.unsupported(ast.StatementToken(node), node)
+	}
+}
+
+// block builds the statements of node and returns its value
+func (b *B) block(node *ast.BlockStatement) *Value {
+	_, v := b.statements(node.Statements)
+	return v
+}
+
+func (b *B) expression(node ast.Expression) *Value {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return b.read(node)
+	case *ast.Number:
+		return b.emit(node.Token, OpConst, &object.Number{Value: node.Value})
+	case *ast.String:
+		return b.emit(node.Token, OpConst, &object.String{Value: node.Value})
+	case *ast.Boolean:
+		return b.emit(node.Token, OpConst, object.Bool(node.Value))
+	case *ast.Null:
+		return b.null(node.Token)
+	case *ast.Array:
+		return b.emit(node.Token, OpArray, nil, b.arguments(node.Elements)...)
+	case *ast.PrefixExpression:
+		return b.prefixExpression(node)
+	case *ast.InfixExpression:
+		return b.infixExpression(node)
+	case *ast.TernaryExpression:
+		return b.ternaryExpression(node)
+	case *ast.IndexExpression:
+		if node.Optional {
+			return b.unsupported(node.Token, node)
+		}
+		return b.emit(node.Token, OpIndex, nil, b.expression(node.Left), b.expression(node.Index))
+	case *ast.RangeExpression:
+		return b.rangeExpression(node)
+	case *ast.IfExpression:
+		return b.ifExpression(node)
+	case *ast.ForExpression:
+		return b.forExpression(node)
+	case *ast.Function:
+		return b.function(node)
+	case *ast.CallExpression:
+		args := append([]*Value{b.expression(node.Function)}, b.arguments(node.Arguments)...)
+		return b.emit(node.Token, OpCall, nil, args...)
+	}
+	return b.unsupported(b.token(), node)
+}
+
+// arguments builds expressions in order
+func (b *B) arguments(expressions []ast.Expression) []*Value {
+	args := make([]*Value, 0, len(expressions))
+	for _, e := range expressions {
+		switch e := e.(type) {
+		case *ast.Spread:
+			b.unsupported(e.Token, e)
+		case *ast.NamedArgument:
+			b.unsupported(e.Token, e)
+		default:
+			args = append(args, b.expression(e))
+		}
+	}
+	return args
+}
+
+func (b *B) prefixExpression(node *ast.PrefixExpression) *Value {
+	right := b.expression(node.Right)
+	switch node.Operator {
+	case "-":
+		return b.emit(node.Token, OpNeg, nil, right)
+	case "!":
+		return b.emit(node.Token, OpNot, nil, right)
+	}
+	berr(b, node.Token, "unknown operator: %s", node.Operator)
+	return right
+}
+
+var infixOps = map[string]Op{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	"<=": OpLessEqual,
+	">":  OpGreater,
+	">=": OpGreaterEqual,
+}
+
+// infixExpression builds a binary operation, the right
+// operand of ?? is only evaluated if the left operand is null
+func (b *B) infixExpression(node *ast.InfixExpression) *Value {
+	left := b.expression(node.Left)
+	if node.Operator == "??" {
+		right, join := b.fn.f.newBlock(), b.fn.f.newBlock()
+		b.branch(node.Token, b.emit(node.Token, OpNotNull, nil, left), join, right)
+		b.seal(right)
+		b.fn.cur = right
+		vals := []*Value{left, b.expression(node.Right)}
+		b.jump(node.Token, join)
+		return b.join(node.Token, join, vals)
+	}
+	right := b.expression(node.Right)
+	op, ok := infixOps[node.Operator]
+	if !ok {
+		berr(b, node.Token, "unknown operator: %s", node.Operator)
+		return left
+	}
+	return b.emit(node.Token, op, nil, left, right)
+}
+
+func (b *B) ternaryExpression(node *ast.TernaryExpression) *Value {
+	f := b.fn.f
+	then, els, join := f.newBlock(), f.newBlock(), f.newBlock()
+	b.branch(node.Token, b.expression(node.Condition), then, els)
+	b.seal(then)
+	b.seal(els)
+	b.fn.cur = then
+	vals := []*Value{b.expression(node.Consequence)}
+	b.jump(node.Token, join)
+	b.fn.cur = els
+	vals = append(vals, b.expression(node.Alternative))
+	b.jump(node.Token, join)
+	return b.join(node.Token, join, vals)
+}
+
+func (b *B) rangeExpression(node *ast.RangeExpression) *Value {
+	r := Range{Inclusive: node.Inclusive}
+	var args []*Value
+	for _, bound := range []struct {
+		expr ast.Expression
+		set  *bool
+	}{{node.Start, &r.Start}, {node.End, &r.End}, {node.Step, &r.Step}} {
+		if bound.expr != nil {
+			args = append(args, b.expression(bound.expr))
+			*bound.set = true
+		}
+	}
+	return b.emit(node.Token, OpRange, r, args...)
+}
+
+// ifExpression branches past every branch whose condition
+// is falsy and merges the value of the branch taken, or null
+func (b *B) ifExpression(node *ast.IfExpression) *Value {
+	f := b.fn.f
+	join := f.newBlock()
+	var vals []*Value
+	for _, branch := range append([]ast.Conditional{node.If}, node.Elifs...) {
+		then, next := f.newBlock(), f.newBlock()
+		b.branch(node.Token, b.expression(branch.Condition), then, next)
+		b.seal(then)
+		b.seal(next)
+		b.fn.cur = then
+		vals = append(vals, b.block(branch.Body))
+		b.jump(node.Token, join)
+		b.fn.cur = next
+	}
+	if node.Else != nil {
+		vals = append(vals, b.block(node.Else))
+	} else {
+		vals = append(vals, b.null(node.Token))
+	}
+	b.jump(node.Token, join)
+	return b.join(node.Token, join, vals)
+}
+
+// forExpression iterates the iterable in a loop whose header is
+// sealed once the body, which jumps back to the header, is built
+func (b *B) forExpression(node *ast.ForExpression) *Value {
+	f := b.fn.f
+	t := node.Assignment.Token
+	iter := b.emit(t, OpIter, nil, b.expression(node.Assignment.Right))
+	header, body, exit := f.newBlock(), f.newBlock(), f.newBlock()
+	b.jump(t, header)
+	b.fn.cur = header
+	b.branch(t, b.emit(t, OpMore, nil, iter), body, exit)
+	b.seal(body)
+	b.fn.cur = body
+	b.assign(node.Assignment.Left, b.emit(t, OpNext, nil, iter))
+	b.block(node.Body)
+	b.jump(node.Body.Token, header)
+	b.seal(header)
+	b.seal(exit)
+	b.fn.cur = exit
+	return b.null(node.Token)
+}
+
+// function builds node into a new function of the program and
+// returns its closure. A named function is also assigned.
+func (b *B) function(node *ast.Function) *Value {
+	switch {
+	case node.Receiver != nil:
+		berr(b, node.Token, "ir does not support methods")
+		return b.null(node.Token)
+	case node.Generator:
+		berr(b, node.Token, "ir does not support generators")
+		return b.null(node.Token)
+	case node.Async:
+		berr(b, node.Token, "ir does not support async functions")
+		return b.null(node.Token)
+	}
+	name := "anon"
+	if node.Name != nil {
+		name = node.Name.Value
+	}
+	outer := b.fn
+	f := b.openFunc(name)
+	params := make([]*Value, len(node.Parameters))
+	for i, param := range node.Parameters {
+		params[i] = b.param(param.Name.Token, param.Name.Value)
+	}
+	if node.Rest != nil {
+		b.assign(node.Rest, b.param(node.Rest.Token, "..."+node.Rest.Value))
+	}
+	for i, param := range node.Parameters {
+		if param.Default != nil {
+			params[i] = b.defaultValue(param, params[i])
+		}
+		b.assign(param.Name, params[i])
+	}
+	b.statements(node.Body.Statements)
+	b.terminate(node.Body.Token, OpReturn, b.null(node.Body.Token))
+	b.closeFunc()
+	b.fn = outer
+	v := b.emit(node.Token, OpClosure, f)
+	if node.Name != nil {
+		b.assign(node.Name, v)
+	}
+	return v
+}
+
+// param appends a parameter to the function being built
+func (b *B) param(t token.T, name string) *Value {
+	v := b.emit(t, OpParam, name)
+	b.fn.f.Params = append(b.fn.f.Params, v)
+	return v
+}
+
+// defaultValue merges the argument of param with
+// its default value, built if it was not given
+func (b *B) defaultValue(param *ast.Parameter, arg *Value) *Value {
+	t := param.Name.Token
+	f := b.fn.f
+	dflt, join := f.newBlock(), f.newBlock()
+	b.branch(t, b.emit(t, OpGiven, nil, arg), join, dflt)
+	b.seal(dflt)
+	b.fn.cur = dflt
+	vals := []*Value{arg, b.expression(param.Default)}
+	b.jump(t, join)
+	return b.join(t, join, vals)
+}
+
+// unsupported reports a node the builder cannot lower
+func (b *B) unsupported(t token.T, node ast.Node) *Value {
+	berr(b, t, "ir does not support %q", node.Literal())
+	return b.null(t)
+}
+
+// token returns the token of the last value of the current block
+func (b *B) token() token.T {
+	if vals := b.fn.cur.Values; len(vals) > 0 {
+		return vals[len(vals)-1].Token
+	}
+	return token.T{}
+}
+
+// read returns the value of ident in the current block
+func (b *B) read(ident *ast.Identifier) *Value {
+	ref, ok := b.table.Lookup(ident)
+	if !ok {
+		berr(b, ident.Token, "unresolved identifier %q", ident.Value)
+		return b.null(ident.Token)
+	}
+	switch {
+	case ref.Kind == resolve.BUILTIN:
+		return b.emit(ident.Token, OpBuiltin, ident.Value)
+	case ref.Kind == resolve.GLOBAL:
+		return b.emit(ident.Token, OpGlobal, ref.Symbol)
+	case b.captured[ref.Symbol]:
+		return b.emit(ident.Token, OpLoad, ref.Symbol)
+	}
+	return b.readVariable(ident.Token, ref.Symbol, b.fn.cur)
+}
+
+// assign sets ident to v in the current block
+func (b *B) assign(ident *ast.Identifier, v *Value) {
+	ref, ok := b.table.Lookup(ident)
+	if !ok {
+		berr(b, ident.Token, "unresolved identifier %q", ident.Value)
+		return
+	}
+	switch {
+	case ref.Kind == resolve.BUILTIN:
+		berr(b, ident.Token, "cannot assign to builtin %q", ident.Value)
+	case ref.Kind == resolve.GLOBAL:
+		b.emit(ident.Token, OpSetGlobal, ref.Symbol, v)
+	case b.captured[ref.Symbol]:
+		b.emit(ident.Token, OpStore, ref.Symbol, v)
+	default:
+		b.writeVariable(ref.Symbol, b.fn.cur, b.emit(ident.Token, OpCopy, nil, v))
+	}
+}
+
+func (b *B) null(t token.T) *Value {
+	return b.emit(t, OpConst, object.Nil)
+}
+
+// emit appends a value to the current block
+func (b *B) emit(t token.T, op Op, aux any, args ...*Value) *Value {
+	v := b.fn.f.newValue(t, op, aux, args...)
+	v.Block = b.fn.cur
+	b.fn.cur.Values = append(b.fn.cur.Values, v)
+	return v
+}
+
+// terminate ends the current block with a terminator. Values built
+// after it are unreachable and go into a new block without predecessors.
+func (b *B) terminate(t token.T, op Op, args ...*Value) {
+	b.emit(t, op, nil, args...)
+	b.fn.cur = b.fn.f.newBlock()
+	b.fn.sealed[b.fn.cur] = true
+}
+
+// jump ends the current block with a jump to target
+func (b *B) jump(t token.T, target *Block) {
+	b.edge(b.fn.cur, target)
+	b.terminate(t, OpJump)
+}
+
+// branch ends the current block with a branch on cond
+func (b *B) branch(t token.T, cond *Value, then, els *Block) {
+	b.edge(b.fn.cur, then)
+	b.edge(b.fn.cur, els)
+	b.terminate(t, OpBranch, cond)
+}
+
+func (b *B) edge(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// join seals block, continues in it and merges vals,
+// the values of its predecessors in order, with a phi
+func (b *B) join(t token.T, block *Block, vals []*Value) *Value {
+	b.seal(block)
+	b.fn.cur = block
+	return b.phi(t, block, vals...)
+}
+
+// phi adds a phi to the start of block
+func (b *B) phi(t token.T, block *Block, args ...*Value) *Value {
+	v := b.fn.f.newValue(t, OpPhi, nil, args...)
+	v.Block = block
+	i := 0
+	for i < len(block.Values) && block.Values[i].Op == OpPhi {
+		i++
+	}
+	block.Values = append(block.Values[:i], append([]*Value{v}, block.Values[i:]...)...)
+	return v
+}
+
+func (b *B) openFunc(name string) *Func {
+	if n := b.names[name]; n > 0 {
+		b.names[name]++
+		name += "#" + strconv.Itoa(n+1)
+	} else {
+		b.names[name] = 1
+	}
+	f := &Func{Name: name}
+	b.program.Funcs = append(b.program.Funcs, f)
+	b.fn = &funcState{
+		f:          f,
+		defs:       make(map[*resolve.Symbol]map[*Block]*Value),
+		sealed:     make(map[*Block]bool),
+		incomplete: make(map[*Block]map[*resolve.Symbol]*Value),
+	}
+	b.fn.cur = f.newBlock()
+	b.fn.sealed[b.fn.cur] = true
+	return f
+}
+
+// closeFunc removes the blocks of the function being built that are
+// unreachable and numbers the rest in reverse postorder, so a block is
+// listed before the blocks it dominates
+func (b *B) closeFunc() {
+	f := b.fn.f
+	order := postorder(f)
+	reachable := make(map[*Block]bool, len(order))
+	for _, block := range order {
+		reachable[block] = true
+	}
+	f.Blocks = f.Blocks[:0]
+	for i := len(order) - 1; i >= 0; i-- {
+		block := order[i]
+		preds := block.Preds[:0]
+		for _, p := range block.Preds {
+			if reachable[p] {
+				preds = append(preds, p)
+				continue
+			}
+			for _, v := range block.Values {
+				if v.Op == OpPhi {
+					v.Args = append(v.Args[:len(preds)], v.Args[len(preds)+1:]...)
+				}
+			}
+		}
+		block.Preds = preds
+		f.Blocks = append(f.Blocks, block)
+	}
+	f.nextBlock, f.nextValue = 0, 0
+	for _, block := range f.Blocks {
+		block.ID = f.nextBlock
+		f.nextBlock++
+		for _, v := range block.Values {
+			v.ID = f.nextValue
+			f.nextValue++
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ir
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/resolve"
+)
+
+// captures collects the function declaring every local and the
+// functions accessing it, nil is the top level of the program
+type captures struct {
+	table *resolve.Table
+	owner map[*resolve.Symbol]*ast.Function
+	uses  []use
+}
+
+type use struct {
+	sym *resolve.Symbol
+	fn  *ast.Function
+}
+
+// walk visits node, which is part of fn
+func (c *captures) walk(node ast.Node, fn *ast.Function) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		c.walk(node.Expression, fn)
+	case *ast.AssignStatement:
+		c.walk(node.Right, fn)
+		c.access(node.Left, fn)
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			c.walk(stmt, fn)
+		}
+	case *ast.ReturnStatement:
+		c.walk(node.ReturnValue, fn)
+	case *ast.Identifier:
+		c.access(node, fn)
+	case *ast.Array:
+		c.walkList(node.Elements, fn)
+	case *ast.PrefixExpression:
+		c.walk(node.Right, fn)
+	case *ast.InfixExpression:
+		c.walk(node.Left, fn)
+		c.walk(node.Right, fn)
+	case *ast.TernaryExpression:
+		c.walk(node.Condition, fn)
+		c.walk(node.Consequence, fn)
+		c.walk(node.Alternative, fn)
+	case *ast.IndexExpression:
+		c.walk(node.Left, fn)
+		c.walk(node.Index, fn)
+	case *ast.RangeExpression:
+		c.walk(node.Start, fn)
+		c.walk(node.End, fn)
+		c.walk(node.Step, fn)
+	case *ast.IfExpression:
+		for _, branch := range append([]ast.Conditional{node.If}, node.Elifs...) {
+			c.walk(branch.Condition, fn)
+			c.walk(branch.Body, fn)
+		}
+		if node.Else != nil {
+			c.walk(node.Else, fn)
+		}
+	case *ast.ForExpression:
+		c.walk(node.Assignment.Right, fn)
+		c.access(node.Assignment.Left, fn)
+		c.walk(node.Body, fn)
+	case *ast.CallExpression:
+		c.walk(node.Function, fn)
+		c.walkList(node.Arguments, fn)
+	case *ast.Function:
+		if node.Name != nil {
+			c.access(node.Name, fn)
+		}
+		for _, param := range node.Parameters {
+			c.walk(param.Default, node)
+			c.access(param.Name, node)
+		}
+		if node.Rest != nil {
+			c.access(node.Rest, node)
+		}
+		c.walk(node.Body, node)
+	}
+}
+
+func (c *captures) walkList(expressions []ast.Expression, fn *ast.Function) {
+	for _, e := range expressions {
+		c.walk(e, fn)
+	}
+}
+
+// access records that ident, a declaration or a use, is part of fn
+func (c *captures) access(ident *ast.Identifier, fn *ast.Function) {
+	ref, ok := c.table.Lookup(ident)
+	if !ok || (ref.Kind != resolve.LOCAL && ref.Kind != resolve.PARAMETER) {
+		return
+	}
+	if ref.Decl == ident {
+		c.owner[ref.Symbol] = fn
+		return
+	}
+	c.uses = append(c.uses, use{ref.Symbol, fn})
+}
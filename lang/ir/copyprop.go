@@ -0,0 +1,39 @@
+package ir
+
+// CopyPropagation replaces every copy by its argument and every phi
+// whose arguments are all one value, apart from the phi itself, by that
+// value. Removing a phi may make others trivial, so it runs to a fixpoint.
+func CopyPropagation(f *Func) {
+	for changed := true; changed; {
+		changed = false
+		for _, b := range f.Blocks {
+			for _, v := range append([]*Value(nil), b.Values...) {
+				if src := copySource(v); src != nil {
+					f.replace(v, src)
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// copySource returns the value v is a copy of, nil if v is no copy
+func copySource(v *Value) *Value {
+	switch v.Op {
+	case OpCopy:
+		return v.Args[0]
+	case OpPhi:
+		var src *Value
+		for _, arg := range v.Args {
+			if arg == v || arg == src {
+				continue
+			}
+			if src != nil {
+				return nil
+			}
+			src = arg
+		}
+		return src
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lindeneg/blue/lang/object"
+)
+
+// CSE eliminates common subexpressions. A pure value which computes
+// the same operation on the same arguments as a value dominating it is
+// replaced by that value. Values are visited in a walk of the dominator
+// tree, so the values available in a block are those of its dominators.
+func CSE(f *Func) {
+	idom := dominators(f)
+	children := make(map[*Block][]*Block)
+	for _, b := range f.Blocks {
+		if d := idom[b]; d != nil {
+			children[d] = append(children[d], b)
+		}
+	}
+	available := make(map[string]*Value)
+	var walk func(b *Block)
+	walk = func(b *Block) {
+		var added []string
+		for _, v := range append([]*Value(nil), b.Values...) {
+			if !ops[v.Op].pure {
+				continue
+			}
+			k := key(v)
+			if w, ok := available[k]; ok {
+				f.replace(v, w)
+				continue
+			}
+			available[k] = v
+			added = append(added, k)
+		}
+		for _, c := range children[b] {
+			walk(c)
+		}
+		for _, k := range added {
+			delete(available, k)
+		}
+	}
+	walk(f.Entry())
+}
+
+// key identifies the operation of v, values of equal keys are equal
+func key(v *Value) string {
+	var out strings.Builder
+	out.WriteString(v.Op.String())
+	if obj, ok := v.Aux.(object.Object); ok {
+		// the type tells the number 1 from the string "1"
+		fmt.Fprintf(&out, " %s:%s", obj.Type(), auxString(obj))
+	} else if v.Aux != nil {
+		out.WriteString(" " + auxString(v.Aux))
+	}
+	for _, arg := range v.Args {
+		out.WriteString(" " + arg.String())
+	}
+	return out.String()
+}
@@ -0,0 +1,81 @@
+package ir
+
+// postorder returns the blocks reachable from the entry of f in
+// postorder. Successors are visited last to first, so the reverse
+// postorder lists the first successor of a branch before the second.
+func postorder(f *Func) []*Block {
+	var order []*Block
+	seen := make(map[*Block]bool)
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		seen[b] = true
+		for i := len(b.Succs) - 1; i >= 0; i-- {
+			if s := b.Succs[i]; !seen[s] {
+				visit(s)
+			}
+		}
+		order = append(order, b)
+	}
+	visit(f.Entry())
+	return order
+}
+
+// dominators returns the immediate dominator of every block
+// reachable from the entry of f, the entry has none. It uses
+// the iterative algorithm of Cooper, Harvey and Kennedy.
+func dominators(f *Func) map[*Block]*Block {
+	order := postorder(f)
+	index := make(map[*Block]int, len(order))
+	for i, b := range order {
+		index[b] = i
+	}
+	entry := f.Entry()
+	idom := map[*Block]*Block{entry: entry}
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for index[a] < index[b] {
+				a = idom[a]
+			}
+			for index[b] < index[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(order) - 1; i >= 0; i-- {
+			b := order[i]
+			if b == entry {
+				continue
+			}
+			var dom *Block
+			for _, p := range b.Preds {
+				if _, ok := idom[p]; !ok {
+					continue
+				}
+				if dom == nil {
+					dom = p
+				} else {
+					dom = intersect(p, dom)
+				}
+			}
+			if idom[b] != dom {
+				idom[b] = dom
+				changed = true
+			}
+		}
+	}
+	idom[entry] = nil
+	return idom
+}
+
+// dominates returns true if every path from the entry to b passes a
+func dominates(idom map[*Block]*Block, a, b *Block) bool {
+	for ; b != nil; b = idom[b] {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
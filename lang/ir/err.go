@@ -0,0 +1,27 @@
+package ir
+
+import (
+	"fmt"
+
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// BuildErr describes an error encountered while building the IR
+type BuildErr struct {
+	token.T
+	Msg  string
+	Line string
+}
+
+// newBuildErr formats an error with sourceName, line, col and message.
+func newBuildErr(b *B, t token.T, msg string, args ...any) BuildErr {
+	l := t.HighlightErr(b.l.Line(t.Line))
+	m := fmt.Sprintf(msg, args...)
+	m = fmt.Sprintf("BuildError: %s at\n\t%s:L%d:C%d ------> %s",
+		m, b.sourceName, t.Line, t.Col, l)
+	return BuildErr{T: t, Msg: m, Line: l}
+}
+
+func berr(b *B, t token.T, msg string, args ...any) {
+	b.errs = append(b.errs, newBuildErr(b, t, msg, args...))
+}
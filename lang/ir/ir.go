@@ -0,0 +1,328 @@
+// Package ir is an intermediate representation of blue programs in
+// static single assignment form. Every function is a graph of basic
+// blocks, every Value is assigned once and a variable assigned in
+// several branches is merged by a phi at the start of the block where
+// the branches join.
+//
+// Locals and parameters that no closure captures are values. Globals
+// and captured variables live in memory and are accessed with loads
+// and stores, since a call may change them.
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/resolve"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// Op is the operation of a Value
+type Op byte
+
+const (
+	OpConst        Op = iota // the constant Aux
+	OpParam                  // the parameter Aux of the function
+	OpGiven                  // true if the caller gave the parameter argument
+	OpPhi                    // the argument of the predecessor control came from
+	OpCopy                   // the argument
+	OpNeg                    // -argument
+	OpNot                    // !argument
+	OpAdd                    // left + right
+	OpSub                    // left - right
+	OpMul                    // left * right
+	OpDiv                    // left / right
+	OpEqual                  // left == right
+	OpNotEqual               // left != right
+	OpLess                   // left < right
+	OpLessEqual              // left <= right
+	OpGreater                // left > right
+	OpGreaterEqual           // left >= right
+	OpNotNull                // true unless the argument is null
+	OpArray                  // array of the arguments
+	OpIndex                  // left[index]
+	OpRange                  // range of the bounds given by the Range Aux
+	OpBuiltin                // the builtin named Aux
+	OpGlobal                 // load the global symbol Aux
+	OpSetGlobal              // store the argument in the global symbol Aux
+	OpLoad                   // load the captured symbol Aux
+	OpStore                  // store the argument in the captured symbol Aux
+	OpClosure                // closure of the function Aux
+	OpCall                   // call the first argument with the rest
+	OpIter                   // iterator of the argument
+	OpMore                   // true if the iterator has another value
+	OpNext                   // advance the iterator and return its value
+	OpJump                   // continue at the successor
+	OpBranch                 // continue at the first successor if the argument is truthy, else the second
+	OpReturn                 // return the argument
+)
+
+type opInfo struct {
+	name string
+	// args is the number of arguments, -1 if variadic
+	args int
+	// pure values only depend on their Aux and arguments
+	pure bool
+	// successors of a terminator, -1 if not a terminator
+	succs int
+}
+
+var ops = [...]opInfo{
+	OpConst:        {"const", 0, true, -1},
+	OpParam:        {"param", 0, false, -1},
+	OpGiven:        {"given", 1, false, -1},
+	OpPhi:          {"phi", -1, false, -1},
+	OpCopy:         {"copy", 1, false, -1},
+	OpNeg:          {"neg", 1, true, -1},
+	OpNot:          {"not", 1, true, -1},
+	OpAdd:          {"add", 2, true, -1},
+	OpSub:          {"sub", 2, true, -1},
+	OpMul:          {"mul", 2, true, -1},
+	OpDiv:          {"div", 2, true, -1},
+	OpEqual:        {"eq", 2, true, -1},
+	OpNotEqual:     {"ne", 2, true, -1},
+	OpLess:         {"lt", 2, true, -1},
+	OpLessEqual:    {"le", 2, true, -1},
+	OpGreater:      {"gt", 2, true, -1},
+	OpGreaterEqual: {"ge", 2, true, -1},
+	OpNotNull:      {"notnull", 1, true, -1},
+	OpArray:        {"array", -1, false, -1},
+	OpIndex:        {"index", 2, false, -1},
+	OpRange:        {"range", -1, false, -1},
+	OpBuiltin:      {"builtin", 0, true, -1},
+	OpGlobal:       {"global", 0, false, -1},
+	OpSetGlobal:    {"setglobal", 1, false, -1},
+	OpLoad:         {"load", 0, false, -1},
+	OpStore:        {"store", 1, false, -1},
+	OpClosure:      {"closure", 0, false, -1},
+	OpCall:         {"call", -1, false, -1},
+	OpIter:         {"iter", 1, false, -1},
+	OpMore:         {"more", 1, false, -1},
+	OpNext:         {"next", 1, false, -1},
+	OpJump:         {"jump", 0, false, 1},
+	OpBranch:       {"branch", 1, false, 2},
+	OpReturn:       {"return", 1, false, 0},
+}
+
+func (op Op) String() string {
+	if int(op) < len(ops) {
+		return ops[op].name
+	}
+	return fmt.Sprintf("op(%d)", op)
+}
+
+// Terminator returns true if op ends a block
+func (op Op) Terminator() bool {
+	return int(op) < len(ops) && ops[op].succs >= 0
+}
+
+// Range describes the bounds given to OpRange, the
+// arguments are the bounds given in the order start, end, step
+type Range struct {
+	Start, End, Step, Inclusive bool
+}
+
+// Bounds returns the number of arguments of the range
+func (r Range) Bounds() int {
+	n := 0
+	for _, b := range []bool{r.Start, r.End, r.Step} {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+func (r Range) String() string {
+	var parts []string
+	for _, b := range []struct {
+		set  bool
+		name string
+	}{{r.Start, "start"}, {r.End, "end"}, {r.Step, "step"}, {r.Inclusive, "inclusive"}} {
+		if b.set {
+			parts = append(parts, b.name)
+		}
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// Value is the result of an operation, it is assigned once
+type Value struct {
+	ID int
+	Op
+	Args []*Value
+	// Aux is the constant, name, symbol, range or function of the operation
+	Aux   any
+	Block *Block
+	// Token the value was built from
+	Token token.T
+}
+
+func (v *Value) String() string {
+	return "v" + strconv.Itoa(v.ID)
+}
+
+// LongString returns the definition of v i.e v2 = add v0 v1
+func (v *Value) LongString() string {
+	var out strings.Builder
+	if !v.Op.Terminator() && v.Op != OpSetGlobal && v.Op != OpStore {
+		out.WriteString(v.String() + " = ")
+	}
+	out.WriteString(v.Op.String())
+	if v.Aux != nil {
+		out.WriteString(" " + auxString(v.Aux))
+	}
+	for _, arg := range v.Args {
+		out.WriteString(" " + arg.String())
+	}
+	if v.Op.Terminator() {
+		for _, s := range v.Block.Succs {
+			out.WriteString(" " + s.String())
+		}
+	}
+	return out.String()
+}
+
+func auxString(aux any) string {
+	switch aux := aux.(type) {
+	case *object.String:
+		return strconv.Quote(aux.Value)
+	case object.Object:
+		return aux.String()
+	case *resolve.Symbol:
+		return aux.Name
+	case *Func:
+		return aux.Name
+	}
+	return fmt.Sprint(aux)
+}
+
+// Block is a sequence of values executed in order
+type Block struct {
+	ID int
+	// Values of the block, phis first and a terminator last
+	Values []*Value
+	Preds  []*Block
+	Succs  []*Block
+}
+
+func (b *Block) String() string {
+	return "b" + strconv.Itoa(b.ID)
+}
+
+// terminated returns true if b ends with a terminator
+func (b *Block) terminated() bool {
+	return len(b.Values) > 0 && b.Values[len(b.Values)-1].Op.Terminator()
+}
+
+// remove deletes v from b
+func (b *Block) remove(v *Value) {
+	for i, w := range b.Values {
+		if w == v {
+			b.Values = append(b.Values[:i], b.Values[i+1:]...)
+			return
+		}
+	}
+}
+
+// Func is a function of the program
+type Func struct {
+	// Name is unique within the program
+	Name string
+	// Params are the OpParam values of the entry block
+	Params []*Value
+	// Blocks[0] is the entry block
+	Blocks []*Block
+
+	nextValue int
+	nextBlock int
+}
+
+// Entry returns the block the function starts in
+func (f *Func) Entry() *Block {
+	return f.Blocks[0]
+}
+
+// newBlock appends an empty block to f
+func (f *Func) newBlock() *Block {
+	b := &Block{ID: f.nextBlock}
+	f.nextBlock++
+	f.Blocks = append(f.Blocks, b)
+	return b
+}
+
+// newValue returns a value which is not yet part of a block
+func (f *Func) newValue(t token.T, op Op, aux any, args ...*Value) *Value {
+	v := &Value{ID: f.nextValue, Op: op, Args: args, Aux: aux, Token: t}
+	f.nextValue++
+	return v
+}
+
+// replace rewrites every use of old to with and removes old
+func (f *Func) replace(old, with *Value) {
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			for i, arg := range v.Args {
+				if arg == old {
+					v.Args[i] = with
+				}
+			}
+		}
+	}
+	old.Block.remove(old)
+}
+
+func (f *Func) String() string {
+	var out strings.Builder
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = auxString(p.Aux)
+	}
+	fmt.Fprintf(&out, "fn %s(%s) {\n", f.Name, strings.Join(params, ", "))
+	for _, b := range f.Blocks {
+		out.WriteString(b.String() + ":")
+		if len(b.Preds) > 0 {
+			out.WriteString(" <-")
+			for _, p := range b.Preds {
+				out.WriteString(" " + p.String())
+			}
+		}
+		out.WriteString("\n")
+		for _, v := range b.Values {
+			out.WriteString("\t" + v.LongString() + "\n")
+		}
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// Program holds the functions of a program, the first is the
+// top level which returns the value of its last statement
+type Program struct {
+	Funcs []*Func
+}
+
+// Main returns the top level of p
+func (p *Program) Main() *Func {
+	return p.Funcs[0]
+}
+
+// Run applies passes to every function of p in order
+func (p *Program) Run(passes ...func(*Func)) {
+	for _, pass := range passes {
+		for _, f := range p.Funcs {
+			pass(f)
+		}
+	}
+}
+
+// String returns the textual dump of p
+func (p *Program) String() string {
+	funcs := make([]string, len(p.Funcs))
+	for i, f := range p.Funcs {
+		funcs[i] = f.String()
+	}
+	return strings.Join(funcs, "\n")
+}
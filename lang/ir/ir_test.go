@@ -0,0 +1,394 @@
+package ir
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/parser"
+	"github.com/lindeneg/blue/lang/resolve"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"fn f(n) { let s = 0; for const i = 0..n { s = s + i; } return s; }",
+			`fn f(n) {
+b0:
+	v0 = param n
+	v1 = copy v0
+	v2 = const 0
+	v3 = copy v2
+	v4 = const 0
+	v5 = range [start end] v4 v1
+	v6 = iter v5
+	jump b1
+b1: <- b0 b2
+	v8 = phi v3 v14
+	v9 = more v6
+	branch v9 b2 b3
+b2: <- b1
+	v11 = next v6
+	v12 = copy v11
+	v13 = add v8 v12
+	v14 = copy v13
+	v15 = const null
+	jump b1
+b3: <- b1
+	v17 = const null
+	return v8
+}
+`,
+		},
+		{
+			"fn f(n) { let a = n; if n > 1 { a = 1; } elif n > 0 { return 0; } return a; }",
+			`fn f(n) {
+b0:
+	v0 = param n
+	v1 = copy v0
+	v2 = copy v1
+	v3 = const 1
+	v4 = gt v1 v3
+	branch v4 b1 b2
+b1: <- b0
+	v6 = const 1
+	v7 = copy v6
+	v8 = const null
+	jump b5
+b2: <- b0
+	v10 = const 0
+	v11 = gt v1 v10
+	branch v11 b3 b4
+b3: <- b2
+	v13 = const 0
+	return v13
+b4: <- b2
+	v15 = const null
+	jump b5
+b5: <- b1 b4
+	v17 = phi v8 v15
+	v18 = phi v7 v2
+	return v18
+}
+`,
+		},
+		{
+			"fn f(n = 1) { let c = 0; let g = fn() { c = c + n; }; g(); return c ?? 0; }",
+			`fn f(n) {
+b0:
+	v0 = param n
+	v1 = given v0
+	branch v1 b2 b1
+b1: <- b0
+	v3 = const 1
+	jump b2
+b2: <- b0 b1
+	v5 = phi v0 v3
+	store n v5
+	v7 = const 0
+	store c v7
+	v9 = closure anon
+	v10 = copy v9
+	v11 = call v10
+	v12 = load c
+	v13 = notnull v12
+	branch v13 b4 b3
+b3: <- b2
+	v15 = const 0
+	jump b4
+b4: <- b2 b3
+	v17 = phi v12 v15
+	return v17
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		p := buildProgram(t, tt.input)
+		if got := p.Funcs[1].String(); got != tt.expected {
+			t.Errorf("wrong ir of %q\nwant=\n%s\ngot=\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBuildProgram(t *testing.T) {
+	input := "let f = fn() { return fn() { 1; }; }; fn() {};"
+	expected := `fn main() {
+b0:
+	v0 = closure anon
+	setglobal f v0
+	v2 = closure anon#3
+	return v2
+}
+
+fn anon() {
+b0:
+	v0 = closure anon#2
+	return v0
+}
+
+fn anon#2() {
+b0:
+	v0 = const 1
+	v1 = const null
+	return v1
+}
+
+fn anon#3() {
+b0:
+	v0 = const null
+	v1 = const null
+	return v1
+}
+`
+	if got := buildProgram(t, input).String(); got != expected {
+		t.Errorf("wrong ir\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn f() { yield 1; }", "ir does not support generators"},
+		{"async fn f() {}", "ir does not support async functions"},
+		{"struct P { x } fn (p P) f() {}", `ir does not support "struct"`},
+		{"fn f(a) {} f(a: 1);", `ir does not support "a"`},
+		{"let a = [1]; [...a];", `ir does not support "..."`},
+		{"let a = [1]; a?[0];", `ir does not support "?["`},
+		{"try { 1; } catch { 2; }", `ir does not support "try"`},
+	}
+	for _, tt := range tests {
+		_, b := build(t, tt.input, "ir-error")
+		if !b.HasErrors() {
+			t.Errorf("expected errors building %q", tt.input)
+			continue
+		}
+		if got := b.Errors()[0].Msg; !strings.Contains(got, tt.expected) {
+			t.Errorf("wrong error of %q, want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCopyPropagation(t *testing.T) {
+	p := buildProgram(t, "fn f(n) { let a = n; if n > 1 { a = 1; } elif n > 0 { return 0; } return a; }")
+	p.Run(CopyPropagation)
+	expected := `fn f(n) {
+b0:
+	v0 = param n
+	v3 = const 1
+	v4 = gt v0 v3
+	branch v4 b1 b2
+b1: <- b0
+	v6 = const 1
+	v8 = const null
+	jump b5
+b2: <- b0
+	v10 = const 0
+	v11 = gt v0 v10
+	branch v11 b3 b4
+b3: <- b2
+	v13 = const 0
+	return v13
+b4: <- b2
+	v15 = const null
+	jump b5
+b5: <- b1 b4
+	v17 = phi v8 v15
+	v18 = phi v6 v0
+	return v18
+}
+`
+	if got := p.Funcs[1].String(); got != expected {
+		t.Errorf("wrong ir\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+	if err := p.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCSE(t *testing.T) {
+	p := buildProgram(t, "fn f(a, b) { let x = (a + b) * 2; if a { return (a + b) * 2; } let y = a + b; return x - y; }")
+	p.Run(CopyPropagation, CSE)
+	expected := `fn f(a, b) {
+b0:
+	v0 = param a
+	v1 = param b
+	v4 = add v0 v1
+	v5 = const 2
+	v6 = mul v4 v5
+	branch v0 b1 b2
+b1: <- b0
+	return v6
+b2: <- b0
+	v13 = const null
+	jump b3
+b3: <- b2
+	v21 = sub v6 v4
+	return v21
+}
+`
+	if got := p.Funcs[1].String(); got != expected {
+		t.Errorf("wrong ir\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+	if err := p.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCSEDominance(t *testing.T) {
+	p := buildProgram(t, `fn f(a, b) {
+	let x = 0;
+	if a { x = a * b; } else { x = a * b; }
+	return x + a * b + ("1" + a) + (1 + a);
+}`)
+	p.Run(CopyPropagation, CSE)
+	count := func(op Op) int {
+		n := 0
+		for _, b := range p.Funcs[1].Blocks {
+			for _, v := range b.Values {
+				if v.Op == op {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	// neither branch dominates the other or the join
+	if got := count(OpMul); got != 3 {
+		t.Errorf("wrong number of mul, want=3, got=%d", got)
+	}
+	// the number 1 and the string "1" differ
+	if got := count(OpConst); got != 5 {
+		t.Errorf("wrong number of const, want=5, got=%d\n%s", got, p.Funcs[1])
+	}
+	if err := p.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPassesVerify(t *testing.T) {
+	inputs := []string{
+		"let x = 1; { let y = x; y = y + 1; y; }",
+		"fn f(n) { if n < 2 { return n; } return f(n - 1) + f(n - 2); } f(10);",
+		"fn f(n) { let s = 0; for const i = 0..n { if i > 5 { return s; } s = s + i; } return s; }",
+		"fn f(n) { let a = 0; for const i = n { for const j = i { a = a + j; } } return a; }",
+		"fn f(n) { return 1; n = 2; return n; }",
+		"fn f(n) { let a = n; let b = a; let c = b; return a == c ? a : b; }",
+		"fn f(n) { let g = fn() { n = n + 1; return n; }; for const i = 0..3 { g(); } return n; }",
+		"fn f(...rest) { let a = [rest[0], len(rest), 0..=2 step 1]; return a; }",
+		"fn f(a = 1, b = a + 1) { return [a, b, -a, !b]; }",
+		"fn f(n) { let x = n; for const i = 0..n { x = x; } return x ?? n; }",
+	}
+	for _, input := range inputs {
+		p := buildProgram(t, input)
+		p.Run(CopyPropagation)
+		if err := p.Verify(); err != nil {
+			t.Errorf("copy propagation of %q: %s", input, err)
+		}
+		p.Run(CSE)
+		if err := p.Verify(); err != nil {
+			t.Errorf("cse of %q: %s", input, err)
+		}
+		for _, f := range p.Funcs {
+			for _, b := range f.Blocks {
+				for _, v := range b.Values {
+					if copySource(v) != nil {
+						t.Errorf("%q: %s is a copy after copy propagation", input, v.LongString())
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	input := "fn f(n) { let a = n + 1; if n { a = 2; } return a; }"
+	tests := []struct {
+		corrupt  func(f *Func)
+		expected string
+	}{
+		{func(f *Func) {
+			b := f.Blocks[1]
+			b.Values = b.Values[:len(b.Values)-1]
+		}, "b1: does not end with a terminator"},
+		{func(f *Func) {
+			b := f.Entry()
+			b.Values[2], b.Values[3] = b.Values[3], b.Values[2]
+		}, "b0: v3 uses v2 before it is defined"},
+		{func(f *Func) {
+			phi := f.Blocks[len(f.Blocks)-1].Values[0]
+			phi.Args = phi.Args[:1]
+		}, "b3: phi v12: has 1 arguments, want 2"},
+		{func(f *Func) {
+			two := f.Blocks[1].Values[0]
+			ret := f.Blocks[len(f.Blocks)-1].Values[2]
+			ret.Args[0] = two
+		}, "b3: v14 uses v6 which does not dominate it"},
+		{func(f *Func) {
+			f.Blocks[1].Preds = nil
+		}, "b0: successor b1 does not list it as a predecessor"},
+		{func(f *Func) {
+			f.Blocks = append(f.Blocks, &Block{ID: 9, Values: []*Value{{ID: 99, Op: OpJump}}, Succs: []*Block{f.Blocks[1]}})
+			f.Blocks[len(f.Blocks)-1].Values[0].Block = f.Blocks[len(f.Blocks)-1]
+		}, "b9: successor b1 does not list it as a predecessor"},
+		{func(f *Func) {
+			f.Entry().Values[3].Args = append(f.Entry().Values[3].Args, f.Params[0])
+		}, "b0: add v3: has 3 arguments, want 2"},
+		{func(f *Func) {
+			f.Entry().Values[1].ID = 0
+		}, "v0 is defined twice"},
+		{func(f *Func) {
+			f.Entry().Values[1].Args = []*Value{{ID: 42}}
+		}, "b0: v1 uses v42 which is not defined"},
+	}
+	for i, tt := range tests {
+		p := buildProgram(t, input)
+		if err := p.Verify(); err != nil {
+			t.Fatalf("test %d: %s", i, err)
+		}
+		tt.corrupt(p.Funcs[1])
+		err := p.Verify()
+		if err == nil {
+			t.Errorf("test %d: expected an error\n%s", i, p.Funcs[1])
+			continue
+		}
+		if want := `fn "f": ` + tt.expected; err.Error() != want {
+			t.Errorf("test %d: wrong error, want=%q, got=%q\n%s", i, want, err, p.Funcs[1])
+		}
+	}
+}
+
+// buildProgram builds input and fails unless it verifies
+func buildProgram(t *testing.T, input string) *Program {
+	t.Helper()
+	p, b := build(t, input, "ir-test")
+	for _, err := range b.Errors() {
+		t.Fatal(err.Msg)
+	}
+	if err := p.Verify(); err != nil {
+		t.Fatalf("%q: %s\n%s", input, err, p)
+	}
+	return p
+}
+
+func build(t *testing.T, input, name string) (*Program, *B) {
+	t.Helper()
+	l := lexer.FromString(input)
+	p := parser.New(l, name)
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Fatal(err.Msg)
+	}
+	r := resolve.New(l, name)
+	table := r.Resolve(program)
+	for _, err := range r.Errors() {
+		t.Fatal(err.Msg)
+	}
+	b := New(l, name)
+	return b.Build(program, table), b
+}
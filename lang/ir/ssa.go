@@ -0,0 +1,72 @@
+package ir
+
+import (
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/resolve"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// writeVariable records v as the value of sym at the end of block
+func (b *B) writeVariable(sym *resolve.Symbol, block *Block, v *Value) {
+	defs, ok := b.fn.defs[sym]
+	if !ok {
+		defs = make(map[*Block]*Value)
+		b.fn.defs[sym] = defs
+	}
+	defs[block] = v
+}
+
+// readVariable returns the value of sym at the end of block
+func (b *B) readVariable(t token.T, sym *resolve.Symbol, block *Block) *Value {
+	if v, ok := b.fn.defs[sym][block]; ok {
+		return v
+	}
+	var v *Value
+	switch {
+	case !b.fn.sealed[block]:
+		// the operands are added once all predecessors are known
+		v = b.phi(t, block)
+		incomplete, ok := b.fn.incomplete[block]
+		if !ok {
+			incomplete = make(map[*resolve.Symbol]*Value)
+			b.fn.incomplete[block] = incomplete
+		}
+		incomplete[sym] = v
+	case len(block.Preds) == 0:
+		// only unreachable blocks and the entry have no predecessors
+		v = b.fn.f.newValue(t, OpConst, object.Nil)
+		v.Block = block
+		i := 0
+		for i < len(block.Values) && block.Values[i].Op == OpPhi {
+			i++
+		}
+		block.Values = append(block.Values[:i], append([]*Value{v}, block.Values[i:]...)...)
+	case len(block.Preds) == 1:
+		v = b.readVariable(t, sym, block.Preds[0])
+	default:
+		// the phi is recorded first to break cycles through loops
+		v = b.phi(t, block)
+		b.writeVariable(sym, block, v)
+		b.addPhiOperands(t, sym, v)
+	}
+	b.writeVariable(sym, block, v)
+	return v
+}
+
+// addPhiOperands sets the operands of phi to the
+// values of sym at the end of the predecessors
+func (b *B) addPhiOperands(t token.T, sym *resolve.Symbol, phi *Value) {
+	for _, pred := range phi.Block.Preds {
+		phi.Args = append(phi.Args, b.readVariable(t, sym, pred))
+	}
+}
+
+// seal marks that all predecessors of block are
+// known and completes the phis placed in it before
+func (b *B) seal(block *Block) {
+	for sym, phi := range b.fn.incomplete[block] {
+		b.addPhiOperands(phi.Token, sym, phi)
+	}
+	delete(b.fn.incomplete, block)
+	b.fn.sealed[block] = true
+}
@@ -0,0 +1,174 @@
+package ir
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Verify checks that every function of p is well formed
+func (p *Program) Verify() error {
+	names := make(map[string]bool, len(p.Funcs))
+	for _, f := range p.Funcs {
+		if names[f.Name] {
+			return fmt.Errorf("fn %q is declared twice", f.Name)
+		}
+		names[f.Name] = true
+		if err := f.Verify(); err != nil {
+			return fmt.Errorf("fn %q: %s", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Verify checks that f is well formed: every block is reachable
+// and ends with a terminator matching its successors, the edges
+// agree, every value is defined once and every use of a value is
+// dominated by its definition.
+func (f *Func) Verify() error {
+	if len(f.Blocks) == 0 {
+		return errors.New("has no blocks")
+	}
+	if len(f.Entry().Preds) > 0 {
+		return fmt.Errorf("entry %s has predecessors", f.Entry())
+	}
+	blocks := make(map[*Block]bool, len(f.Blocks))
+	defined := make(map[*Value]bool)
+	ids := make(map[int]bool)
+	for _, b := range f.Blocks {
+		if blocks[b] {
+			return fmt.Errorf("%s is listed twice", b)
+		}
+		blocks[b] = true
+		for _, v := range b.Values {
+			if defined[v] || ids[v.ID] {
+				return fmt.Errorf("%s is defined twice", v)
+			}
+			defined[v] = true
+			ids[v.ID] = true
+		}
+	}
+	for _, p := range f.Params {
+		if !defined[p] || p.Op != OpParam || p.Block != f.Entry() {
+			return fmt.Errorf("parameter %s is not defined in the entry", p)
+		}
+	}
+	for _, b := range f.Blocks {
+		if err := verifyBlock(b, blocks); err != nil {
+			return fmt.Errorf("%s: %s", b, err)
+		}
+	}
+	idom := dominators(f)
+	for _, b := range f.Blocks {
+		if _, ok := idom[b]; !ok {
+			return fmt.Errorf("%s is unreachable", b)
+		}
+	}
+	for _, b := range f.Blocks {
+		for i, v := range b.Values {
+			for j, arg := range v.Args {
+				if !defined[arg] {
+					return fmt.Errorf("%s: %s uses %s which is not defined", b, v, arg)
+				}
+				use := b
+				if v.Op == OpPhi {
+					use = b.Preds[j]
+				} else if arg.Block == b && indexOf(b.Values, arg) >= i {
+					return fmt.Errorf("%s: %s uses %s before it is defined", b, v, arg)
+				}
+				if !dominates(idom, arg.Block, use) {
+					return fmt.Errorf("%s: %s uses %s which does not dominate it", b, v, arg)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// verifyBlock checks the values and edges of b, blocks are those of the function
+func verifyBlock(b *Block, blocks map[*Block]bool) error {
+	if !b.terminated() {
+		return errors.New("does not end with a terminator")
+	}
+	phis := true
+	for i, v := range b.Values {
+		if v.Block != b {
+			return fmt.Errorf("%s belongs to %s", v, v.Block)
+		}
+		if int(v.Op) >= len(ops) {
+			return fmt.Errorf("%s has unknown %s", v, v.Op)
+		}
+		if v.Op.Terminator() && i < len(b.Values)-1 {
+			return fmt.Errorf("%s %s is not last", v.Op, v)
+		}
+		if v.Op == OpPhi && !phis {
+			return fmt.Errorf("phi %s follows other values", v)
+		}
+		phis = v.Op == OpPhi
+		if err := verifyArgs(v); err != nil {
+			return fmt.Errorf("%s %s: %s", v.Op, v, err)
+		}
+	}
+	term := b.Values[len(b.Values)-1]
+	if want := ops[term.Op].succs; len(b.Succs) != want {
+		return fmt.Errorf("%s has %d successors, want %d", term.Op, len(b.Succs), want)
+	}
+	for _, s := range b.Succs {
+		if !blocks[s] {
+			return fmt.Errorf("successor %s is not part of the function", s)
+		}
+		if count(s.Preds, b) != count(b.Succs, s) {
+			return fmt.Errorf("successor %s does not list it as a predecessor", s)
+		}
+	}
+	for _, p := range b.Preds {
+		if !blocks[p] {
+			return fmt.Errorf("predecessor %s is not part of the function", p)
+		}
+		if count(p.Succs, b) != count(b.Preds, p) {
+			return fmt.Errorf("predecessor %s does not list it as a successor", p)
+		}
+	}
+	return nil
+}
+
+// verifyArgs checks the number of arguments and the Aux of v
+func verifyArgs(v *Value) error {
+	want := ops[v.Op].args
+	switch v.Op {
+	case OpPhi:
+		want = len(v.Block.Preds)
+	case OpRange:
+		r, ok := v.Aux.(Range)
+		if !ok {
+			return errors.New("has no range")
+		}
+		want = r.Bounds()
+	case OpCall:
+		if len(v.Args) == 0 {
+			return errors.New("has no callee")
+		}
+	}
+	if want >= 0 && len(v.Args) != want {
+		return fmt.Errorf("has %d arguments, want %d", len(v.Args), want)
+	}
+	return nil
+}
+
+func indexOf(values []*Value, v *Value) int {
+	for i, w := range values {
+		if w == v {
+			return i
+		}
+	}
+	return -1
+}
+
+func count(blocks []*Block, b *Block) int {
+	n := 0
+	for _, c := range blocks {
+		if c == b {
+			n++
+		}
+	}
+	return n
+}
@@ -74,6 +74,8 @@ func (l *L) NextToken() token.T {
 	case '|':
 		if l.peek() == '|' {
 			tok = l.tokenRange(token.OR, 1)
+		} else if l.peek() == '>' {
+			tok = l.tokenRange(token.PIPE, 1)
 		} else {
 			tok = l.token(token.UNKNOWN, l.char)
 		}
@@ -83,6 +85,15 @@ func (l *L) NextToken() token.T {
 		} else {
 			tok = l.token(token.UNKNOWN, l.char)
 		}
+	case '?':
+		switch {
+		case l.peek() == '?':
+			tok = l.tokenRange(token.NULLISH, 1)
+		case l.peek() == '.':
+			tok = l.tokenRange(token.QDOT, 1)
+		default:
+			tok = l.token(token.QUESTION, l.char)
+		}
 	case ';':
 		tok = l.token(token.SCOLON, l.char)
 	case ',':
@@ -110,6 +121,16 @@ func (l *L) NextToken() token.T {
 		tok = l.token(token.LBRACKET, l.char)
 	case ']':
 		tok = l.token(token.RBRACKET, l.char)
+	case '.':
+		if l.peek() == '.' && l.peekN(1) == '.' {
+			tok = l.tokenRange(token.ELLIPSIS, 2)
+		} else if l.peek() == '.' && l.peekN(1) == '=' {
+			tok = l.tokenRange(token.DOTDOTEQ, 2)
+		} else if l.peek() == '.' {
+			tok = l.tokenRange(token.DOTDOT, 1)
+		} else {
+			tok = l.token(token.DOT, l.char)
+		}
 	case '{':
 		l.scope++
 		tok = l.token(token.LBRACE, l.char)
@@ -177,7 +198,7 @@ func (l *L) handleIdentifier(tok token.T) token.T {
 
 // ignoreWhitespace ignores spaces, tabs, newlines and carriage return
 func (l *L) ignoreWhitespace() {
-	for l.char == ' ' || l.char == '\t' || l.char == '\n' || l.char == '\r' {
+	for isWhitespace(l.char) {
 		l.read()
 	}
 }
@@ -223,10 +244,16 @@ func (l *L) read() {
 
 // peek read char without incrementing the next position
 func (l *L) peek() byte {
-	if l.nextIdx >= len(l.source) {
+	return l.peekN(0)
+}
+
+// peekN reads the char n positions after
+// the next position without incrementing it
+func (l *L) peekN(n int) byte {
+	if l.nextIdx+n >= len(l.source) {
 		return 0
 	}
-	return l.source[l.nextIdx]
+	return l.source[l.nextIdx+n]
 }
 
 // string reads a string until terminator byte is seen
@@ -297,6 +324,12 @@ func isIdentifier(char byte) bool {
 	return isIdentifierStart(char) || (char >= '0' && char <= '9')
 }
 
+// isWhitespace checks if a byte is a space,
+// tab, newline or carriage return
+func isWhitespace(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\n' || char == '\r'
+}
+
 // isDigit checks if a byte is a digit
 func isDigit(char byte) bool {
 	return char >= '0' && char <= '9'
@@ -6,6 +6,32 @@ import (
 	"github.com/lindeneg/blue/lang/token"
 )
 
+// TestQuestionSpacing checks that whitespace around '?' does not
+// change its token, the parser tells a ternary from a postfix ?
+// or from the '?[' of an optional index
+func TestQuestionSpacing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Type
+	}{
+		{"c? a : b", []token.Type{token.IDENTIFIER, token.QUESTION, token.IDENTIFIER, token.COLON, token.IDENTIFIER}},
+		{"c ?a:b", []token.Type{token.IDENTIFIER, token.QUESTION, token.IDENTIFIER, token.COLON, token.IDENTIFIER}},
+		{"a ?[0]", []token.Type{token.IDENTIFIER, token.QUESTION, token.LBRACKET, token.INT, token.RBRACKET}},
+		{"a?[0]", []token.Type{token.IDENTIFIER, token.QUESTION, token.LBRACKET, token.INT, token.RBRACKET}},
+	}
+	for _, tt := range tests {
+		l := FromString(tt.input)
+		for i, want := range tt.expected {
+			if tok := l.NextToken(); tok.Type != want {
+				t.Errorf("%q: token %d has wrong type, want=%q, got=%q", tt.input, i, want, tok.Type)
+			}
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%q: expected EOF, got=%q", tt.input, tok.Type)
+		}
+	}
+}
+
 func TestNextToken(t *testing.T) {
 	input := `let x = 5;
 let y = 10;
@@ -15,6 +41,13 @@ const x3 = 42.89;
 fn add(a, b) { return a + b; }
 
 const result = add(x, y);
+add(...arr);
+add(x)?;
+x ? a : b ?? c?.d?[0];
+xs |> f(y);
+0..10 step 2; 1.5..=x[..5];
+struct P { x } p.x;
+import "m" as m; export yield spawn select async await
 
 fn foo() {
     if x > y && result < 10 {
@@ -101,6 +134,78 @@ null
 		{token.RPAREN, ")"},
 		{token.SCOLON, ";"},
 
+		{token.IDENTIFIER, "add"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENTIFIER, "arr"},
+		{token.RPAREN, ")"},
+		{token.SCOLON, ";"},
+
+		{token.IDENTIFIER, "add"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "x"},
+		{token.RPAREN, ")"},
+		{token.QUESTION, "?"},
+		{token.SCOLON, ";"},
+
+		{token.IDENTIFIER, "x"},
+		{token.QUESTION, "?"},
+		{token.IDENTIFIER, "a"},
+		{token.COLON, ":"},
+		{token.IDENTIFIER, "b"},
+		{token.NULLISH, "??"},
+		{token.IDENTIFIER, "c"},
+		{token.QDOT, "?."},
+		{token.IDENTIFIER, "d"},
+		{token.QUESTION, "?"},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.SCOLON, ";"},
+
+		{token.IDENTIFIER, "xs"},
+		{token.PIPE, "|>"},
+		{token.IDENTIFIER, "f"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "y"},
+		{token.RPAREN, ")"},
+		{token.SCOLON, ";"},
+
+		{token.INT, "0"},
+		{token.DOTDOT, ".."},
+		{token.INT, "10"},
+		{token.STEP, "step"},
+		{token.INT, "2"},
+		{token.SCOLON, ";"},
+		{token.FLOAT, "1.5"},
+		{token.DOTDOTEQ, "..="},
+		{token.IDENTIFIER, "x"},
+		{token.LBRACKET, "["},
+		{token.DOTDOT, ".."},
+		{token.INT, "5"},
+		{token.RBRACKET, "]"},
+		{token.SCOLON, ";"},
+		{token.STRUCT, "struct"},
+		{token.IDENTIFIER, "P"},
+		{token.LBRACE, "{"},
+		{token.IDENTIFIER, "x"},
+		{token.RBRACE, "}"},
+		{token.IDENTIFIER, "p"},
+		{token.DOT, "."},
+		{token.IDENTIFIER, "x"},
+		{token.SCOLON, ";"},
+		{token.IMPORT, "import"},
+		{token.STRING, "m"},
+		{token.AS, "as"},
+		{token.IDENTIFIER, "m"},
+		{token.SCOLON, ";"},
+		{token.EXPORT, "export"},
+		{token.YIELD, "yield"},
+		{token.SPAWN, "spawn"},
+		{token.SELECT, "select"},
+		{token.ASYNC, "async"},
+		{token.AWAIT, "await"},
+
 		{token.FN, "fn"},
 		{token.IDENTIFIER, "foo"},
 		{token.LPAREN, "("},
@@ -0,0 +1,42 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/parser"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// ImportErr describes an import that could not be loaded
+type ImportErr struct {
+	token.T
+	Msg  string
+	Line string
+}
+
+func (e *ImportErr) Error() string { return e.Msg }
+
+// newImportErr formats an error with sourceName, line, col and message.
+func newImportErr(l *lexer.L, sourceName string, t token.T, msg string, args ...any) *ImportErr {
+	line := t.HighlightErr(l.Line(t.Line))
+	m := fmt.Sprintf(msg, args...)
+	m = fmt.Sprintf("ImportError: %s at\n\t%s:L%d:C%d ------> %s",
+		m, sourceName, t.Line, t.Col, line)
+	return &ImportErr{T: t, Msg: m, Line: line}
+}
+
+// SourceErr holds the errors encountered while parsing a module
+type SourceErr struct {
+	Path string
+	Errs []parser.ParseErr
+}
+
+func (e *SourceErr) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Msg)
+	}
+	return strings.Join(msgs, "\n")
+}
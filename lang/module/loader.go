@@ -0,0 +1,164 @@
+package module
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/evaluator"
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/parser"
+)
+
+// Ext is added to import paths without an extension
+const Ext = ".blue"
+
+// Module is a parsed source file
+type Module struct {
+	Path    string
+	Program *ast.Program
+	// Imports in the order they appear in Program
+	Imports []*Import
+	// Exports are the names declared by export statements
+	Exports []string
+
+	// set once the module has been evaluated as an import
+	instance *object.Module
+	err      *object.Error
+}
+
+// Import links an import statement to the imported module
+type Import struct {
+	Statement *ast.ImportStatement
+	Module    *Module
+}
+
+// Loader loads modules from a file system. A module is parsed
+// and evaluated at most once, no matter how often it is imported.
+type Loader struct {
+	fsys    fs.FS
+	modules map[string]*Module
+	// paths of the modules currently being loaded, in import order
+	loading []string
+	// global encloses the frame of every module, so all
+	// modules of a program share one runtime for their tasks
+	global *object.Environment
+}
+
+// NewLoader creates a loader reading modules from fsys
+func NewLoader(fsys fs.FS) *Loader {
+	return &Loader{fsys: fsys, modules: make(map[string]*Module), global: object.NewEnvironment()}
+}
+
+// Load parses the module at name and every module it imports.
+// Import paths are relative to the directory of the importing module.
+func (ld *Loader) Load(name string) (*Module, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "load", Path: name, Err: fs.ErrInvalid}
+	}
+	return ld.load(name)
+}
+
+func (ld *Loader) load(name string) (*Module, error) {
+	if m, ok := ld.modules[name]; ok {
+		return m, nil
+	}
+	src, err := fs.ReadFile(ld.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	l := lexer.New(src)
+	p := parser.New(l, name)
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		return nil, &SourceErr{Path: name, Errs: p.Errors()}
+	}
+	m := &Module{Path: name, Program: program}
+	ld.loading = append(ld.loading, name)
+	defer func() { ld.loading = ld.loading[:len(ld.loading)-1] }()
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.ImportStatement:
+			target := resolvePath(name, stmt.Path.Value)
+			if !fs.ValidPath(target) {
+				return nil, newImportErr(l, name, stmt.Path.Token, "invalid import path %q", stmt.Path.Value)
+			}
+			if i := slices.Index(ld.loading, target); i >= 0 {
+				chain := append(slices.Clone(ld.loading[i:]), target)
+				return nil, newImportErr(l, name, stmt.Path.Token, "import cycle: %s", strings.Join(chain, " -> "))
+			}
+			dep, err := ld.load(target)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, newImportErr(l, name, stmt.Path.Token, "cannot import %q, %q does not exist", stmt.Path.Value, target)
+			}
+			if err != nil {
+				return nil, err
+			}
+			m.Imports = append(m.Imports, &Import{Statement: stmt, Module: dep})
+		case *ast.ExportStatement:
+			m.Exports = append(m.Exports, stmt.Names()...)
+		}
+	}
+	ld.modules[name] = m
+	return m, nil
+}
+
+// Eval evaluates m in a new global frame and returns the result.
+// Imported modules are evaluated first and bound to their aliases.
+func (ld *Loader) Eval(m *Module) object.Object {
+	_, result := ld.eval(m)
+	return result
+}
+
+// Run loads and evaluates the module at name
+func (ld *Loader) Run(name string) (object.Object, error) {
+	m, err := ld.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	return ld.Eval(m), nil
+}
+
+func (ld *Loader) eval(m *Module) (*object.Environment, object.Object) {
+	env := object.NewEnclosed(ld.global)
+	for _, imp := range m.Imports {
+		instance, err := ld.instantiate(imp.Module)
+		if err != nil {
+			return env, err
+		}
+		alias := imp.Statement.Alias
+		if !env.Declare(alias.Value, instance, true) {
+			return env, object.NewError(alias.Token, "%q is already declared in this scope", alias.Value)
+		}
+	}
+	return env, evaluator.Eval(m.Program, env)
+}
+
+// instantiate evaluates an imported module once
+// and returns the module object bound by importers
+func (ld *Loader) instantiate(m *Module) (*object.Module, *object.Error) {
+	if m.instance != nil || m.err != nil {
+		return m.instance, m.err
+	}
+	env, result := ld.eval(m)
+	if err, ok := result.(*object.Error); ok {
+		m.err = err
+		return nil, err
+	}
+	m.instance = &object.Module{Path: m.Path, Env: env, Exports: m.Exports}
+	return m.instance, nil
+}
+
+// resolvePath returns the path of the module imported as
+// imp by the module at from, adding Ext if imp has none
+func resolvePath(from, imp string) string {
+	target := path.Join(path.Dir(from), imp)
+	if path.Ext(target) == "" {
+		target += Ext
+	}
+	return target
+}
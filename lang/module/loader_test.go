@@ -0,0 +1,172 @@
+package module
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lindeneg/blue/lang/object"
+)
+
+func TestRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.blue": {Data: []byte(`import "lib/geometry" as geo;
+import "lib/math.blue" as math;
+const p = geo.Point(3, 4);
+[math.square(p.x), p.len(), geo.origin, math.pi]`)},
+		"lib/geometry.blue": {Data: []byte(`import "math" as math;
+export struct Point { x, y }
+fn (p Point) len() { return math.square(p.x) + math.square(p.y); }
+export const origin = Point(0, 0);`)},
+		"lib/math.blue": {Data: []byte(`export const pi = 3;
+export fn square(x) { return x * x; }
+fn cube(x) { return x * x * x; }`)},
+	}
+	result, err := NewLoader(fsys).Run("main.blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.String() != "[9, 25, Point{x: 0, y: 0}, 3]" {
+		t.Errorf("unexpected result, got=%q", result)
+	}
+}
+
+func TestLoadCachesModules(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.blue":   {Data: []byte(`import "a" as a; import "b" as b; a.xs == b.xs`)},
+		"a.blue":      {Data: []byte(`import "shared" as s; export const xs = s.xs;`)},
+		"b.blue":      {Data: []byte(`import "./shared" as s; export const xs = s.xs;`)},
+		"shared.blue": {Data: []byte(`export const xs = [1, 2];`)},
+	}
+	ld := NewLoader(fsys)
+	m, err := ld.Load("main.blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := m.Imports[0].Module, m.Imports[1].Module
+	if a.Imports[0].Module != b.Imports[0].Module {
+		t.Errorf("shared module was loaded twice")
+	}
+	if result := ld.Eval(m); result != object.True {
+		t.Errorf("shared module was evaluated twice, got=%s", result)
+	}
+	if len(a.Exports) != 1 || a.Exports[0] != "xs" {
+		t.Errorf("unexpected exports, got=%v", a.Exports)
+	}
+}
+
+func TestModulesShareRuntime(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.blue": {Data: []byte(`import "queue" as q;
+spawn q.produce(3);
+let r = [];
+for let x = q.c { r = [...r, x]; }
+r`)},
+		"queue.blue": {Data: []byte(`export const c = channel(1);
+export fn produce(n) { for let i = 0..n { c.send(i); } c.close(); }`)},
+	}
+	result, err := NewLoader(fsys).Run("main.blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.String() != "[0, 1, 2]" {
+		t.Errorf("unexpected result, got=%q", result)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		expected string
+	}{
+		{
+			"cycle",
+			fstest.MapFS{
+				"main.blue":  {Data: []byte(`import "lib/a" as a;`)},
+				"lib/a.blue": {Data: []byte(`import "b" as b;`)},
+				"lib/b.blue": {Data: []byte(`import "../main" as main;`)},
+			},
+			"ImportError: import cycle: main.blue -> lib/a.blue -> lib/b.blue -> main.blue at\n\tlib/b.blue:L1:C8",
+		},
+		{
+			"self",
+			fstest.MapFS{"main.blue": {Data: []byte(`import "main" as m;`)}},
+			"ImportError: import cycle: main.blue -> main.blue at\n\tmain.blue:L1:C8",
+		},
+		{
+			"missing",
+			fstest.MapFS{"main.blue": {Data: []byte("\nimport \"nope\" as n;")}},
+			`ImportError: cannot import "nope", "nope.blue" does not exist at` + "\n\tmain.blue:L2:C8",
+		},
+		{
+			"escape",
+			fstest.MapFS{"main.blue": {Data: []byte(`import "../up" as up;`)}},
+			`ImportError: invalid import path "../up" at` + "\n\tmain.blue:L1:C8",
+		},
+		{
+			"syntax",
+			fstest.MapFS{
+				"main.blue": {Data: []byte(`import "bad" as bad;`)},
+				"bad.blue":  {Data: []byte(`export 1;`)},
+			},
+			"ParseError: export must be followed by a let, const, fn or struct declaration at\n\tbad.blue:L1:C8",
+		},
+	}
+	for _, tt := range tests {
+		_, err := NewLoader(tt.fsys).Load("main.blue")
+		if err == nil {
+			t.Fatalf("%s: expected an error", tt.name)
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%s: unexpected error\nwant=%q\ngot=%q", tt.name, tt.expected, err)
+		}
+	}
+	if _, err := NewLoader(fstest.MapFS{}).Load("main.blue"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got=%v", err)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		expected string
+	}{
+		{
+			"unexported",
+			fstest.MapFS{
+				"main.blue": {Data: []byte(`import "m" as m; m.hidden`)},
+				"m.blue":    {Data: []byte(`const hidden = 1;`)},
+			},
+			`RuntimeError: module "m.blue" does not export "hidden" at L1:C20`,
+		},
+		{
+			"alias",
+			fstest.MapFS{
+				"main.blue": {Data: []byte(`import "m" as m; import "m" as m;`)},
+				"m.blue":    {Data: []byte(``)},
+			},
+			`RuntimeError: "m" is already declared in this scope at L1:C32`,
+		},
+		{
+			"import",
+			fstest.MapFS{
+				"main.blue": {Data: []byte(`import "m" as m; m.x`)},
+				"m.blue":    {Data: []byte(`export const x = 1 / 0;`)},
+			},
+			"RuntimeError: division by zero at L1:C20",
+		},
+	}
+	for _, tt := range tests {
+		result, err := NewLoader(tt.fsys).Run("main.blue")
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if result.String() != tt.expected {
+			t.Errorf("%s: unexpected result\nwant=%q\ngot=%q", tt.name, tt.expected, result)
+		}
+	}
+}
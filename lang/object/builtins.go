@@ -0,0 +1,61 @@
+package object
+
+import "fmt"
+
+// Builtins are native functions resolved
+// after all frames of the environment
+var Builtins = map[string]*Builtin{
+	"len": {Name: "len", Fn: builtinLen},
+	"ok":  {Name: "ok", Fn: builtinResult("ok", true)},
+	"err": {Name: "err", Fn: builtinResult("err", false)},
+
+	"map":    {Name: "map", Fn: builtinMap},
+	"filter": {Name: "filter", Fn: builtinFilter},
+	"take":   {Name: "take", Fn: builtinTake},
+	"zip":    {Name: "zip", Fn: builtinZip},
+
+	"channel": {Name: "channel", Fn: builtinChannel},
+}
+
+func builtinLen(_ Caller, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments to len, want=1, got=%d", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Array:
+		return &Number{Value: float64(len(arg.Elements))}, nil
+	case *String:
+		return &Number{Value: float64(len(arg.Value))}, nil
+	case *Dict:
+		return &Number{Value: float64(len(arg.Values))}, nil
+	}
+	return nil, fmt.Errorf("argument to len not supported, got %s", args[0].Type())
+}
+
+// builtinResult returns a builtin wrapping its argument in a Result
+func builtinResult(name string, ok bool) BuiltinFn {
+	return func(_ Caller, args ...Object) (Object, error) {
+		if len(args) > 1 {
+			return nil, fmt.Errorf("wrong number of arguments to %s, want=0 or 1, got=%d", name, len(args))
+		}
+		if len(args) == 0 {
+			return &Result{Ok: ok, Value: Nil}, nil
+		}
+		return &Result{Ok: ok, Value: args[0]}, nil
+	}
+}
+
+// builtinChannel creates a channel with an optional capacity
+func builtinChannel(_ Caller, args ...Object) (Object, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("wrong number of arguments to channel, want=0 or 1, got=%d", len(args))
+	}
+	if len(args) == 0 {
+		return &Channel{}, nil
+	}
+	n, ok := args[0].(*Number)
+	if !ok || n.Value < 0 || n.Value != float64(int(n.Value)) {
+		return nil, fmt.Errorf("capacity of channel must be a non-negative integer, got %s", args[0])
+	}
+	return &Channel{Cap: int(n.Value)}, nil
+}
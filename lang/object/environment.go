@@ -0,0 +1,169 @@
+package object
+
+// Binding is a named slot in an Environment.
+// Closures hold a reference to the Environment
+// that owns the Binding, so assignments made
+// through one closure are seen by all others.
+type Binding struct {
+	Value Object
+	Const bool
+}
+
+// Environment is a single frame in the chain of lexical
+// scopes. A new frame is created for every block and
+// function call, enclosing the frame it was created in.
+type Environment struct {
+	store map[string]*Binding
+	outer *Environment
+	// yield is set on the frame of a generator call
+	yield func(Object) bool
+	// runtime is set on the global frame once a program uses tasks
+	runtime *Runtime
+	// co is set on the frame of an async call
+	co *Coroutine
+	// loop is set on the global frame once a program calls an async function
+	loop *Loop
+}
+
+// NewEnvironment creates a new global frame
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]*Binding)}
+}
+
+// NewEnclosed creates a new frame enclosed by outer
+func NewEnclosed(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Outer returns the enclosing frame or nil if env is global
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Resolve searches the chain of frames for name,
+// starting at e and returns its Binding if found
+func (e *Environment) Resolve(name string) (*Binding, bool) {
+	for env := e; env != nil; env = env.outer {
+		if b, ok := env.store[name]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns the value bound to name
+func (e *Environment) Get(name string) (Object, bool) {
+	b, ok := e.Resolve(name)
+	if !ok {
+		return nil, false
+	}
+	return b.Value, true
+}
+
+// Declare binds name in frame e, shadowing any binding of
+// the same name in outer frames. It returns false if name
+// is already declared in e.
+func (e *Environment) Declare(name string, val Object, isConst bool) bool {
+	if _, ok := e.store[name]; ok {
+		return false
+	}
+	e.store[name] = &Binding{Value: val, Const: isConst}
+	return true
+}
+
+// Assign updates the nearest binding of name. It returns
+// the Binding found, which is nil if name is undeclared.
+// A const Binding is returned but left unchanged.
+func (e *Environment) Assign(name string, val Object) (*Binding, bool) {
+	b, ok := e.Resolve(name)
+	if !ok || b.Const {
+		return b, false
+	}
+	b.Value = val
+	return b, true
+}
+
+// NewGenerator creates the frame of a generator call enclosed
+// by outer, yield receives every value the generator yields
+func NewGenerator(outer *Environment, yield func(Object) bool) *Environment {
+	env := NewEnclosed(outer)
+	env.yield = yield
+	return env
+}
+
+// Yield passes val to the consumer of the nearest generator frame.
+// It returns false if the consumer stopped, or if there is none.
+func (e *Environment) Yield(val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if env.yield != nil {
+			return env.yield(val)
+		}
+	}
+	return false
+}
+
+// NewCoroutine creates the frame of an async call enclosed
+// by outer, evaluated by the coroutine co
+func NewCoroutine(outer *Environment, co *Coroutine) *Environment {
+	env := NewEnclosed(outer)
+	env.co = co
+	return env
+}
+
+// Coroutine returns the coroutine of the nearest async frame,
+// or nil if e belongs to the main program
+func (e *Environment) Coroutine() *Coroutine {
+	for env := e; env != nil; env = env.outer {
+		if env.co != nil {
+			return env.co
+		}
+	}
+	return nil
+}
+
+// Loop returns the event loop of the program e belongs to,
+// held by the outermost frame, or nil if it has not been started
+func (e *Environment) Loop() *Loop {
+	return e.Root().loop
+}
+
+// StartLoop returns the event loop of the program
+// e belongs to, creating it on first use
+func (e *Environment) StartLoop() *Loop {
+	root := e.Root()
+	if root.loop == nil {
+		root.loop = NewLoop()
+		root.loop.rt = root.runtime
+	}
+	return root.loop
+}
+
+// Runtime returns the runtime of the program e belongs to,
+// held by the outermost frame, or nil if it has not been started
+func (e *Environment) Runtime() *Runtime {
+	return e.Root().runtime
+}
+
+// StartRuntime returns the runtime of the program e belongs to,
+// creating it on first use which makes the caller the main task
+func (e *Environment) StartRuntime() *Runtime {
+	root := e.Root()
+	if root.runtime == nil {
+		root.runtime = NewRuntime()
+		if root.loop != nil {
+			root.loop.rt = root.runtime
+		}
+	}
+	return root.runtime
+}
+
+// Root returns the outermost frame of e
+func (e *Environment) Root() *Environment {
+	root := e
+	for root.outer != nil {
+		root = root.outer
+	}
+	return root
+}
@@ -0,0 +1,54 @@
+package object
+
+import "testing"
+
+func TestEnvironmentShadowing(t *testing.T) {
+	global := NewEnvironment()
+	global.Declare("x", &Number{Value: 1}, false)
+	local := NewEnclosed(global)
+	if !local.Declare("x", &Number{Value: 2}, false) {
+		t.Fatalf("expected x to shadow global binding")
+	}
+	if local.Declare("x", &Number{Value: 3}, false) {
+		t.Fatalf("expected redeclaration of x in the same frame to fail")
+	}
+	assertNumber(t, local, "x", 2)
+	assertNumber(t, global, "x", 1)
+	if local.Outer() != global {
+		t.Fatalf("local.Outer() is not global")
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	global := NewEnvironment()
+	global.Declare("x", &Number{Value: 1}, false)
+	global.Declare("c", &Number{Value: 1}, true)
+	inner := NewEnclosed(NewEnclosed(global))
+
+	if _, ok := inner.Assign("x", &Number{Value: 5}); !ok {
+		t.Fatalf("expected assignment to x to succeed")
+	}
+	assertNumber(t, global, "x", 5)
+
+	b, ok := inner.Assign("c", &Number{Value: 5})
+	if ok || b == nil || !b.Const {
+		t.Fatalf("expected assignment to const c to fail with its binding")
+	}
+	assertNumber(t, global, "c", 1)
+
+	if b, ok := inner.Assign("y", &Number{Value: 5}); ok || b != nil {
+		t.Fatalf("expected assignment to undeclared y to fail without a binding")
+	}
+}
+
+func assertNumber(t *testing.T, env *Environment, name string, want float64) {
+	t.Helper()
+	obj, ok := env.Get(name)
+	if !ok {
+		t.Fatalf("%q not found", name)
+	}
+	n, ok := obj.(*Number)
+	if !ok || n.Value != want {
+		t.Fatalf("unexpected value for %q, want=%g, got=%s", name, want, obj)
+	}
+}
@@ -0,0 +1,292 @@
+package object
+
+import (
+	"errors"
+	"iter"
+	"sync"
+
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// ErrCancelled is returned by Await if the loop stopped the coroutine
+var ErrCancelled = errors.New("coroutine cancelled")
+
+// Future is the eventual result of an async call, or of a host
+// function which returns a future created by NewFuture
+type Future struct {
+	// Token is the position of the call the future belongs to
+	Token token.T
+	Name  string
+	done  bool
+	// value is an *Error if the future was rejected
+	value Object
+	// observed is set once the future is awaited,
+	// the loop reports rejections never observed
+	observed bool
+	// waiters are the coroutines suspended until the future settles
+	waiters []*Coroutine
+	co      *Coroutine
+	host    *settlement
+}
+
+func (f *Future) Type() Type { return FUTURE }
+func (f *Future) String() string {
+	return "<future " + f.Name + ">"
+}
+
+// settlement is the result of a host future, set from any goroutine
+type settlement struct {
+	mu    sync.Mutex
+	done  bool
+	value Object
+	err   error
+	// loop is the loop awaiting the future, nil until awaited
+	loop *Loop
+	// watched is set once the future is polled by a loop
+	watched bool
+}
+
+// NewFuture returns a pending future for a host function to return and
+// settle, which resolves the future with val or rejects it with err if
+// err is not nil. settle may be called from any goroutine, only its
+// first call has an effect.
+func NewFuture(name string) (*Future, func(val Object, err error)) {
+	s := &settlement{}
+	settle := func(val Object, err error) {
+		s.mu.Lock()
+		if s.done {
+			s.mu.Unlock()
+			return
+		}
+		s.done, s.value, s.err = true, val, err
+		loop := s.loop
+		s.mu.Unlock()
+		if loop != nil {
+			loop.notify()
+		}
+	}
+	return &Future{Name: name, host: s}, settle
+}
+
+// result returns the settled value of s, ok is false if it is pending
+func (s *settlement) result() (val Object, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.done:
+		return nil, false
+	case s.err != nil:
+		return &Error{Msg: s.err.Error()}, true
+	case s.value == nil:
+		return Nil, true
+	}
+	return s.value, true
+}
+
+// Coroutine evaluates an async call, suspending whenever
+// it awaits a future which has not settled yet
+type Coroutine struct {
+	next    func() (Object, bool)
+	stop    func()
+	suspend func(Object) bool
+}
+
+// Loop is the event loop of a program. It runs one coroutine at a time
+// in a deterministic order: ready coroutines run first in, first out,
+// each until it awaits a pending future or returns. Futures settled by
+// host functions are only observed once no coroutine is ready, in the
+// order they were first awaited. While the loop waits for a host future
+// it releases the runtime lock, so spawned tasks keep running.
+type Loop struct {
+	ready []*Coroutine
+	// hosts are the awaited host futures which have not settled
+	hosts []*Future
+	// mu guards settled, which is closed and replaced whenever a host
+	// future settles, ending the wait of the loop for one
+	mu      sync.Mutex
+	settled chan struct{}
+	// rt is the runtime of the program, nil if it has not been started
+	rt *Runtime
+	// waiting is set while the loop waits without the runtime lock, a
+	// task creating a coroutine in the meantime ends the wait as well
+	waiting bool
+	// futures of every async call since the loop last ran to completion
+	futures []*Future
+}
+
+// NewLoop creates an event loop without coroutines
+func NewLoop() *Loop {
+	return &Loop{settled: make(chan struct{})}
+}
+
+// Go creates a coroutine evaluating fn and returns the future of its
+// result, t is the position of the call. The coroutine starts once the
+// loop runs, which is when a future is awaited or the program ends.
+func (l *Loop) Go(t token.T, name string, fn func(co *Coroutine) Object) *Future {
+	f := &Future{Token: t, Name: name}
+	co := &Coroutine{}
+	co.next, co.stop = iter.Pull(func(suspend func(Object) bool) {
+		co.suspend = suspend
+		l.settle(f, fn(co))
+	})
+	f.co = co
+	l.ready = append(l.ready, co)
+	l.futures = append(l.futures, f)
+	if l.waiting {
+		l.notify()
+	}
+	return f
+}
+
+// Await returns the value of f, which is an *Error if f was rejected.
+// A coroutine co is suspended until f settles, while the main program,
+// where co is nil, runs the loop until f settles. It returns ErrDeadlock
+// if f can never settle.
+func (l *Loop) Await(f *Future, co *Coroutine) (Object, error) {
+	f.observed = true
+	if f.done {
+		return f.value, nil
+	}
+	l.watch(f)
+	if co == nil {
+		if err := l.runUntil(func() bool { return f.done }); err != nil {
+			return nil, err
+		}
+		return f.value, nil
+	}
+	f.waiters = append(f.waiters, co)
+	if !co.suspend(nil) {
+		return nil, ErrCancelled
+	}
+	return f.value, nil
+}
+
+// Run runs the loop until every coroutine has returned. It returns the
+// first rejection of a future which was never awaited, or a deadlock
+// error at the call of a coroutine which can never be resumed. Such
+// coroutines are cancelled, so no coroutine outlives the program. Run
+// blocks as long as an awaited host future has not settled.
+func (l *Loop) Run() *Error {
+	futures := l.futures
+	l.futures = nil
+	l.runUntil(func() bool { return false })
+	var deadlock *Error
+	for _, f := range futures {
+		if !f.done {
+			if deadlock == nil {
+				deadlock = NewError(f.Token, "%s", ErrDeadlock)
+			}
+			f.co.stop()
+		}
+	}
+	// coroutines created while cancelling are never started
+	for _, f := range l.futures {
+		f.co.stop()
+	}
+	l.futures, l.ready = nil, nil
+	if deadlock != nil {
+		return deadlock
+	}
+	for _, f := range futures {
+		if err, ok := f.value.(*Error); ok && !f.observed {
+			return err
+		}
+	}
+	return nil
+}
+
+// runUntil runs ready coroutines and observes host futures until done
+// reports true. It returns ErrDeadlock if nothing is left to run.
+func (l *Loop) runUntil(done func() bool) error {
+	for !done() {
+		if len(l.ready) > 0 {
+			co := l.ready[0]
+			l.ready = l.ready[1:]
+			co.next()
+			continue
+		}
+		if !l.poll() {
+			return ErrDeadlock
+		}
+	}
+	return nil
+}
+
+// watch registers f with the loop if it is a host future
+func (l *Loop) watch(f *Future) {
+	if f.host == nil {
+		return
+	}
+	f.host.mu.Lock()
+	defer f.host.mu.Unlock()
+	if !f.host.watched {
+		f.host.watched = true
+		f.host.loop = l
+		l.hosts = append(l.hosts, f)
+	}
+}
+
+// poll settles the awaited host futures which have settled, waiting
+// for one if none has. It returns false if there is no awaited host
+// future left.
+func (l *Loop) poll() bool {
+	for len(l.hosts) > 0 {
+		// taken before checking, so a future settling
+		// in between ends the wait right away
+		settled := l.wakeup()
+		pending := l.hosts[:0]
+		for _, f := range l.hosts {
+			if val, ok := f.host.result(); ok {
+				l.settle(f, val)
+			} else {
+				pending = append(pending, f)
+			}
+		}
+		if len(pending) < len(l.hosts) {
+			l.hosts = pending
+			return true
+		}
+		if len(l.ready) > 0 {
+			// a task created a coroutine while the loop waited
+			return true
+		}
+		l.wait(settled)
+	}
+	return false
+}
+
+// wakeup returns the channel closed once a host future settles
+func (l *Loop) wakeup() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.settled
+}
+
+// notify ends the wait of the loop
+func (l *Loop) notify() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	close(l.settled)
+	l.settled = make(chan struct{})
+}
+
+// wait blocks until settled is closed, the runtime
+// lock is released in the meantime if it is held
+func (l *Loop) wait(settled <-chan struct{}) {
+	if l.rt == nil {
+		<-settled
+		return
+	}
+	l.waiting = true
+	l.rt.Release()
+	<-settled
+	l.rt.Acquire()
+	l.waiting = false
+}
+
+// settle settles f with val and makes its waiters ready
+func (l *Loop) settle(f *Future, val Object) {
+	f.done, f.value = true, val
+	l.ready = append(l.ready, f.waiters...)
+	f.waiters = nil
+}
@@ -0,0 +1,208 @@
+package object
+
+import (
+	"fmt"
+	"iter"
+)
+
+// Iterator is a lazy sequence of values, i.e the result of calling
+// a generator or of the builtins map, filter, take and zip. The
+// iterator of a generator is single-use, its body runs once and a
+// later range yields nothing. The builtins range over their iterable
+// again every time they are ranged over, and a Seq a host passes to
+// FromSeq may be ranged over as often as the host allows.
+//
+// A sequence ends early after yielding an *Error, consumers
+// must check every value and stop at the first error.
+type Iterator struct {
+	Name string
+	Seq  iter.Seq[Object]
+}
+
+func (it *Iterator) Type() Type     { return ITERATOR }
+func (it *Iterator) String() string { return "<" + it.Name + ">" }
+
+// FromSeq wraps a Go sequence in an Iterator, allowing
+// a host program to pass lazy values to blue programs
+func FromSeq(name string, seq iter.Seq[Object]) *Iterator {
+	return &Iterator{Name: name, Seq: seq}
+}
+
+// Values returns the values of an iterable as a Go sequence. Iterables
+// are arrays, bounded ranges, strings, which yield every byte as a
+// string, and iterators. Arrays are copied before iteration starts.
+func Values(obj Object) (iter.Seq[Object], error) {
+	switch obj := obj.(type) {
+	case *Iterator:
+		return obj.Seq, nil
+	case *Range:
+		if !obj.Bounded() {
+			return nil, fmt.Errorf("cannot iterate over unbounded range %s", obj)
+		}
+		return func(yield func(Object) bool) {
+			for i := obj.Start; obj.Within(i); i += obj.Step {
+				if !yield(&Number{Value: float64(i)}) {
+					return
+				}
+			}
+		}, nil
+	case *Array:
+		elements := append([]Object(nil), obj.Elements...)
+		return func(yield func(Object) bool) {
+			for _, el := range elements {
+				if !yield(el) {
+					return
+				}
+			}
+		}, nil
+	case *String:
+		return func(yield func(Object) bool) {
+			for i := 0; i < len(obj.Value); i++ {
+				if !yield(&String{Value: string(obj.Value[i])}) {
+					return
+				}
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", obj.Type())
+}
+
+// Truthy returns false for false and null, true otherwise
+func Truthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	}
+	return true
+}
+
+// builtinMap lazily calls fn with every value of an iterable
+func builtinMap(call Caller, args ...Object) (Object, error) {
+	values, fn, err := iterableAndFunction("map", args)
+	if err != nil {
+		return nil, err
+	}
+	return FromSeq("map", func(yield func(Object) bool) {
+		for val := range values {
+			if val.Type() != ERROR {
+				val = call(fn, val)
+			}
+			if !yield(val) || val.Type() == ERROR {
+				return
+			}
+		}
+	}), nil
+}
+
+// builtinFilter lazily yields the values of an iterable for which fn is truthy
+func builtinFilter(call Caller, args ...Object) (Object, error) {
+	values, fn, err := iterableAndFunction("filter", args)
+	if err != nil {
+		return nil, err
+	}
+	return FromSeq("filter", func(yield func(Object) bool) {
+		for val := range values {
+			if val.Type() == ERROR {
+				yield(val)
+				return
+			}
+			keep := call(fn, val)
+			if keep.Type() == ERROR {
+				yield(keep)
+				return
+			}
+			if Truthy(keep) && !yield(val) {
+				return
+			}
+		}
+	}), nil
+}
+
+// builtinTake lazily yields at most n values of an iterable
+func builtinTake(_ Caller, args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments to take, want=2, got=%d", len(args))
+	}
+	values, err := Values(args[0])
+	if err != nil {
+		return nil, err
+	}
+	n, ok := args[1].(*Number)
+	if !ok || n.Value < 0 || n.Value != float64(int(n.Value)) {
+		return nil, fmt.Errorf("second argument to take must be a non-negative integer, got %s", args[1])
+	}
+	count := int(n.Value)
+	return FromSeq("take", func(yield func(Object) bool) {
+		if count == 0 {
+			return
+		}
+		taken := 0
+		for val := range values {
+			if !yield(val) || val.Type() == ERROR {
+				return
+			}
+			if taken++; taken == count {
+				return
+			}
+		}
+	}), nil
+}
+
+// builtinZip lazily yields arrays holding the next value of every
+// iterable, it ends when the shortest iterable is exhausted
+func builtinZip(_ Caller, args ...Object) (Object, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("wrong number of arguments to zip, want at least 2, got=%d", len(args))
+	}
+	seqs := make([]iter.Seq[Object], len(args))
+	for i, arg := range args {
+		values, err := Values(arg)
+		if err != nil {
+			return nil, err
+		}
+		seqs[i] = values
+	}
+	return FromSeq("zip", func(yield func(Object) bool) {
+		nexts := make([]func() (Object, bool), len(seqs))
+		for i, seq := range seqs {
+			next, stop := iter.Pull(seq)
+			defer stop()
+			nexts[i] = next
+		}
+		for {
+			tuple := &Array{Elements: make([]Object, len(nexts))}
+			for i, next := range nexts {
+				val, ok := next()
+				if !ok {
+					return
+				}
+				if val.Type() == ERROR {
+					yield(val)
+					return
+				}
+				tuple.Elements[i] = val
+			}
+			if !yield(tuple) {
+				return
+			}
+		}
+	}), nil
+}
+
+// iterableAndFunction checks the arguments to map and filter
+func iterableAndFunction(name string, args []Object) (iter.Seq[Object], Object, error) {
+	if len(args) != 2 {
+		return nil, nil, fmt.Errorf("wrong number of arguments to %s, want=2, got=%d", name, len(args))
+	}
+	values, err := Values(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	switch args[1].Type() {
+	case FUNCTION, BUILTIN, METHOD, STRUCT, CLOSURE:
+		return values, args[1], nil
+	}
+	return nil, nil, fmt.Errorf("second argument to %s must be a function, got %s", name, args[1].Type())
+}
@@ -0,0 +1,85 @@
+package object
+
+import (
+	"iter"
+	"slices"
+	"testing"
+)
+
+func TestValues(t *testing.T) {
+	tests := []struct {
+		iterable Object
+		expected []string
+	}{
+		{&Array{Elements: []Object{&Number{Value: 1}, &String{Value: "a"}}}, []string{"1", "a"}},
+		{&Range{Start: 5, End: 0, Step: -2}, []string{"5", "3", "1"}},
+		{&String{Value: "hey"}, []string{"h", "e", "y"}},
+		{FromSeq("seq", numbers(3)), []string{"0", "1", "2"}},
+	}
+	for _, tt := range tests {
+		values, err := Values(tt.iterable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for val := range values {
+			got = append(got, val.String())
+		}
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("unexpected values of %s, want=%v, got=%v", tt.iterable, tt.expected, got)
+		}
+	}
+	for _, obj := range []Object{&Range{Start: 0, Step: 1, OpenEnd: true}, Nil} {
+		if _, err := Values(obj); err == nil {
+			t.Errorf("expected error for %s", obj)
+		}
+	}
+}
+
+func TestLazyBuiltins(t *testing.T) {
+	double := &Builtin{Name: "double", Fn: func(_ Caller, args ...Object) (Object, error) {
+		return &Number{Value: args[0].(*Number).Value * 2}, nil
+	}}
+	call := func(fn Object, args ...Object) Object {
+		result, err := fn.(*Builtin).Fn(nil, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	mapped, err := builtinMap(call, FromSeq("naturals", numbers(-1)), double)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken, err := builtinTake(call, mapped, &Number{Value: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := Values(taken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a blue iterator is a Go iter.Seq and may be pulled from
+	next, stop := iter.Pull(values)
+	defer stop()
+	for _, want := range []string{"0", "2", "4"} {
+		val, ok := next()
+		if !ok || val.String() != want {
+			t.Fatalf("unexpected value, want=%s, got=%v", want, val)
+		}
+	}
+	if _, ok := next(); ok {
+		t.Errorf("expected take to end after 3 values")
+	}
+}
+
+// numbers yields 0, 1, ... n-1 or forever if n is negative
+func numbers(n int) iter.Seq[Object] {
+	return func(yield func(Object) bool) {
+		for i := 0; n < 0 || i < n; i++ {
+			if !yield(&Number{Value: float64(i)}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// Object must be implemented
+// by all runtime values
+type Object interface {
+	Type() Type
+	String() string
+}
+
+// Null i.e null
+type Null struct{}
+
+func (n *Null) Type() Type     { return NULL }
+func (n *Null) String() string { return "null" }
+
+// Number i.e 5, 42.12
+type Number struct {
+	Value float64
+}
+
+func (n *Number) Type() Type { return NUMBER }
+func (n *Number) String() string {
+	return strconv.FormatFloat(n.Value, 'f', -1, 64)
+}
+
+// String i.e "foobar"
+type String struct {
+	Value string
+}
+
+func (s *String) Type() Type     { return STRING }
+func (s *String) String() string { return s.Value }
+
+// Boolean i.e true, false
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() Type     { return BOOLEAN }
+func (b *Boolean) String() string { return strconv.FormatBool(b.Value) }
+
+// Array i.e [1, 2, 3]
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() Type { return ARRAY }
+func (a *Array) String() string {
+	var elements []string
+	for _, el := range a.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Function is a closure, i.e a function literal
+// and the environment it was defined in
+type Function struct {
+	Node *ast.Function
+	Env  *Environment
+}
+
+func (f *Function) Type() Type     { return FUNCTION }
+func (f *Function) String() string { return f.Node.String() }
+
+// Caller calls a blue function, or any other callable object,
+// with args and returns the result which may be an *Error
+type Caller func(fn Object, args ...Object) Object
+
+// BuiltinFn is the signature of native Go functions callable from blue,
+// call may be used to call functions passed as arguments
+type BuiltinFn func(call Caller, args ...Object) (Object, error)
+
+// Builtin is a native Go function, i.e len
+type Builtin struct {
+	Name string
+	Fn   BuiltinFn
+}
+
+func (b *Builtin) Type() Type     { return BUILTIN }
+func (b *Builtin) String() string { return "builtin " + b.Name }
+
+// Result i.e ok(1), err("failed")
+type Result struct {
+	Ok    bool
+	Value Object
+}
+
+func (r *Result) Type() Type { return RESULT }
+func (r *Result) String() string {
+	if r.Ok {
+		return "ok(" + r.Value.String() + ")"
+	}
+	return "err(" + r.Value.String() + ")"
+}
+
+// Range i.e 0..10, 0..=10 step 2, ..5 or 1..
+type Range struct {
+	Start int
+	End   int
+	Step  int
+	// Open bounds default to the bounds of the indexed value
+	OpenStart bool
+	OpenEnd   bool
+	Inclusive bool
+}
+
+func (r *Range) Type() Type { return RANGE }
+func (r *Range) String() string {
+	var out bytes.Buffer
+	if !r.OpenStart {
+		out.WriteString(strconv.Itoa(r.Start))
+	}
+	if r.Inclusive {
+		out.WriteString("..=")
+	} else {
+		out.WriteString("..")
+	}
+	if !r.OpenEnd {
+		out.WriteString(strconv.Itoa(r.End))
+	}
+	if r.Step != 1 {
+		out.WriteString(" step " + strconv.Itoa(r.Step))
+	}
+	return out.String()
+}
+
+// Bounded reports whether the range has both a start and an end
+func (r *Range) Bounded() bool {
+	return !r.OpenStart && !r.OpenEnd
+}
+
+// Within reports whether i, stepping from Start, has not passed End
+func (r *Range) Within(i int) bool {
+	if r.Step > 0 {
+		return i < r.End || (r.Inclusive && i == r.End)
+	}
+	return i > r.End || (r.Inclusive && i == r.End)
+}
+
+// Struct is a struct type i.e struct Point { x, y },
+// calling it constructs an Instance
+type Struct struct {
+	Name   string
+	Fields []string
+	// Shape of the instances, slots are in the order of Fields
+	Shape *Shape
+	// Methods are functions of the evaluator or closures of the VM
+	Methods map[string]Object
+}
+
+// NewStruct creates a struct type without methods
+func NewStruct(name string, fields []string) *Struct {
+	return &Struct{
+		Name:    name,
+		Fields:  fields,
+		Shape:   ShapeOf(fields...),
+		Methods: make(map[string]Object),
+	}
+}
+
+func (s *Struct) Type() Type { return STRUCT }
+func (s *Struct) String() string {
+	return "struct " + s.Name + " { " + strings.Join(s.Fields, ", ") + " }"
+}
+
+// HasField reports whether name is a declared field of s
+func (s *Struct) HasField(name string) bool {
+	_, ok := s.Shape.Slot(name)
+	return ok
+}
+
+// Instance of a struct i.e Point(1, 2)
+type Instance struct {
+	Struct *Struct
+	// Values of the fields, laid out by the shape of Struct
+	Values []Object
+}
+
+func (i *Instance) Type() Type { return INSTANCE }
+func (i *Instance) String() string {
+	var fields []string
+	for slot, name := range i.Struct.Fields {
+		fields = append(fields, name+": "+i.Values[slot].String())
+	}
+	return i.Struct.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// Field returns the value of the field name
+func (i *Instance) Field(name string) (Object, bool) {
+	slot, ok := i.Struct.Shape.Slot(name)
+	if !ok {
+		return nil, false
+	}
+	return i.Values[slot], true
+}
+
+// Dict maps string keys to values i.e {"a": 1}, laid
+// out by a shape holding the keys in the order they were added
+type Dict struct {
+	Shape  *Shape
+	Values []Object
+}
+
+// NewDict creates a dict without keys
+func NewDict() *Dict {
+	return &Dict{Shape: RootShape()}
+}
+
+func (d *Dict) Type() Type { return DICT }
+func (d *Dict) String() string {
+	var pairs []string
+	for slot, key := range d.Shape.Fields() {
+		pairs = append(pairs, key+": "+d.Values[slot].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Get returns the value of key
+func (d *Dict) Get(key string) (Object, bool) {
+	slot, ok := d.Shape.Slot(key)
+	if !ok {
+		return nil, false
+	}
+	return d.Values[slot], true
+}
+
+// Set sets the value of key, adding key if d does not have it
+func (d *Dict) Set(key string, val Object) {
+	if slot, ok := d.Shape.Slot(key); ok {
+		d.Values[slot] = val
+		return
+	}
+	d.Shape = d.Shape.With(key)
+	d.Values = append(d.Values, val)
+}
+
+// Method is a method bound to its receiver i.e p.len
+type Method struct {
+	Receiver *Instance
+	Fn       *Function
+}
+
+func (m *Method) Type() Type { return METHOD }
+func (m *Method) String() string {
+	return m.Receiver.Struct.Name + "." + m.Fn.Node.Name.Value
+}
+
+// Module is an imported module, its exported
+// names are looked up in its global frame Env
+type Module struct {
+	Path    string
+	Env     *Environment
+	Exports []string
+}
+
+func (m *Module) Type() Type     { return MODULE }
+func (m *Module) String() string { return "module " + strconv.Quote(m.Path) }
+
+// Exported reports whether name is exported by m
+func (m *Module) Exported(name string) bool {
+	for _, export := range m.Exports {
+		if export == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Return wraps the value of a return statement
+// while it propagates up through blocks
+type Return struct {
+	Value Object
+}
+
+func (r *Return) Type() Type     { return RETURN }
+func (r *Return) String() string { return r.Value.String() }
+
+// Error is a runtime error raised at Token. It propagates
+// up through blocks and calls until caught by a try statement.
+type Error struct {
+	Token token.T
+	Msg   string
+	// Value is the thrown value, nil if raised by the runtime
+	Value Object
+	// Stack holds the position of every call the
+	// error propagated through, innermost first
+	Stack []token.T
+}
+
+func (e *Error) Type() Type { return ERROR }
+func (e *Error) String() string {
+	var out bytes.Buffer
+	out.WriteString("RuntimeError: " + e.Msg)
+	if e.Token.Line > 0 {
+		out.WriteString(fmt.Sprintf(" at L%d:C%d", e.Token.Line, e.Token.Col))
+	}
+	for _, t := range e.Stack {
+		out.WriteString(fmt.Sprintf("\n\tcalled at L%d:C%d", t.Line, t.Col))
+	}
+	return out.String()
+}
+
+// NewError creates an Error at t with a formatted message
+func NewError(t token.T, msg string, args ...any) *Error {
+	return &Error{Token: t, Msg: fmt.Sprintf(msg, args...)}
+}
+
+// Nil, True and False are shared since they carry no state
+var (
+	Nil   = &Null{}
+	True  = &Boolean{Value: true}
+	False = &Boolean{Value: false}
+)
+
+// Bool returns the shared Boolean for b
+func Bool(b bool) *Boolean {
+	if b {
+		return True
+	}
+	return False
+}
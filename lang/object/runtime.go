@@ -0,0 +1,249 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// ErrDeadlock is returned by blocking operations once every task is blocked
+var ErrDeadlock = errors.New("deadlock: all tasks are blocked")
+
+// Runtime schedules the tasks of a program. Tasks are goroutines, but
+// only the task holding the runtime lock evaluates blue code, so every
+// value reachable from blue is only ever accessed by one goroutine at a
+// time. A task releases the lock while it is blocked.
+type Runtime struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// live counts unfinished tasks, including the main task
+	live int
+	// blocked counts tasks that found they are not ready since the last
+	// wake, a task woken up is not blocked until it checks again
+	blocked int
+	wakes   int
+	// deadlocks counts detected deadlocks, waking every blocked task
+	deadlocks int
+	tasks     []*Task
+}
+
+// NewRuntime creates a runtime for a program, the calling
+// goroutine becomes the main task and holds the runtime lock
+func NewRuntime() *Runtime {
+	rt := &Runtime{live: 1}
+	rt.cond = sync.NewCond(&rt.mu)
+	rt.mu.Lock()
+	return rt
+}
+
+// Acquire blocks until the calling goroutine holds the runtime lock
+func (rt *Runtime) Acquire() { rt.mu.Lock() }
+
+// Release releases the runtime lock
+func (rt *Runtime) Release() { rt.mu.Unlock() }
+
+// Block releases the runtime lock until ready reports true. It returns
+// ErrDeadlock if every live task is blocked. The lock must be held.
+func (rt *Runtime) Block(ready func() bool) error {
+	for !ready() {
+		if rt.blocked+1 == rt.live {
+			rt.deadlocks++
+			rt.wake()
+			return ErrDeadlock
+		}
+		rt.blocked++
+		wakes, deadlocks := rt.wakes, rt.deadlocks
+		for wakes == rt.wakes {
+			rt.cond.Wait()
+		}
+		if rt.deadlocks != deadlocks {
+			return ErrDeadlock
+		}
+	}
+	return nil
+}
+
+// wake lets every blocked task check if it is ready
+func (rt *Runtime) wake() {
+	rt.blocked = 0
+	rt.wakes++
+	rt.cond.Broadcast()
+}
+
+// Spawn runs fn in a new task, which starts once the lock is released.
+// t is the position the task was spawned at.
+func (rt *Runtime) Spawn(t token.T, fn func() Object) *Task {
+	task := &Task{Token: t, rt: rt}
+	rt.live++
+	rt.tasks = append(rt.tasks, task)
+	go func() {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		defer func() {
+			if r := recover(); r != nil {
+				task.Result = NewError(t, "task panicked: %v", r)
+			}
+			task.done = true
+			rt.live--
+			rt.wake()
+		}()
+		task.Result = fn()
+	}()
+	return task
+}
+
+// Wait blocks the main task until every other task has finished. It
+// returns the first error of a task that was never waited on, or a
+// deadlock error at the position of a blocked task. Tasks woken up by
+// a deadlock are still waited for, so no task outlives the program.
+func (rt *Runtime) Wait() *Error {
+	tasks := rt.tasks
+	rt.tasks = nil
+	var deadlock *Error
+	for rt.Block(func() bool { return rt.live == 1 }) != nil {
+		for _, task := range tasks {
+			if !task.done && deadlock == nil {
+				deadlock = NewError(task.Token, "%s", ErrDeadlock)
+			}
+		}
+	}
+	if deadlock != nil {
+		return deadlock
+	}
+	for _, task := range tasks {
+		if err, ok := task.Result.(*Error); ok && !task.waited {
+			return err
+		}
+	}
+	return nil
+}
+
+// Task is a function running concurrently i.e spawn f(x)
+type Task struct {
+	Token  token.T
+	rt     *Runtime
+	done   bool
+	waited bool
+	// Result of the task, set once it is done
+	Result Object
+}
+
+func (t *Task) Type() Type { return TASK }
+func (t *Task) String() string {
+	if t.done {
+		return "task(done)"
+	}
+	return "task(running)"
+}
+
+// Wait blocks until t is done and returns its result
+func (t *Task) Wait() (Object, error) {
+	if err := t.rt.Block(func() bool { return t.done }); err != nil {
+		return nil, err
+	}
+	t.waited = true
+	return t.Result, nil
+}
+
+// Channel passes values between tasks i.e channel(), channel(10).
+// A channel without capacity hands a value over only once a receiver
+// is waiting. A channel is bound to the runtime it is first used by.
+type Channel struct {
+	Cap    int
+	rt     *Runtime
+	buf    []Object
+	closed bool
+	// receivers waiting for a value
+	receivers int
+}
+
+func (c *Channel) Type() Type { return CHANNEL }
+func (c *Channel) String() string {
+	return fmt.Sprintf("channel(%d)", c.Cap)
+}
+
+// Bind binds c to rt, a channel cannot be shared between runtimes
+func (c *Channel) Bind(rt *Runtime) error {
+	if c.rt == nil {
+		c.rt = rt
+	}
+	if c.rt != rt {
+		return errors.New("channel is used by another program")
+	}
+	return nil
+}
+
+// CanSend reports whether Send would not block
+func (c *Channel) CanSend() bool {
+	if c.closed {
+		return true
+	}
+	if c.Cap == 0 {
+		return c.receivers > len(c.buf)
+	}
+	return len(c.buf) < c.Cap
+}
+
+// CanRecv reports whether Recv would not block
+func (c *Channel) CanRecv() bool {
+	return c.closed || len(c.buf) > 0
+}
+
+// Send blocks until val can be passed on
+func (c *Channel) Send(val Object) error {
+	if err := c.rt.Block(c.CanSend); err != nil {
+		return err
+	}
+	return c.TrySend(val)
+}
+
+// TrySend passes on val, CanSend must report true
+func (c *Channel) TrySend(val Object) error {
+	if c.closed {
+		return errors.New("send on closed channel")
+	}
+	c.buf = append(c.buf, val)
+	c.rt.wake()
+	return nil
+}
+
+// Recv blocks until a value is sent and returns it. Once c is
+// closed and every value is received, ok is false and val is null.
+func (c *Channel) Recv() (val Object, ok bool, err error) {
+	c.Waiting(1)
+	defer c.Waiting(-1)
+	if err := c.rt.Block(c.CanRecv); err != nil {
+		return nil, false, err
+	}
+	val, ok = c.TryRecv()
+	return val, ok, nil
+}
+
+// Waiting adds delta to the receivers waiting for a value
+func (c *Channel) Waiting(delta int) {
+	c.receivers += delta
+	c.rt.wake()
+}
+
+// TryRecv returns the next value, CanRecv must report true
+func (c *Channel) TryRecv() (Object, bool) {
+	if len(c.buf) == 0 {
+		return Nil, false
+	}
+	val := c.buf[0]
+	c.buf = c.buf[1:]
+	c.rt.wake()
+	return val, true
+}
+
+// Close closes c, pending values can still be received
+func (c *Channel) Close() error {
+	if c.closed {
+		return errors.New("close of closed channel")
+	}
+	c.closed = true
+	c.rt.wake()
+	return nil
+}
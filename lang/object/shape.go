@@ -0,0 +1,76 @@
+package object
+
+import "sync"
+
+// Shape is the hidden class of an object with named fields, it
+// maps every field name to the slot holding its value. Shapes form
+// a tree of transitions from an empty root, adding a field to a shape
+// always returns the same shape, so objects whose fields were added
+// in the same order share a shape. A shape which matches tells that
+// a field is in a given slot without looking the name up. Struct
+// instances and dicts share the tree, a field is a key of a dict.
+type Shape struct {
+	fields []string
+	slots  map[string]int
+
+	mu          sync.Mutex
+	transitions map[string]*Shape
+}
+
+var rootShape = &Shape{slots: map[string]int{}}
+
+// RootShape returns the shape without fields
+func RootShape() *Shape {
+	return rootShape
+}
+
+// ShapeOf returns the shape of an object with fields in order
+func ShapeOf(fields ...string) *Shape {
+	s := rootShape
+	for _, field := range fields {
+		s = s.With(field)
+	}
+	return s
+}
+
+// With returns the shape of an object of shape s after
+// adding name, s itself if it already has the field
+func (s *Shape) With(name string) *Shape {
+	if _, ok := s.slots[name]; ok {
+		return s
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if next, ok := s.transitions[name]; ok {
+		return next
+	}
+	next := &Shape{
+		fields: append(s.fields[:len(s.fields):len(s.fields)], name),
+		slots:  make(map[string]int, len(s.slots)+1),
+	}
+	for field, slot := range s.slots {
+		next.slots[field] = slot
+	}
+	next.slots[name] = len(s.fields)
+	if s.transitions == nil {
+		s.transitions = make(map[string]*Shape)
+	}
+	s.transitions[name] = next
+	return next
+}
+
+// Slot returns the slot of the field name
+func (s *Shape) Slot(name string) (int, bool) {
+	slot, ok := s.slots[name]
+	return slot, ok
+}
+
+// Fields returns the field names in slot order
+func (s *Shape) Fields() []string {
+	return s.fields
+}
+
+// Len returns the number of fields
+func (s *Shape) Len() int {
+	return len(s.fields)
+}
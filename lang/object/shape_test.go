@@ -0,0 +1,34 @@
+package object
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShapeTransitions(t *testing.T) {
+	xy := ShapeOf("x", "y")
+	if ShapeOf("x", "y") != xy || RootShape().With("x").With("y") != xy {
+		t.Fatal("fields added in the same order must share a shape")
+	}
+	if ShapeOf("y", "x") == xy {
+		t.Fatal("fields added in another order must not share a shape")
+	}
+	if xy.With("x") != xy {
+		t.Error("adding an existing field must not change the shape")
+	}
+	if !slices.Equal(xy.Fields(), []string{"x", "y"}) || xy.Len() != 2 {
+		t.Errorf("wrong fields, got=%v", xy.Fields())
+	}
+	xyz := xy.With("z")
+	for i, name := range []string{"x", "y", "z"} {
+		if slot, ok := xyz.Slot(name); !ok || slot != i {
+			t.Errorf("wrong slot of %q, want=%d, got=%d", name, i, slot)
+		}
+	}
+	if _, ok := xy.Slot("z"); ok {
+		t.Error("a transition must not add fields to its parent")
+	}
+	if RootShape().Len() != 0 {
+		t.Errorf("root shape has fields %v", RootShape().Fields())
+	}
+}
@@ -0,0 +1,130 @@
+package object
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Bounds of a slice, Start and End are nil if omitted.
+// Negative indices count from the end.
+type Bounds struct {
+	Start, End *int
+	Step       int
+	Inclusive  bool
+}
+
+func (b Bounds) String() string {
+	format := func(i *int) string {
+		if i == nil {
+			return ""
+		}
+		return strconv.Itoa(*i)
+	}
+	return fmt.Sprintf("%s:%s:%d", format(b.Start), format(b.End), b.Step)
+}
+
+// normalize resolves b against length, returning the first index
+// and the index at which to stop. Reports false if out of range.
+func (b Bounds) normalize(length int) (int, int, bool) {
+	index := func(i int) int {
+		if i < 0 {
+			return i + length
+		}
+		return i
+	}
+	if b.Step > 0 {
+		start, end := 0, length
+		if b.Start != nil {
+			start = index(*b.Start)
+		}
+		if b.End != nil {
+			if end = index(*b.End); b.Inclusive {
+				end++
+			}
+		}
+		if start < 0 || start > length || end < 0 || end > length {
+			return 0, 0, false
+		}
+		return start, max(start, end), true
+	}
+	start, end := length-1, -1
+	if b.Start != nil {
+		if start = index(*b.Start); start < 0 || start >= length {
+			return 0, 0, false
+		}
+	}
+	if b.End != nil {
+		if end = index(*b.End); b.Inclusive {
+			end--
+		}
+		if end < -1 || end >= length {
+			return 0, 0, false
+		}
+	}
+	return start, min(start, end), true
+}
+
+// Bounds returns the bounds of indexing by r,
+// x[a..b step c] is equivalent to x[a:b:c]
+func (r *Range) Bounds() Bounds {
+	b := Bounds{Step: r.Step, Inclusive: r.Inclusive}
+	if !r.OpenStart {
+		b.Start = &r.Start
+	}
+	if !r.OpenEnd {
+		b.End = &r.End
+	}
+	return b
+}
+
+// Slice returns the part of an array or a string selected
+// by b. Errors describe the bounds as desc.
+func Slice(obj Object, b Bounds, desc string) (Object, error) {
+	length, ok := lengthOf(obj)
+	if !ok {
+		return nil, fmt.Errorf("slice operator not supported: %s", obj.Type())
+	}
+	start, end, ok := b.normalize(length)
+	if !ok {
+		return nil, fmt.Errorf("slice bounds out of range [%s] with length %d", desc, length)
+	}
+	return sliceOf(obj, start, end, b.Step), nil
+}
+
+// lengthOf returns the length of an array or a string
+func lengthOf(obj Object) (int, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return len(obj.Elements), true
+	case *String:
+		return len(obj.Value), true
+	}
+	return 0, false
+}
+
+// sliceOf returns every step'th element of an array or
+// string from start up to, excluding, end. A negative
+// step walks backwards from start down to end
+func sliceOf(obj Object, start, end, step int) Object {
+	within := func(i int) bool {
+		if step > 0 {
+			return i < end
+		}
+		return i > end
+	}
+	switch obj := obj.(type) {
+	case *Array:
+		elements := []Object{}
+		for i := start; within(i); i += step {
+			elements = append(elements, obj.Elements[i])
+		}
+		return &Array{Elements: elements}
+	case *String:
+		b := []byte{}
+		for i := start; within(i); i += step {
+			b = append(b, obj.Value[i])
+		}
+		return &String{Value: string(b)}
+	}
+	return Nil
+}
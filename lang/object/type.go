@@ -0,0 +1,58 @@
+package object
+
+// Type is all object types currently understood
+type Type int
+
+func (t Type) String() string {
+	return name[t]
+}
+
+const (
+	NULL     Type = iota // null
+	NUMBER               // 1, 2.5 etc..
+	STRING               // "hello"
+	BOOLEAN              // true, false
+	ARRAY                // [1, 2]
+	DICT                 // {"a": 1}
+	FUNCTION             // fn(a, b) { }
+	BUILTIN              // len, etc..
+	RESULT               // ok(1), err("failed")
+	RANGE                // 0..10, 0..=10 step 2
+	STRUCT               // struct Point { x, y }
+	INSTANCE             // Point(1, 2)
+	METHOD               // p.len
+	MODULE               // import "lib/math" as math
+	ITERATOR             // map(xs, f), calling a generator
+	TASK                 // spawn f(x)
+	CHANNEL              // channel(), channel(10)
+	FUTURE               // f() where f is async
+	COMPILED             // fn(a, b) { } compiled to bytecode
+	CLOSURE              // compiled function and its captured variables
+	RETURN               // wraps a returned value
+	ERROR                // runtime error
+)
+
+var name = map[Type]string{
+	NULL:     "NULL",
+	NUMBER:   "NUMBER",
+	STRING:   "STRING",
+	BOOLEAN:  "BOOLEAN",
+	ARRAY:    "ARRAY",
+	DICT:     "DICT",
+	FUNCTION: "FUNCTION",
+	BUILTIN:  "BUILTIN",
+	RESULT:   "RESULT",
+	RANGE:    "RANGE",
+	STRUCT:   "STRUCT",
+	INSTANCE: "INSTANCE",
+	METHOD:   "METHOD",
+	MODULE:   "MODULE",
+	ITERATOR: "ITERATOR",
+	TASK:     "TASK",
+	CHANNEL:  "CHANNEL",
+	FUTURE:   "FUTURE",
+	COMPILED: "COMPILED",
+	CLOSURE:  "CLOSURE",
+	RETURN:   "RETURN",
+	ERROR:    "ERROR",
+}
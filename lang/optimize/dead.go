@@ -0,0 +1,183 @@
+package optimize
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// statements rewrites statements and removes those that can never
+// run as they follow a statement that always returns or throws.
+// Literals evaluated for nothing are removed as well, the value of
+// the last statement is kept as it may be the value of a block.
+func (o *O) statements(statements []ast.Statement) []ast.Statement {
+	out := statements[:0]
+	for i, stmt := range statements {
+		stmt = o.statement(stmt)
+		if i < len(statements)-1 && isDiscarded(stmt) {
+			continue
+		}
+		out = append(out, stmt)
+		if terminates(stmt) {
+			return append(out, o.unreachable(statements[i+1:])...)
+		}
+	}
+	return out
+}
+
+// unreachable warns about the first of statements and returns
+// stubs of their declarations, a closure may refer to a name
+// declared after a return which must keep its storage
+func (o *O) unreachable(statements []ast.Statement) []ast.Statement {
+	var stubs []ast.Statement
+	warned := false
+	for _, stmt := range statements {
+		if isEmpty(stmt) {
+			continue
+		}
+		if !warned {
+			owarn(o, ast.StatementToken(stmt), "unreachable code")
+			warned = true
+		}
+		for _, ident := range declarations(stmt) {
+			t := ident.Token
+			t.Type = token.LET
+			t.Literal = "let"
+			stubs = append(stubs, &ast.AssignStatement{
+				Token: t,
+				Left:  ident,
+				Right: &ast.Null{Token: ident.Token},
+			})
+		}
+	}
+	return stubs
+}
+
+// unreachableBranch warns about the body of a branch never taken,
+// its declarations are only visible within the branch
+func (o *O) unreachableBranch(body *ast.BlockStatement) {
+	if body != nil {
+		o.unreachable(body.Statements)
+	}
+}
+
+// foldIf walks the branches of node which may be taken and removes
+// those that cannot, as their condition is a literal. A branch
+// with a truthy literal condition is the last that may be taken.
+func (o *O) foldIf(node *ast.IfExpression) ast.Expression {
+	branches := append([]ast.Conditional{node.If}, node.Elifs...)
+	var kept []ast.Conditional
+	els := node.Else
+	for i, branch := range branches {
+		branch.Condition = o.expression(branch.Condition)
+		taken, known := truthy(branch.Condition)
+		if known && !taken {
+			o.unreachableBranch(branch.Body)
+			continue
+		}
+		o.block(branch.Body)
+		kept = append(kept, branch)
+		if known {
+			for _, rest := range branches[i+1:] {
+				o.unreachableBranch(rest.Body)
+			}
+			o.unreachableBranch(els)
+			els = nil
+			break
+		}
+	}
+	o.block(els)
+	if n := len(kept); n > 1 {
+		if taken, known := truthy(kept[n-1].Condition); known && taken {
+			els = kept[n-1].Body
+			kept = kept[:n-1]
+		}
+	}
+	if len(kept) == 0 {
+		if els == nil {
+			return &ast.Null{Token: node.Token}
+		}
+		kept = []ast.Conditional{{Condition: boolean(node.Token, true), Body: els}}
+		els = nil
+	}
+	node.If, node.Elifs, node.Else = kept[0], kept[1:], els
+	return node
+}
+
+// terminates reports whether stmt always returns or throws
+func terminates(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement:
+		return true
+	case *ast.BlockStatement:
+		return blockTerminates(stmt)
+	case *ast.ExpressionStatement:
+		ie, ok := stmt.Expression.(*ast.IfExpression)
+		if !ok || ie.Else == nil || !blockTerminates(ie.Else) {
+			return false
+		}
+		for _, branch := range append([]ast.Conditional{ie.If}, ie.Elifs...) {
+			if !blockTerminates(branch.Body) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func blockTerminates(block *ast.BlockStatement) bool {
+	for _, stmt := range block.Statements {
+		if terminates(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// truthy returns the truthiness of a literal, known is
+// false if expr is not a literal
+func truthy(expr ast.Expression) (taken bool, known bool) {
+	switch expr := expr.(type) {
+	case *ast.Boolean:
+		return expr.Value, true
+	case *ast.Null:
+		return false, true
+	case *ast.Number, *ast.String:
+		return true, true
+	}
+	return false, false
+}
+
+// isDiscarded reports whether stmt evaluates a literal for nothing
+func isDiscarded(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	return ok && (es.Expression == nil || isScalar(es.Expression))
+}
+
+func isEmpty(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	return ok && es.Expression == nil
+}
+
+// declarations returns the names stmt declares
+func declarations(stmt ast.Statement) []*ast.Identifier {
+	switch stmt := stmt.(type) {
+	case *ast.AssignStatement:
+		if stmt.Token.Type == token.LET || stmt.Token.Type == token.CONST {
+			return []*ast.Identifier{stmt.Left}
+		}
+	case *ast.ExpressionStatement:
+		if fn, ok := stmt.Expression.(*ast.Function); ok && fn.Name != nil && fn.Receiver == nil {
+			return []*ast.Identifier{fn.Name}
+		}
+	case *ast.StructStatement:
+		return []*ast.Identifier{stmt.Name}
+	case *ast.ImportStatement:
+		if stmt.Alias != nil {
+			return []*ast.Identifier{stmt.Alias}
+		}
+	case *ast.ExportStatement:
+		return declarations(stmt.Statement)
+	}
+	return nil
+}
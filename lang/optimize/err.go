@@ -0,0 +1,51 @@
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// Severity of an optimizer diagnostic
+type Severity int
+
+const (
+	// ERROR stops the program from being compiled
+	ERROR Severity = iota
+	// WARNING is reported but the program is compiled
+	WARNING
+)
+
+func (s Severity) String() string {
+	if s == WARNING {
+		return "Warning"
+	}
+	return "Error"
+}
+
+// OptimizeErr describes an error or a warning
+// encountered during optimization
+type OptimizeErr struct {
+	token.T
+	Severity
+	Msg  string
+	Line string
+}
+
+// newOptimizeErr formats a diagnostic with severity,
+// sourceName, line, col and message.
+func newOptimizeErr(o *O, severity Severity, t token.T, msg string, args ...any) OptimizeErr {
+	l := t.HighlightErr(o.l.Line(t.Line))
+	m := fmt.Sprintf(msg, args...)
+	m = fmt.Sprintf("Optimize%s: %s at\n\t%s:L%d:C%d ------> %s",
+		severity, m, o.sourceName, t.Line, t.Col, l)
+	return OptimizeErr{T: t, Severity: severity, Msg: m, Line: l}
+}
+
+func oerr(o *O, t token.T, msg string, args ...any) {
+	o.errs = append(o.errs, newOptimizeErr(o, ERROR, t, msg, args...))
+}
+
+func owarn(o *O, t token.T, msg string, args ...any) {
+	o.warnings = append(o.warnings, newOptimizeErr(o, WARNING, t, msg, args...))
+}
@@ -0,0 +1,193 @@
+package optimize
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// foldPrefix folds -n and !b into a literal
+func (o *O) foldPrefix(node *ast.PrefixExpression) ast.Expression {
+	switch right := node.Right.(type) {
+	case *ast.Number:
+		if node.Operator == "-" {
+			return number(node.Token, -right.Value)
+		}
+	case *ast.Boolean:
+		if node.Operator == "!" {
+			return boolean(node.Token, !right.Value)
+		}
+	}
+	return node
+}
+
+// foldInfix folds arithmetic and comparisons of literals into a
+// literal and removes x - 0, x * 1 and x / 1 if x is numeric
+func (o *O) foldInfix(node *ast.InfixExpression) ast.Expression {
+	if node.Operator == "/" && isNumber(node.Right, 0) && numeric(node.Left) {
+		oerr(o, node.Token, "division by zero")
+		return node
+	}
+	switch left := node.Left.(type) {
+	case *ast.Number:
+		if right, ok := node.Right.(*ast.Number); ok {
+			if folded := foldNumbers(node, left.Value, right.Value); folded != nil {
+				return folded
+			}
+		}
+	case *ast.String:
+		if right, ok := node.Right.(*ast.String); ok {
+			if folded := foldStrings(node, left.Value, right.Value); folded != nil {
+				return folded
+			}
+		}
+	}
+	if node.Operator == "==" || node.Operator == "!=" {
+		if equal, ok := literalEquals(node.Left, node.Right); ok {
+			return boolean(node.Token, equal == (node.Operator == "=="))
+		}
+	}
+	return simplify(node)
+}
+
+func foldNumbers(node *ast.InfixExpression, left, right float64) ast.Expression {
+	switch node.Operator {
+	case "+":
+		return number(node.Token, left+right)
+	case "-":
+		return number(node.Token, left-right)
+	case "*":
+		return number(node.Token, left*right)
+	case "/":
+		return number(node.Token, left/right)
+	case "<":
+		return boolean(node.Token, left < right)
+	case "<=":
+		return boolean(node.Token, left <= right)
+	case ">":
+		return boolean(node.Token, left > right)
+	case ">=":
+		return boolean(node.Token, left >= right)
+	}
+	return nil
+}
+
+func foldStrings(node *ast.InfixExpression, left, right string) ast.Expression {
+	switch node.Operator {
+	case "+":
+		t := node.Token
+		t.Type = token.STRING
+		t.Literal = left + right
+		return &ast.String{Token: t, Value: left + right}
+	case "<":
+		return boolean(node.Token, left < right)
+	case "<=":
+		return boolean(node.Token, left <= right)
+	case ">":
+		return boolean(node.Token, left > right)
+	case ">=":
+		return boolean(node.Token, left >= right)
+	}
+	return nil
+}
+
+// literalEquals compares two scalar literals like the
+// runtime compares their values, ok is false unless
+// both left and right are scalar literals
+func literalEquals(left, right ast.Expression) (equal bool, ok bool) {
+	switch l := left.(type) {
+	case *ast.Number:
+		r, ok := right.(*ast.Number)
+		return ok && l.Value == r.Value, isScalar(right)
+	case *ast.String:
+		r, ok := right.(*ast.String)
+		return ok && l.Value == r.Value, isScalar(right)
+	case *ast.Boolean:
+		r, ok := right.(*ast.Boolean)
+		return ok && l.Value == r.Value, isScalar(right)
+	case *ast.Null:
+		_, ok := right.(*ast.Null)
+		return ok, isScalar(right)
+	}
+	return false, false
+}
+
+func isScalar(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.Number, *ast.String, *ast.Boolean, *ast.Null:
+		return true
+	}
+	return false
+}
+
+// simplify returns the operand of an operation that leaves it as is.
+// x + 0 is kept since it turns a negative zero x into zero.
+func simplify(node *ast.InfixExpression) ast.Expression {
+	switch node.Operator {
+	case "-":
+		if isNumber(node.Right, 0) && numeric(node.Left) {
+			return node.Left
+		}
+	case "*":
+		if isNumber(node.Right, 1) && numeric(node.Left) {
+			return node.Left
+		}
+		if isNumber(node.Left, 1) && numeric(node.Right) {
+			return node.Right
+		}
+	case "/":
+		if isNumber(node.Right, 1) && numeric(node.Left) {
+			return node.Left
+		}
+	}
+	return node
+}
+
+// numeric reports whether expr is a number whenever
+// it evaluates without error
+func numeric(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.Number:
+		return true
+	case *ast.PrefixExpression:
+		return expr.Operator == "-"
+	case *ast.InfixExpression:
+		switch expr.Operator {
+		case "-", "*", "/":
+			return true
+		case "+":
+			return numeric(expr.Left) && numeric(expr.Right)
+		}
+	case *ast.TernaryExpression:
+		return numeric(expr.Consequence) && numeric(expr.Alternative)
+	}
+	return false
+}
+
+func isNumber(expr ast.Expression, value float64) bool {
+	n, ok := expr.(*ast.Number)
+	return ok && n.Value == value
+}
+
+// number creates a number literal positioned at t
+func number(t token.T, value float64) *ast.Number {
+	t.Type = token.FLOAT
+	if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+		t.Type = token.INT
+	}
+	t.Literal = strconv.FormatFloat(value, 'f', -1, 64)
+	return &ast.Number{Token: t, Value: value}
+}
+
+// boolean creates a boolean literal positioned at t
+func boolean(t token.T, value bool) *ast.Boolean {
+	t.Type = token.FALSE
+	t.Literal = "false"
+	if value {
+		t.Type = token.TRUE
+		t.Literal = "true"
+	}
+	return &ast.Boolean{Token: t, Value: value}
+}
@@ -0,0 +1,177 @@
+package optimize
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/lexer"
+)
+
+// O rewrites a resolved program in place before it is compiled
+// or evaluated. It folds operations on literals into literals and
+// removes operations that cannot change their operand, reporting
+// operations that are certain to fail, such as 1 / 0. Code that
+// can never run is removed with a warning, like statements after
+// a return or the branches of if false.
+//
+// Identifiers are never replaced, so the symbol table of
+// the resolver remains valid for the rewritten program.
+type O struct {
+	l *lexer.L
+
+	sourceName string
+
+	errs     []OptimizeErr
+	warnings []OptimizeErr
+}
+
+// New creates a new optimizer, l is used
+// to highlight the offending source lines
+func New(l *lexer.L, sourceName string) *O {
+	return &O{
+		l:          l,
+		sourceName: sourceName,
+		errs:       make([]OptimizeErr, 0),
+		warnings:   make([]OptimizeErr, 0),
+	}
+}
+
+// Errors returns the errors that occured during optimization
+func (o *O) Errors() []OptimizeErr {
+	return o.errs
+}
+
+// HasErrors returns true if there are any errors
+func (o *O) HasErrors() bool {
+	return len(o.errs) > 0
+}
+
+// Warnings returns the warnings that occured during optimization
+func (o *O) Warnings() []OptimizeErr {
+	return o.warnings
+}
+
+// Optimize rewrites the statements of program
+func (o *O) Optimize(program *ast.Program) {
+	program.Statements = o.statements(program.Statements)
+}
+
+// statement rewrites the expressions of stmt and
+// returns what stmt should be replaced with
+func (o *O) statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression)
+		// if true { ... } is the block it takes
+		if ie, ok := stmt.Expression.(*ast.IfExpression); ok && len(ie.Elifs) == 0 && ie.Else == nil {
+			if taken, known := truthy(ie.If.Condition); known && taken {
+				return ie.If.Body
+			}
+		}
+	case *ast.AssignStatement:
+		stmt.Right = o.expression(stmt.Right)
+	case *ast.BlockStatement:
+		o.block(stmt)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.expression(stmt.ReturnValue)
+	case *ast.ThrowStatement:
+		stmt.Value = o.expression(stmt.Value)
+	case *ast.YieldStatement:
+		stmt.Value = o.expression(stmt.Value)
+	case *ast.TryStatement:
+		o.block(stmt.Body)
+		if stmt.Catch != nil {
+			o.block(stmt.Catch.Body)
+		}
+		o.block(stmt.Finally)
+	case *ast.ExportStatement:
+		o.statement(stmt.Statement)
+	case *ast.SelectStatement:
+		for _, c := range stmt.Cases {
+			o.call(c.Call)
+			o.block(c.Body)
+		}
+		o.block(stmt.Default)
+	}
+	return stmt
+}
+
+func (o *O) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	block.Statements = o.statements(block.Statements)
+}
+
+// expression rewrites the children of expr and
+// returns what expr should be replaced with
+func (o *O) expression(expr ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		expr.Right = o.expression(expr.Right)
+		return o.foldPrefix(expr)
+	case *ast.InfixExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Right = o.expression(expr.Right)
+		return o.foldInfix(expr)
+	case *ast.Array:
+		o.list(expr.Elements)
+	case *ast.Dict:
+		for i, pair := range expr.Pairs {
+			expr.Pairs[i] = ast.Pair{Key: o.expression(pair.Key), Value: o.expression(pair.Value)}
+		}
+	case *ast.Spread:
+		expr.Value = o.expression(expr.Value)
+	case *ast.NamedArgument:
+		expr.Value = o.expression(expr.Value)
+	case *ast.PropagateExpression:
+		expr.Value = o.expression(expr.Value)
+	case *ast.IndexExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Index = o.expression(expr.Index)
+	case *ast.SliceExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Start = o.expression(expr.Start)
+		expr.End = o.expression(expr.End)
+		expr.Step = o.expression(expr.Step)
+	case *ast.MemberExpression:
+		expr.Left = o.expression(expr.Left)
+	case *ast.TernaryExpression:
+		expr.Condition = o.expression(expr.Condition)
+		expr.Consequence = o.expression(expr.Consequence)
+		expr.Alternative = o.expression(expr.Alternative)
+	case *ast.CallExpression:
+		o.call(expr)
+	case *ast.SpawnExpression:
+		o.call(expr.Call)
+	case *ast.AwaitExpression:
+		expr.Value = o.expression(expr.Value)
+	case *ast.IfExpression:
+		return o.foldIf(expr)
+	case *ast.ForExpression:
+		expr.Assignment.Right = o.expression(expr.Assignment.Right)
+		o.block(expr.Body)
+	case *ast.RangeExpression:
+		expr.Start = o.expression(expr.Start)
+		expr.End = o.expression(expr.End)
+		expr.Step = o.expression(expr.Step)
+	case *ast.Function:
+		for _, p := range expr.Parameters {
+			p.Default = o.expression(p.Default)
+		}
+		o.block(expr.Body)
+	}
+	return expr
+}
+
+func (o *O) call(call *ast.CallExpression) {
+	if call == nil {
+		return
+	}
+	call.Function = o.expression(call.Function)
+	o.list(call.Arguments)
+}
+
+func (o *O) list(expressions []ast.Expression) {
+	for i, e := range expressions {
+		expressions[i] = o.expression(e)
+	}
+}
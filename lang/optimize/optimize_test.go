@@ -0,0 +1,240 @@
+package optimize
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/evaluator"
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/parser"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 * 60 * 60;", "18000"},
+		{"1 + 2 * 3 - 4 / 2;", "5"},
+		{"1 / 4;", "0.25"},
+		{"-(2 + 3);", "-5"},
+		{"--1;", "1"},
+		{"!true;", "false"},
+		{"!!false;", "false"},
+		{"!1;", "(!1)"},
+		{"1 < 2;", "true"},
+		{"2 >= 3;", "false"},
+		{`"a" + "b" + "c";`, `"abc"`},
+		{`"a" < "b";`, "true"},
+		{`"a" - "b";`, `("a" - "b")`},
+		{"1 == 1.0;", "true"},
+		{`1 == "1";`, "false"},
+		{`"a" != "a";`, "false"},
+		{"null == null;", "true"},
+		{"null != false;", "true"},
+		{"true == !false;", "true"},
+		{"[1] == [1];", "([1] == [1])"},
+		{"let x = 1; x * 1;", "let x = 1;(x * 1)"},
+		{"let x = 1; x + 0;", "let x = 1;(x + 0)"},
+		{`let x = "a"; x + 0;`, `let x = "a";(x + 0)`},
+		{"let x = 1; -x + 0;", "let x = 1;((-x) + 0)"},
+		{"let x = 1; 0 + (x - 1);", "let x = 1;(0 + (x - 1))"},
+		{"let x = 1; -x - 0;", "let x = 1;(-x)"},
+		{"let x = 1; (x * 2) * 1;", "let x = 1;(x * 2)"},
+		{"let x = 1; 1 * (x / 2);", "let x = 1;(x / 2)"},
+		{"let x = 1; (x - 1) - 0;", "let x = 1;(x - 1)"},
+		{"let x = 1; 0 - (x - 1);", "let x = 1;(0 - (x - 1))"},
+		{"let x = 1; (x * 3) / 1;", "let x = 1;(x * 3)"},
+		{"let x = 1; (x + 1) * 1;", "let x = 1;((x + 1) * 1)"},
+		{"let x = 1; (x - 1 + 2) * 1;", "let x = 1;((x - 1) + 2)"},
+		{"let x = 1; (x ? 1 : 2) * 1;", "let x = 1;(x ? 1 : 2)"},
+		{"let x = 1; x - 1 * 2;", "let x = 1;(x - 2)"},
+		{"fn f(a = 2 * 3) { return a * (1 + 1); }", "fn f(a = 6) { return (a * 2); }"},
+		{"for const i = 0..2 * 5 { i * (60 * 60); }", "for const i = (0..10);{ (i * 3600) }"},
+		{"[1 + 1, f(2 * 2)];", "[2, f(4)]"},
+	}
+	for i, tt := range tests {
+		program, o := optimizeProgram(t, tt.input, fmt.Sprintf("fold-%d", i))
+		for _, err := range o.Errors() {
+			t.Errorf("unexpected error for %q: %s", tt.input, err.Msg)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong program for %q\nwant=%s\ngot=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFoldedTokens(t *testing.T) {
+	program, _ := optimizeProgram(t, "let x = 3 * 0.5;\nlet y = 1 - 3;", "tokens")
+	tests := []struct {
+		literal string
+		line    int
+		col     int
+	}{
+		{"1.5", 1, 11},
+		{"-2", 2, 11},
+	}
+	for i, tt := range tests {
+		n := program.Statements[i].(*ast.AssignStatement).Right.(*ast.Number)
+		if n.Token.Literal != tt.literal || n.Token.Line != tt.line || n.Token.Col != tt.col {
+			t.Errorf("wrong token, want=%s at L%d:C%d, got=%s", tt.literal, tt.line, tt.col, n.Token)
+		}
+	}
+}
+
+func TestOptimizeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"1 / 0;", []string{"division by zero at\n\tdiv-0:L1:C3"}},
+		{"1 / (2 - 2);", []string{"division by zero at\n\tdiv-1:L1:C3"}},
+		{"let x = 1; -x / 0;", []string{"division by zero"}},
+		{"fn f() { return 5 * 60 / (60 - 60); }", []string{"division by zero"}},
+		{"1 / 0; [2 / 0.0];", []string{"division by zero", "division by zero"}},
+	}
+	for i, tt := range tests {
+		_, o := optimizeProgram(t, tt.input, fmt.Sprintf("div-%d", i))
+		errs := o.Errors()
+		if len(errs) != len(tt.expected) {
+			t.Fatalf("wrong number of errors for %q, want=%d, got=%d",
+				tt.input, len(tt.expected), len(errs))
+		}
+		for j, want := range tt.expected {
+			if !strings.HasPrefix(errs[j].Msg, "OptimizeError: ") || !strings.Contains(errs[j].Msg, want) {
+				t.Errorf("unexpected error for %q\nwant=%q\ngot=%q", tt.input, want, errs[j].Msg)
+			}
+		}
+	}
+	for _, input := range []string{"let x = 1; x / 0;", `"a" / 0;`} {
+		if _, o := optimizeProgram(t, input, "div"); o.HasErrors() {
+			t.Errorf("unexpected error for %q: %s", input, o.Errors()[0].Msg)
+		}
+	}
+}
+
+func TestEliminateDeadCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		warnings []string
+	}{
+		{"fn f() { return 1; 2; }", "fn f() { return 1; }", []string{"L1:C20"}},
+		{"fn f() { throw 1; let x = 2; x; }", "fn f() { throw 1;let x = null; }", []string{"L1:C19"}},
+		{"{ return 1; } 2; 3;", "{ return 1; }", []string{"L1:C15"}},
+		{"fn f() { return 1;\n}", "fn f() { return 1; }", nil},
+		{
+			"fn f(x) { if x { return 1; } else { throw 2; } x; }",
+			"fn f(x) { if x { return 1; }else { throw 2; } }",
+			[]string{"L1:C48"},
+		},
+		{"fn f(x) { if x { return 1; } x; }", "fn f(x) { if x { return 1; }x }", nil},
+		{"if false { 1; } else { 2; }", "{ 2 }", []string{"L1:C12"}},
+		{"if false { }", "null", nil},
+		{"if 1 > 2 { 1; } 3;", "3", []string{"L1:C12"}},
+		{"if true { 1 } else { 2 }", "{ 1 }", []string{"L1:C22"}},
+		{"let x = if false { 1 };", "let x = null;", []string{"L1:C20"}},
+		{
+			"let x = 1; if x { 1 } elif false { 2 } elif true { 3 } else { 4 }",
+			"let x = 1;if x { 1 }else { 3 }",
+			[]string{"L1:C36", "L1:C63"},
+		},
+		{
+			"let x = if null { 1 } elif 0 { 2 } else { 3 };",
+			"let x = if 0 { 2 };",
+			[]string{"L1:C19", "L1:C43"},
+		},
+		{"1; 2; let x = 1; x; 3;", "let x = 1;x3", nil},
+		{"fn f() { return 1; if false { 1 / 0 } }", "fn f() { return 1; }", []string{"L1:C20"}},
+		{
+			"fn f() { const g = fn() { return y; }; return g(); let y = 1; fn h() {} }",
+			"fn f() { const g = fn() { return y; };return g();let y = null;let h = null; }",
+			[]string{"L1:C52"},
+		},
+	}
+	for i, tt := range tests {
+		program, o := optimizeProgram(t, tt.input, fmt.Sprintf("dead-%d", i))
+		for _, err := range o.Errors() {
+			t.Errorf("unexpected error for %q: %s", tt.input, err.Msg)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong program for %q\nwant=%s\ngot=%s", tt.input, tt.expected, got)
+		}
+		warnings := o.Warnings()
+		if len(warnings) != len(tt.warnings) {
+			t.Errorf("wrong number of warnings for %q, want=%d, got=%d",
+				tt.input, len(tt.warnings), len(warnings))
+			continue
+		}
+		for j, want := range tt.warnings {
+			want = fmt.Sprintf("OptimizeWarning: unreachable code at\n\tdead-%d:%s", i, want)
+			if warnings[j].Severity != WARNING || !strings.HasPrefix(warnings[j].Msg, want) {
+				t.Errorf("unexpected warning for %q\nwant prefix=%q\ngot=%q", tt.input, want, warnings[j].Msg)
+			}
+		}
+	}
+}
+
+func TestWarningHighlight(t *testing.T) {
+	_, o := optimizeProgram(t, "fn f() {\n\treturn 1;\n\tlet y = 2;\n}", "highlight")
+	if o.HasErrors() || len(o.Warnings()) != 1 {
+		t.Fatalf("expected a single warning, got errors=%d warnings=%d", len(o.Errors()), len(o.Warnings()))
+	}
+	w := o.Warnings()[0]
+	if w.Line != "\t\x1b[31mlet\x1b[0m y = 2;" {
+		t.Errorf("unexpected highlighted line, got=%q", w.Line)
+	}
+	if w.T.Line != 3 || w.T.Col != 2 || w.Severity.String() != "Warning" {
+		t.Errorf("unexpected warning token, got=%s %s", w.Severity, w.T)
+	}
+}
+
+// TestOptimizePreservesResults evaluates every program
+// before and after it is optimized
+func TestOptimizePreservesResults(t *testing.T) {
+	tests := []string{
+		"let s = 0; for const i = 0..10 { s = s + i * (60 - 59) + 0; } s;",
+		`let x = "a"; x + 0;`,
+		"let x = 2; [x * 1, 1 * x, x / 1, x - 0, -x + 0];",
+		"let x = 0; [-x + 0, 0 + -x, -x - 0, -x * 1, 1 * -x, -x / 1];",
+		"fn f(a = 2 * 3) { return a * (1 + 1) / 1; } [f(), f(1)];",
+		"if 1 < 2 == !false { 5 * 60 * 60 } else { 0 }",
+		`["a" + "b" < "b", 1 == "1", null == null];`,
+		"let x = null; (x * 1) ?? 2;",
+		"fn f(x) { if x { return 1; } elif false { return 2; } else { throw 3; } 4; } let r = f(true); try { f(false); } catch e { r = [r, e]; } r;",
+		"let x = if null { 1 } elif 0 { 2 } else { 3 }; [x, if false { 1 }];",
+		"fn f() { const g = fn() { return y; }; return g; let y = 1; } f();",
+	}
+	for i, input := range tests {
+		want := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		program, o := optimizeProgram(t, input, fmt.Sprintf("preserve-%d", i))
+		if o.HasErrors() {
+			t.Fatalf("unexpected error for %q: %s", input, o.Errors()[0].Msg)
+		}
+		got := evaluator.Eval(program, object.NewEnvironment())
+		if got.String() != want.String() {
+			t.Errorf("optimized %q evaluates differently\nwant=%s\ngot=%s", input, want, got)
+		}
+	}
+}
+
+func optimizeProgram(t *testing.T, input, name string) (*ast.Program, *O) {
+	t.Helper()
+	program := parse(t, input)
+	o := New(lexer.FromString(input), name)
+	o.Optimize(program)
+	return program, o
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.FromString(input), "test")
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Fatal(err.Msg)
+	}
+	return program
+}
@@ -20,8 +20,17 @@ func makeInfixMap(p *P) infixMap {
 		token.LTOE:     p.parseInfixExpression,
 		token.GT:       p.parseInfixExpression,
 		token.GTOE:     p.parseInfixExpression,
+		token.QUESTION: p.parsePropagateExpression,
 		token.LPAREN:   p.parseCallExpression,
 		token.LBRACKET: p.parseIndexExpression,
+		token.QBRACKET: p.parseIndexExpression,
+		token.QDOT:     p.parseMemberExpression,
+		token.DOT:      p.parseMemberExpression,
+		token.NULLISH:  p.parseInfixExpression,
+		token.TERNARY:  p.parseTernaryExpression,
+		token.PIPE:     p.parsePipeExpression,
+		token.DOTDOT:   p.parseRangeExpression,
+		token.DOTDOTEQ: p.parseRangeExpression,
 	}
 }
 
@@ -38,13 +47,125 @@ func (p *P) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *P) parsePropagateExpression(left ast.Expression) ast.Expression {
+	return &ast.PropagateExpression{Token: p.cur, Value: left}
+}
+
+// parseTernaryExpression parses cond ? a : b, the
+// alternative is parsed with LOWEST precedence which
+// makes nested ternaries associate to the right
+func (p *P) parseTernaryExpression(left ast.Expression) ast.Expression {
+	expression := &ast.TernaryExpression{
+		Token:     p.cur,
+		Condition: left,
+	}
+	p.advance() // consume '?'
+	expression.Consequence = p.parseExpression(LOWEST)
+	if !p.expectNext(token.COLON) {
+		return nil
+	}
+	p.advance() // consume consequence
+	p.advance() // consume ':'
+	expression.Alternative = p.parseExpression(LOWEST)
+	return expression
+}
+
+// parsePipeExpression desugars x |> f(y) into f(x, y) and x |> f
+// into f(x). The call carries the '|>' token so that runtime
+// errors point at the pipe rather than at the original call.
+func (p *P) parsePipeExpression(left ast.Expression) ast.Expression {
+	pipe := p.cur
+	p.advance() // consume '|>'
+	right := p.parseExpression(PIPELINE)
+	if right == nil {
+		return nil
+	}
+	if call, ok := right.(*ast.CallExpression); ok {
+		args := append([]ast.Expression{left}, call.Arguments...)
+		return &ast.CallExpression{Token: pipe, Function: call.Function, Arguments: args}
+	}
+	return &ast.CallExpression{Token: pipe, Function: right, Arguments: []ast.Expression{left}}
+}
+
+// parseRangeExpression parses start..end, start..=end and
+// start.. with an optional step. left is nil for ..end
+func (p *P) parseRangeExpression(left ast.Expression) ast.Expression {
+	expression := &ast.RangeExpression{
+		Token:     p.cur,
+		Start:     left,
+		Inclusive: p.cur.Type == token.DOTDOTEQ,
+	}
+	// a '{' after an open range starts the body of a for loop
+	if _, ok := p.prefixMap[p.next.Type]; ok && p.next.Type != token.LBRACE {
+		p.advance() // consume '..' or '..='
+		expression.End = p.parseExpression(RANGE)
+	} else if expression.Inclusive {
+		perr(p, p.cur, "inclusive range %q requires an end", p.cur.Literal)
+		return nil
+	}
+	if p.next.Type == token.STEP {
+		p.advance() // consume end
+		p.advance() // consume 'step'
+		expression.Step = p.parseExpression(RANGE)
+	}
+	return expression
+}
+
+func (p *P) parseMemberExpression(left ast.Expression) ast.Expression {
+	expression := &ast.MemberExpression{
+		Token:    p.cur,
+		Left:     left,
+		Optional: p.cur.Type == token.QDOT,
+	}
+	if !p.expectNext(token.IDENTIFIER) {
+		return nil
+	}
+	p.advance() // consume '.' or '?.'
+	expression.Member = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+	return expression
+}
+
+// parseIndexExpression parses Left[Index] or,
+// if a ':' is seen, Left[Start:End:Step]
 func (p *P) parseIndexExpression(left ast.Expression) ast.Expression {
 	expression := &ast.IndexExpression{
-		Token: p.cur,
-		Left:  left,
+		Token:    p.cur,
+		Left:     left,
+		Optional: p.cur.Type == token.QBRACKET,
+	}
+	if p.next.Type == token.COLON {
+		return p.parseSliceExpression(expression, nil)
 	}
-	p.advance() // consume '['
+	p.advance() // consume '[' or '?['
 	expression.Index = p.parseExpression(LOWEST)
+	if p.next.Type == token.COLON {
+		return p.parseSliceExpression(expression, expression.Index)
+	}
+	if !p.expectNext(token.RBRACKET) {
+		return nil
+	}
+	p.advance() // consume ']'
+	return expression
+}
+
+// parseSliceExpression parses the remainder of a slice after its
+// start, which is nil if omitted. The next token must be ':'
+func (p *P) parseSliceExpression(index *ast.IndexExpression, start ast.Expression) ast.Expression {
+	expression := &ast.SliceExpression{
+		Token:    index.Token,
+		Left:     index.Left,
+		Start:    start,
+		Optional: index.Optional,
+	}
+	p.advance() // consume '[' or start
+	expression.End = p.parseSliceBound()
+	if p.next.Type == token.COLON {
+		p.advance() // consume ':' or end
+		if expression.Step = p.parseSliceBound(); expression.Step == nil {
+			perr(p, p.cur, "slice step must not be empty")
+			return nil
+		}
+	}
 	if !p.expectNext(token.RBRACKET) {
 		return nil
 	}
@@ -52,11 +173,48 @@ func (p *P) parseIndexExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseSliceBound parses the expression after the current ':',
+// returning nil if it is omitted i.e the next token is ':' or ']'
+func (p *P) parseSliceBound() ast.Expression {
+	if p.next.Type == token.COLON || p.next.Type == token.RBRACKET {
+		return nil
+	}
+	p.advance() // consume ':'
+	return p.parseExpression(LOWEST)
+}
+
 func (p *P) parseCallExpression(left ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{
 		Token:    p.cur,
 		Function: left,
 	}
-	expression.Arguments = p.parseExpressionList(token.RPAREN)
+	named := make(map[string]bool)
+	expression.Arguments = p.parseExpressionList(token.RPAREN, func() ast.Expression {
+		return p.parseCallArgument(named)
+	})
 	return expression
 }
+
+// parseCallArgument parses a positional, spread or named argument
+// i.e port: 5432. named holds the named arguments seen so far in the call
+// and is used to ensure that positional arguments precede named arguments
+func (p *P) parseCallArgument(named map[string]bool) ast.Expression {
+	if p.cur.Type != token.IDENTIFIER || p.next.Type != token.COLON {
+		if len(named) > 0 {
+			perr(p, p.cur, "positional argument %q follows named argument", p.cur.Literal)
+		}
+		return p.parseListElement()
+	}
+	arg := &ast.NamedArgument{
+		Token: p.cur,
+		Name:  &ast.Identifier{Token: p.cur, Value: p.cur.Literal},
+	}
+	if named[arg.Name.Value] {
+		perr(p, p.cur, "named argument %q given more than once", arg.Name.Value)
+	}
+	named[arg.Name.Value] = true
+	p.advance() // consume 'identifier'
+	p.advance() // consume ':'
+	arg.Value = p.parseExpression(LOWEST)
+	return arg
+}
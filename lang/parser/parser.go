@@ -19,6 +19,12 @@ type P struct {
 	prefixMap prefixMap
 	infixMap  infixMap
 
+	// functions whose bodies are being parsed, innermost last
+	functions []*ast.Function
+
+	// questions caches what the '?' at a position was found to be
+	questions map[position]token.Type
+
 	errs []ParseErr
 }
 
@@ -28,6 +34,7 @@ func New(l *lexer.L, sourceName string) *P {
 		l:          l,
 		sourceName: sourceName,
 		errs:       make([]ParseErr, 0),
+		questions:  make(map[position]token.Type),
 	}
 	p.prefixMap = makePrefixMap(p)
 	p.infixMap = makeInfixMap(p)
@@ -119,12 +126,86 @@ func (p *P) parseStatement() ast.Statement {
 			return p.parseAssignment(&ast.AssignStatement{Token: p.cur}, true)
 		}
 	case token.RETURN:
-		return nil
-		//return p.parseReturnStatement()
+		return p.parseReturnStatement()
+	case token.LBRACE:
+		return p.parseBlockStatement()
+	case token.FN:
+		return p.parseFunctionStatement(p.parseFunctionLiteral)
+	case token.ASYNC:
+		return p.parseFunctionStatement(p.parseAsyncFunction)
+	case token.FOR:
+		return p.parseCompoundStatement(p.parseForExpression)
+	case token.IF:
+		return p.parseCompoundStatement(p.parseIfExpression)
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.TRY:
+		return p.parseTryStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.YIELD:
+		return p.parseYieldStatement()
+	case token.SELECT:
+		return p.parseSelectStatement()
 	}
 	return p.parseExpressionStatement()
 }
 
+// parseCompoundStatement parses an expression ending in a block, such
+// as a named function or a for loop, at the start of a statement. Unlike
+// other expressions it is not continued by an infix operator
+// i.e fn f() {} [1, 2] is two statements
+func (p *P) parseCompoundStatement(parse prefixFn) ast.Statement {
+	stmt := &ast.ExpressionStatement{Token: p.cur}
+	if stmt.Expression = parse(); stmt.Expression == nil {
+		return nil
+	}
+	if p.next.Type == token.SCOLON {
+		p.advance() // consume ';'
+	}
+	return stmt
+}
+
+// parseFunctionStatement parses a function at the start of a statement.
+// Named functions and methods are declarations and, like compound
+// statements, are not continued by an infix operator. An anonymous
+// function is an expression i.e fn() { }()
+func (p *P) parseFunctionStatement(parse prefixFn) ast.Statement {
+	stmt := &ast.ExpressionStatement{Token: p.cur}
+	if stmt.Expression = parse(); stmt.Expression == nil {
+		return nil
+	}
+	if fn := stmt.Expression.(*ast.Function); fn.Name == nil {
+		stmt.Expression = p.parseInfix(fn, LOWEST)
+	}
+	if p.next.Type == token.SCOLON {
+		p.advance() // consume ';'
+	}
+	return stmt
+}
+
+// parseReturnStatement parses a return statement,
+// the return value is nil if absent i.e return;
+func (p *P) parseReturnStatement() *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Token: p.cur}
+	if p.next.Type == token.SCOLON || p.next.Type == token.RBRACE {
+		if p.next.Type == token.SCOLON {
+			p.advance() // consume 'return'
+		}
+		return stmt
+	}
+	p.advance() // consume 'return'
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+	if p.next.Type == token.SCOLON {
+		p.advance() // consume ';'
+	}
+	return stmt
+}
+
 // parseAssignment parses an assignment statement
 func (p *P) parseAssignment(t *ast.AssignStatement, reassign bool) *ast.AssignStatement {
 	if !reassign && !p.expectNext(token.IDENTIFIER) {
@@ -146,17 +227,289 @@ func (p *P) parseAssignment(t *ast.AssignStatement, reassign bool) *ast.AssignSt
 	return t
 }
 
+// parseStructStatement parses a struct declaration i.e struct Point { x, y }
+func (p *P) parseStructStatement() ast.Statement {
+	stmt := &ast.StructStatement{Token: p.cur}
+	if !p.expectNext(token.IDENTIFIER) {
+		return nil
+	}
+	p.advance() // consume 'struct'
+	stmt.Name = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	p.advance() // consume 'identifier'
+	seen := make(map[string]bool)
+	for p.next.Type != token.RBRACE {
+		if !p.expectNext(token.IDENTIFIER) {
+			return nil
+		}
+		p.advance() // consume '{' or ','
+		field := &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+		if seen[field.Value] {
+			perr(p, p.cur, "duplicate field %q in struct %q", field.Value, stmt.Name.Value)
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+		if p.next.Type != token.COMMA {
+			break
+		}
+		p.advance() // consume 'identifier'
+	}
+	if !p.expectNext(token.RBRACE) {
+		return nil
+	}
+	p.advance() // consume '{' or the last field
+	if p.next.Type == token.SCOLON {
+		p.advance() // consume ';'
+	}
+	return stmt
+}
+
+// parseImportStatement parses import "path" as alias;
+func (p *P) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.cur}
+	if !p.cur.Global() {
+		perr(p, p.cur, "import is only allowed at the top level")
+		return nil
+	}
+	if !p.expectNext(token.STRING) {
+		return nil
+	}
+	p.advance() // consume 'import'
+	stmt.Path = &ast.String{Token: p.cur, Value: p.cur.Literal}
+	if !p.expectNext(token.AS) {
+		return nil
+	}
+	p.advance() // consume 'string'
+	if !p.expectNext(token.IDENTIFIER) {
+		return nil
+	}
+	p.advance() // consume 'as'
+	stmt.Alias = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+	if p.next.Type == token.SCOLON {
+		p.advance() // consume ';'
+	}
+	return stmt
+}
+
+// parseExportStatement parses a declaration prefixed with export
+func (p *P) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.cur}
+	if !p.cur.Global() {
+		perr(p, p.cur, "export is only allowed at the top level")
+		return nil
+	}
+	p.advance() // consume 'export'
+	switch {
+	case p.cur.Type == token.LET, p.cur.Type == token.CONST:
+		if assign := p.parseAssignment(&ast.AssignStatement{Token: p.cur}, false); assign != nil {
+			stmt.Statement = assign
+		}
+	case p.cur.Type == token.FN && p.next.Type == token.IDENTIFIER:
+		stmt.Statement = p.parseCompoundStatement(p.parseFunctionLiteral)
+	case p.cur.Type == token.ASYNC:
+		t := p.cur
+		es, _ := p.parseCompoundStatement(p.parseAsyncFunction).(*ast.ExpressionStatement)
+		if es == nil {
+			return nil
+		}
+		if fn := es.Expression.(*ast.Function); fn.Name == nil || fn.Receiver != nil {
+			perr(p, t, "export must be followed by a let, const, fn or struct declaration")
+			return nil
+		}
+		stmt.Statement = es
+	case p.cur.Type == token.STRUCT:
+		stmt.Statement = p.parseStructStatement()
+	default:
+		perr(p, p.cur, "export must be followed by a let, const, fn or struct declaration")
+	}
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
+// parseYieldStatement parses yield x; which
+// turns the enclosing function into a generator
+func (p *P) parseYieldStatement() ast.Statement {
+	stmt := &ast.YieldStatement{Token: p.cur}
+	if len(p.functions) == 0 {
+		perr(p, p.cur, "yield outside of a function")
+		return nil
+	}
+	fn := p.functions[len(p.functions)-1]
+	if fn.Async {
+		perr(p, p.cur, "yield in an async function")
+		return nil
+	}
+	fn.Generator = true
+	p.advance() // consume 'yield'
+	if stmt.Value = p.parseExpression(LOWEST); stmt.Value == nil {
+		return nil
+	}
+	if p.next.Type == token.SCOLON {
+		p.advance() // consume ';'
+	}
+	return stmt
+}
+
+// parseThrowStatement parses a throw statement i.e throw "failed";
+func (p *P) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.cur}
+	p.advance() // consume 'throw'
+	if stmt.Value = p.parseExpression(LOWEST); stmt.Value == nil {
+		return nil
+	}
+	if p.next.Type == token.SCOLON {
+		p.advance() // consume ';'
+	}
+	return stmt
+}
+
+// parseTryStatement parses a try statement with
+// a catch clause, a finally block or both
+func (p *P) parseTryStatement() ast.Statement {
+	stmt := &ast.TryStatement{Token: p.cur}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	p.advance() // consume 'try'
+	stmt.Body = p.parseBlockStatement()
+	if p.next.Type == token.CATCH {
+		p.advance() // consume '}'
+		stmt.Catch = &ast.CatchClause{Token: p.cur}
+		if p.next.Type == token.IDENTIFIER {
+			p.advance() // consume 'catch'
+			stmt.Catch.Param = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+		}
+		if !p.expectNext(token.LBRACE) {
+			return nil
+		}
+		p.advance() // consume 'catch' or 'identifier'
+		stmt.Catch.Body = p.parseBlockStatement()
+	}
+	if p.next.Type == token.FINALLY {
+		p.advance() // consume '}'
+		if !p.expectNext(token.LBRACE) {
+			return nil
+		}
+		p.advance() // consume 'finally'
+		stmt.Finally = p.parseBlockStatement()
+	}
+	if stmt.Catch == nil && stmt.Finally == nil {
+		perr(p, stmt.Token, "try without catch or finally")
+		return nil
+	}
+	return stmt
+}
+
+// parseSelectStatement parses a select statement with
+// receive and send cases and an optional else case
+func (p *P) parseSelectStatement() ast.Statement {
+	stmt := &ast.SelectStatement{Token: p.cur}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	p.advance() // consume 'select'
+	for p.next.Type != token.RBRACE {
+		if p.next.Type == token.EOF {
+			expectErr(p, p.next, token.RBRACE)
+			return nil
+		}
+		p.advance() // consume '{' or '}'
+		if p.cur.Type != token.ELSE {
+			c := p.parseSelectCase()
+			if c == nil {
+				return nil
+			}
+			stmt.Cases = append(stmt.Cases, c)
+			continue
+		}
+		if stmt.Default != nil {
+			perr(p, p.cur, "select has more than one else case")
+			return nil
+		}
+		if !p.expectNext(token.LBRACE) {
+			return nil
+		}
+		p.advance() // consume 'else'
+		stmt.Default = p.parseBlockStatement()
+	}
+	p.advance() // consume '}'
+	return stmt
+}
+
+// parseSelectCase parses let v = ch.recv() { ... },
+// ch.recv() { ... } or ch.send(x) { ... }
+func (p *P) parseSelectCase() *ast.SelectCase {
+	c := &ast.SelectCase{Token: p.cur}
+	if p.cur.Type == token.LET || p.cur.Type == token.CONST {
+		if !p.expectNext(token.IDENTIFIER) {
+			return nil
+		}
+		p.advance() // consume 'let' or 'const'
+		c.Binding = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+		if !p.expectNext(token.ASSIGN) {
+			return nil
+		}
+		p.advance() // consume 'identifier'
+		p.advance() // consume '='
+	}
+	t := p.cur
+	c.Call, _ = p.parseExpression(LOWEST).(*ast.CallExpression)
+	if !isSelectCall(c.Call, c.Binding == nil) {
+		perr(p, t, "select case must be a channel operation i.e ch.recv() or ch.send(x)")
+		return nil
+	}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	p.advance() // consume ')'
+	c.Body = p.parseBlockStatement()
+	return c
+}
+
+// isSelectCall reports whether call is ch.recv() or,
+// if send is allowed, ch.send(x)
+func isSelectCall(call *ast.CallExpression, send bool) bool {
+	if call == nil {
+		return false
+	}
+	member, ok := call.Function.(*ast.MemberExpression)
+	if !ok || member.Optional {
+		return false
+	}
+	switch member.Member.Value {
+	case "recv":
+		return len(call.Arguments) == 0
+	case "send":
+		if !send || len(call.Arguments) != 1 {
+			return false
+		}
+		switch call.Arguments[0].(type) {
+		case *ast.NamedArgument, *ast.Spread:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
 // parseExpression parses an expression and returns the AST node
 func (p *P) parseExpression(pr pred) ast.Expression {
-	var (
-		prefix prefixFn
-		infix  infixFn
-	)
-	if prefix = p.expectPrefix(); prefix == nil {
+	prefix := p.expectPrefix()
+	if prefix == nil {
 		return nil
 	}
-	leftExp := prefix() // consume lhs
-	for p.next.Type != token.SCOLON && pr.lt(p.next) {
+	return p.parseInfix(prefix(), pr)
+}
+
+// parseInfix continues leftExp with infix
+// operators of higher precedence than pr
+func (p *P) parseInfix(leftExp ast.Expression, pr pred) ast.Expression {
+	var infix infixFn
+	for p.next.Type != token.SCOLON && pr.lt(p.question()) {
 		if infix = p.expectInfix(); infix == nil {
 			return leftExp
 		}
@@ -166,6 +519,53 @@ func (p *P) parseExpression(pr pred) ast.Expression {
 	return leftExp
 }
 
+type position struct{ line, col int }
+
+// question returns the next token, a '?' followed by an expression
+// and ':' is turned into a ternary, a '?' followed by any other '[' is
+// merged with it into the '?[' of x?[i] and any other '?' is the
+// postfix ? of x?. The tokens after the '?' are parsed ahead and then
+// rewound.
+func (p *P) question() token.T {
+	if p.next.Type != token.QUESTION {
+		return p.next
+	}
+	at := position{p.next.Line, p.next.Col}
+	typ, ok := p.questions[at]
+	if !ok {
+		l, cur, next, errs := *p.l, p.cur, p.next, len(p.errs)
+		var fn *ast.Function
+		var generator bool
+		if n := len(p.functions); n > 0 {
+			fn = p.functions[n-1]
+			generator = fn.Generator
+		}
+		p.advance() // consume the operand
+		p.advance() // consume '?'
+		typ = token.QUESTION
+		bracket := p.cur.Type == token.LBRACKET
+		if _, ok := p.prefixMap[p.cur.Type]; ok && p.parseExpression(LOWEST) != nil &&
+			len(p.errs) == errs && p.next.Type == token.COLON {
+			typ = token.TERNARY
+		} else if bracket {
+			typ = token.QBRACKET
+		}
+		*p.l, p.cur, p.next, p.errs = l, cur, next, p.errs[:errs]
+		if fn != nil {
+			fn.Generator = generator
+		}
+		p.questions[at] = typ
+	}
+	switch typ {
+	case token.TERNARY:
+		p.next.Type = token.TERNARY
+	case token.QBRACKET:
+		p.next.Type, p.next.Literal = token.QBRACKET, "?["
+		p.l.NextToken() // consume '[' which is part of '?['
+	}
+	return p.next
+}
+
 // parseExpressionStatement parses an expression statement
 func (p *P) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.cur}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/lindeneg/blue/lang/ast"
@@ -37,6 +38,447 @@ func TestAssignmentStatements(t *testing.T) {
 	}
 }
 
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return 5;", "return 5;"},
+		{"return x + y;", "return (x + y);"},
+		{"return;", "return;"},
+		{"fn() { return }", "fn() { return; }"},
+		{"fn() { return fn() { return 1; }; }", "fn() { return fn() { return 1; }; }"},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("return-statement-%d", i))
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestBlockStatements(t *testing.T) {
+	input := "let x = 1; { let x = 2; { x = 3; } }"
+	program := newProgram(t, input, "block.statement")
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	block, ok := program.Statements[1].(*ast.BlockStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.BlockStatement. got=%T",
+			program.Statements[1])
+	}
+	if len(block.Statements) != 2 {
+		t.Fatalf("block.Statements does not contain 2 statements. got=%d",
+			len(block.Statements))
+	}
+	if _, ok := block.Statements[1].(*ast.BlockStatement); !ok {
+		t.Fatalf("block.Statements[1] is not ast.BlockStatement. got=%T",
+			block.Statements[1])
+	}
+	want := "let x = 1;{ let x = 2;{ x = 3; } }"
+	if program.String() != want {
+		t.Errorf("expected=%q, got=%q", want, program.String())
+	}
+}
+
+func TestTryAndThrowStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "failed";`, `throw "failed";`},
+		{"throw f(x) + 1", "throw (f(x) + 1);"},
+		{"try { f(); } catch e { throw e; }", "try { f() } catch e { throw e; }"},
+		{"try { f(); } catch { g(); }", "try { f() } catch { g() }"},
+		{"try { f(); } finally { g(); }", "try { f() } finally { g() }"},
+		{
+			"try { f(); } catch e { g(e); } finally { h(); }",
+			"try { f() } catch e { g(e) } finally { h() }",
+		},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("try-statement-%d", i))
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+	program := newProgram(t, "try { f(); } catch err { g(); }", "try-statement")
+	stmt, ok := program.Statements[0].(*ast.TryStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.TryStatement. got=%T", program.Statements[0])
+	}
+	testLiteralExpression(t, stmt.Catch.Param, "err")
+	if stmt.Finally != nil {
+		t.Errorf("stmt.Finally is not nil. got=%q", stmt.Finally)
+	}
+}
+
+func TestTryStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f(); }", "try without catch or finally"},
+		{"try f();", `unexpected token, got="IDENTIFIER", want="{"`},
+		{"try { f(); } catch e f();", `unexpected token, got="IDENTIFIER", want="{"`},
+		{"try { f(); } finally f();", `unexpected token, got="IDENTIFIER", want="{"`},
+	}
+	for i, tt := range tests {
+		p := New(lexer.FromString(tt.input), fmt.Sprintf("try-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Fatalf("expected parse errors for %q", tt.input)
+		}
+		if !strings.Contains(p.Errors()[0].Msg, tt.expected) {
+			t.Errorf("unexpected error for %q\nwant=%q\ngot=%q",
+				tt.input, tt.expected, p.Errors()[0].Msg)
+		}
+	}
+}
+
+func TestSliceExpressionParsing(t *testing.T) {
+	program := newProgram(t, "arr[1:-1:2];", "slice.expression")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	slice, ok := stmt.Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.SliceExpression. got=%T", stmt.Expression)
+	}
+	if slice.Token.Type != token.LBRACKET {
+		t.Errorf("slice.Token is not '['. got=%q", slice.Token.Literal)
+	}
+	if !testIdentifier(t, "arr", slice.Left.String(), slice.Left.Literal()) {
+		return
+	}
+	if slice.Start == nil || slice.End == nil || slice.Step == nil {
+		t.Fatalf("expected start, end and step. got=%s", slice)
+	}
+	for i, tt := range []struct {
+		input    string
+		expected string
+	}{
+		{"a[1::]", "slice step must not be empty"},
+		{"a[1:2", `unexpected token, got="EOF", want="]"`},
+		{"a[1:2:3:4]", `unexpected token, got=":", want="]"`},
+	} {
+		p := New(lexer.FromString(tt.input), fmt.Sprintf("slice-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Fatalf("expected parse errors for %q", tt.input)
+		}
+		if !strings.Contains(p.Errors()[0].Msg, tt.expected) {
+			t.Errorf("unexpected error for %q\nwant=%q\ngot=%q",
+				tt.input, tt.expected, p.Errors()[0].Msg)
+		}
+	}
+}
+
+func TestStructStatementParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }", "struct Point { x, y }"},
+		{"struct Point {\n\tx,\n\ty,\n}", "struct Point { x, y }"},
+		{"struct Empty {}", "struct Empty { }"},
+		{"fn (p Point) len() { return p.x; }", "fn (p Point) len() { return (p.x); }"},
+		{"fn (p Point) scale(n = 2, ...rest) { }", "fn (p Point) scale(n = 2, ...rest) {  }"},
+		{"p.scale(2).len()", "((p.scale)(2).len)()"},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("struct-%d", i))
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("unexpected program for %q\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+	stmt, ok := newProgram(t, "struct P { x, y };", "struct").Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.StructStatement")
+	}
+	if stmt.Name.Value != "P" || len(stmt.Fields) != 2 || stmt.Fields[1].Value != "y" {
+		t.Errorf("unexpected struct, got=%s", stmt)
+	}
+}
+
+func TestStructStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct { x }", `unexpected token, got="{", want="IDENTIFIER"`},
+		{"struct P { x, x }", `duplicate field "x" in struct "P"`},
+		{"struct P { x y }", `unexpected token, got="IDENTIFIER", want="}"`},
+		{"struct P { 1 }", `unexpected token, got="INT", want="IDENTIFIER"`},
+		{"fn (p P, q) f() {}", `unexpected token, got=",", want=")"`},
+		{"fn (p P) () {}", `unexpected token, got="(", want="IDENTIFIER"`},
+		{"fn f(a b) {}", `unexpected token, got="IDENTIFIER", want=")"`},
+	}
+	for i, tt := range tests {
+		p := New(lexer.FromString(tt.input), fmt.Sprintf("struct-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Fatalf("expected parse errors for %q", tt.input)
+		}
+		if !strings.Contains(p.Errors()[0].Msg, tt.expected) {
+			t.Errorf("unexpected error for %q\nwant=%q\ngot=%q",
+				tt.input, tt.expected, p.Errors()[0].Msg)
+		}
+	}
+}
+
+func TestImportExportParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		names    []string
+	}{
+		{`import "lib/math" as math`, `import "lib/math" as math;`, nil},
+		{"export let x = 1;", "export let x = 1;", []string{"x"}},
+		{"export const x = 1", "export const x = 1;", []string{"x"}},
+		{"export fn f(a) { }", "export fn f(a) {  }", []string{"f"}},
+		{"export struct P { x }", "export struct P { x }", []string{"P"}},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("import-export-%d", i))
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("unexpected program for %q\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+		if export, ok := program.Statements[0].(*ast.ExportStatement); ok {
+			if names := export.Names(); strings.Join(names, ",") != strings.Join(tt.names, ",") {
+				t.Errorf("unexpected names for %q, want=%v, got=%v", tt.input, tt.names, names)
+			}
+		}
+	}
+}
+
+func TestImportExportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{ import "a" as a; }`, "import is only allowed at the top level"},
+		{"fn f() { export const x = 1; }", "export is only allowed at the top level"},
+		{"import a as b;", `unexpected token, got="IDENTIFIER", want="STRING"`},
+		{`import "a";`, `unexpected token, got=";", want="AS"`},
+		{`import "a" as 1;`, `unexpected token, got="INT", want="IDENTIFIER"`},
+		{"export 1;", "export must be followed by a let, const, fn or struct declaration"},
+		{"export fn (p P) f() {}", "export must be followed by a let, const, fn or struct declaration"},
+	}
+	for i, tt := range tests {
+		p := New(lexer.FromString(tt.input), fmt.Sprintf("import-export-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Fatalf("expected parse errors for %q", tt.input)
+		}
+		if !strings.Contains(p.Errors()[0].Msg, tt.expected) {
+			t.Errorf("unexpected error for %q\nwant=%q\ngot=%q",
+				tt.input, tt.expected, p.Errors()[0].Msg)
+		}
+	}
+}
+
+func TestYieldParsing(t *testing.T) {
+	program := newProgram(t, "fn gen() { yield 1; const f = fn() { return 2; }; for let x = xs { yield x; } }", "yield")
+	gen := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.Function)
+	if !gen.Generator {
+		t.Errorf("expected gen to be a generator")
+	}
+	assign := gen.Body.Statements[1].(*ast.AssignStatement)
+	if assign.Right.(*ast.Function).Generator {
+		t.Errorf("expected f not to be a generator")
+	}
+	if got := gen.Body.Statements[0].String(); got != "yield 1;" {
+		t.Errorf("unexpected yield statement, got=%q", got)
+	}
+	for i, input := range []string{"yield 1;", "{ yield 1; }", "fn f() { yield; }"} {
+		p := New(lexer.FromString(input), fmt.Sprintf("yield-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
+func TestSpawnAndSelectParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn f(x, y)", "(spawn f(x, y))"},
+		{"const t = spawn p.move(1);", "const t = (spawn (p.move)(1));"},
+		{"select { let v = a.recv() { f(v); } b.send(1) { } }",
+			"select { let v = (a.recv)() { f(v) } (b.send)(1) {  } }"},
+		{"select { c.recv() { } else { f(); } }",
+			"select { (c.recv)() {  } else { f() } }"},
+		{"select {}", "select { }"},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("concurrency-%d", i))
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected 1 statement for %q, got=%d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("unexpected statement, want=%q, got=%q", tt.expected, got)
+		}
+	}
+	errors := []string{
+		"spawn f",
+		"select { f() { } }",
+		"select { let v = a.send(1) { } }",
+		"select { a.recv(1) { } }",
+		"select { else { } else { } }",
+	}
+	for i, input := range errors {
+		p := New(lexer.FromString(input), fmt.Sprintf("concurrency-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
+func TestAsyncParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"async fn f(x) { return await g(x); }", "async fn f(x) { return (await g(x)); }"},
+		{"const f = async fn() { await a.b(); };", "const f = async fn() { (await (a.b)()) };"},
+		{"await f() + 1", "((await f()) + 1)"},
+		{"async fn (p P) m() { await p.f; }", "async fn (p P) m() { (await (p.f)) }"},
+		{"export async fn f() { }", "export async fn f() {  }"},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("async-%d", i))
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected 1 statement for %q, got=%d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("unexpected statement, want=%q, got=%q", tt.expected, got)
+		}
+	}
+	program := newProgram(t, "async fn f() {} [1]", "async-statement")
+	if len(program.Statements) != 2 || !program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.Function).Async {
+		t.Errorf("expected an async function statement, got=%q", program)
+	}
+	errors := map[string]string{
+		"fn f() { await g(); }":                 "await outside of an async function",
+		"async fn f() { fn() { await g(); }; }": "await outside of an async function",
+		"async fn f() { yield 1; }":             "yield in an async function",
+		"async 1":                               `want="FN"`,
+		"export async fn() { }":                 "export must be followed by a let, const, fn or struct declaration",
+	}
+	for input, want := range errors {
+		p := New(lexer.FromString(input), "async-error")
+		p.ParseProgram()
+		if !p.HasErrors() || !strings.Contains(p.Errors()[0].Msg, want) {
+			t.Errorf("expected error %q for %q, got=%v", want, input, p.Errors())
+		}
+	}
+}
+
+func TestFunctionStatementParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn f() {} [1]", []string{"fn f() {  }", "[1]"}},
+		{"fn (p P) f() {} [1]", []string{"fn (p P) f() {  }", "[1]"}},
+		{"fn() { return 1; }() + 1", []string{"(fn() { return 1; }() + 1)"}},
+		{"fn(x) { return x; }(1); [1]", []string{"fn(x) { return x; }(1)", "[1]"}},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("function-statement-%d", i))
+		var got []string
+		for _, stmt := range program.Statements {
+			got = append(got, stmt.String())
+		}
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("unexpected statements for %q\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestIfExpressionParsing(t *testing.T) {
+	input := "if x < y { x; } elif y { y; } elif z { z; } else { 0; } [1]"
+	program := newProgram(t, input, "if.expression")
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	ie, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	testInfixExpression(t, ie.If.Condition, "x", "<", "y")
+	if len(ie.Elifs) != 2 {
+		t.Fatalf("ie.Elifs does not contain 2 branches. got=%d", len(ie.Elifs))
+	}
+	testIdentifier(t, "z", ie.Elifs[1].Condition.String(), ie.Elifs[1].Condition.Literal())
+	if ie.Else == nil || len(ie.Else.Statements) != 1 {
+		t.Fatalf("ie.Else does not contain 1 statement. got=%v", ie.Else)
+	}
+	want := "if (x < y) { x }elif y { y }elif z { z }else { 0 }"
+	if ie.String() != want {
+		t.Errorf("unexpected if expression, want=%q, got=%q", want, ie.String())
+	}
+	program = newProgram(t, "let x = if a { 1; } else { 2; };", "if.assign")
+	if got := program.Statements[0].String(); got != "let x = if a { 1 }else { 2 };" {
+		t.Errorf("unexpected statement, got=%q", got)
+	}
+	for i, input := range []string{"if { }", "if x 1", "if x { } else 1", "if x { } elif { }"} {
+		p := New(lexer.FromString(input), fmt.Sprintf("if-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
+func TestForExpressionParsing(t *testing.T) {
+	input := "for const i = 0..=10 step 2 { f(i); } [i]"
+	program := newProgram(t, input, "for.expression")
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	loop, ok := stmt.Expression.(*ast.ForExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", stmt.Expression)
+	}
+	if loop.Assignment.Token.Type != token.CONST {
+		t.Errorf("loop.Assignment.Token is not CONST. got=%q", loop.Assignment.Token.Type)
+	}
+	testLiteralExpression(t, loop.Assignment.Left, "i")
+	r, ok := loop.Assignment.Right.(*ast.RangeExpression)
+	if !ok {
+		t.Fatalf("loop.Assignment.Right is not ast.RangeExpression. got=%T", loop.Assignment.Right)
+	}
+	if !r.Inclusive {
+		t.Errorf("range is not inclusive")
+	}
+	testLiteralExpression(t, r.Start, 0)
+	testLiteralExpression(t, r.End, 10)
+	testLiteralExpression(t, r.Step, 2)
+	want := "for const i = (0..=10 step 2);{ f(i) }[i]"
+	if program.String() != want {
+		t.Errorf("expected=%q, got=%q", want, program.String())
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 	program := newProgram(t, input, "identifier.expression")
@@ -340,6 +782,202 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"f(x)?",
+			"(f(x)?)",
+		},
+		{
+			"-f(x)? * 2",
+			"((-(f(x)?)) * 2)",
+		},
+		{
+			"a + b?",
+			"(a + (b?))",
+		},
+		{
+			"f()?(1)?",
+			"((f()?)(1)?)",
+		},
+		{
+			"xs[0]?",
+			"((xs[0])?)",
+		},
+		{
+			"a ? b : null",
+			"(a ? b : null)",
+		},
+		{
+			"a == 1 ? b + 1 : c * 2",
+			"((a == 1) ? (b + 1) : (c * 2))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"a ?? b ?? c",
+			"((a ?? b) ?? c)",
+		},
+		{
+			"a ?? b == c",
+			"(a ?? (b == c))",
+		},
+		{
+			"a ?? b ? c : d",
+			"((a ?? b) ? c : d)",
+		},
+		{
+			"a?.b?.c",
+			"((a?.b)?.c)",
+		},
+		{
+			"a?[1 + 1]?[0]",
+			"((a?[(1 + 1)])?[0])",
+		},
+		{
+			"a?.b ?? f(x ? 1 : 2)?",
+			"((a?.b) ?? (f((x ? 1 : 2))?))",
+		},
+		{
+			"c? a : b",
+			"(c ? a : b)",
+		},
+		{
+			"c ?a:b",
+			"(c ? a : b)",
+		},
+		{
+			"c?-1:f()?",
+			"(c ? (-1) : (f()?))",
+		},
+		{
+			"x ? - 1",
+			"((x?) - 1)",
+		},
+		{
+			"a ?[0]",
+			"(a?[0])",
+		},
+		{
+			"c ?[1] : [2]",
+			"(c ? [1] : [2])",
+		},
+		{
+			"c?[1]:[2]",
+			"(c ? [1] : [2])",
+		},
+		{
+			"c ? f(a?[0]) : b ?[1]",
+			"(c ? f((a?[0])) : (b?[1]))",
+		},
+		{
+			"a?[0] ? [1] : [a?[2]]",
+			"((a?[0]) ? [1] : [(a?[2])])",
+		},
+		{
+			"a ? b",
+			"(a?)b",
+		},
+		{
+			"-a?.b * 2",
+			"((-(a?.b)) * 2)",
+		},
+		{
+			"xs |> map(f) |> filter(g)",
+			"filter(map(xs, f), g)",
+		},
+		{
+			"xs |> len",
+			"len(xs)",
+		},
+		{
+			"a + b |> f(c * d)",
+			"f((a + b), (c * d))",
+		},
+		{
+			"a < b |> f()",
+			"f((a < b))",
+		},
+		{
+			"xs |> f(...ys, n: 1)",
+			"f(xs, ...ys, n: 1)",
+		},
+		{
+			"a ?? b |> f()",
+			"f((a ?? b))",
+		},
+		{
+			"c ? x : y |> f()",
+			"(c ? x : f(y))",
+		},
+		{
+			"xs |> make()()",
+			"make()(xs)",
+		},
+		{
+			"0..10",
+			"(0..10)",
+		},
+		{
+			"a + 1..=b * 2 step n - 1",
+			"((a + 1)..=(b * 2) step (n - 1))",
+		},
+		{
+			"1.5..2.5",
+			"(1.50..2.50)",
+		},
+		{
+			"arr[1..3]",
+			"(arr[(1..3)])",
+		},
+		{
+			"str[..5]",
+			"(str[(..5)])",
+		},
+		{
+			"str[2..]",
+			"(str[(2..)])",
+		},
+		{
+			"a[1:n - 1]",
+			"(a[1:(n - 1)])",
+		},
+		{
+			"a[:]",
+			"(a[:])",
+		},
+		{
+			"a[::-1]",
+			"(a[::(-1)])",
+		},
+		{
+			"a[i:][0]",
+			"((a[i:])[0])",
+		},
+		{
+			"a?[:2] ?? b",
+			"((a?[:2]) ?? b)",
+		},
+		{
+			"a[c ? 1 : 2:]",
+			"(a[(c ? 1 : 2):])",
+		},
+		{
+			"0.. step 2",
+			"(0.. step 2)",
+		},
+		{
+			"0..n == 1",
+			"(0..(n == 1))",
+		},
+		{
+			"0..3 |> f()",
+			"f((0..3))",
+		},
 	}
 	for i, tt := range tests {
 		program := newProgram(t, tt.input, fmt.Sprintf("precedence-test-%d", i))
@@ -385,6 +1023,25 @@ func TestParsingArrayLiterals(t *testing.T) {
 	testInfixExpression(t, array.Elements[2], 3, "+", 3)
 }
 
+func TestParsingDictLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"({})", "||"},
+		{`({"a": 1, b: 2 * 2})`, `|"a":1, b:(2 * 2)|`},
+		{`f({"a": {"b": [1]}})`, `f(|"a":|"b":[1]||)`},
+		// a '{' after an open range starts the body of the loop
+		{"for const i = 0.. { }", "for const i = (0..);{  }"},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("dict-%d", i))
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestParsingCommentLiteral(t *testing.T) {
 	input := "// whateverworks hello there"
 	program := newProgram(t, input, "comment.literal")
@@ -420,8 +1077,8 @@ func TestFunctionLiteralParsing(t *testing.T) {
 			len(function.Parameters))
 	}
 
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
+	testLiteralExpression(t, function.Parameters[0].Name, "x")
+	testLiteralExpression(t, function.Parameters[1].Name, "y")
 
 	if len(function.Body.Statements) != 1 {
 		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
@@ -435,6 +1092,235 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestSpreadParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"add(...xs)", "add(...xs)"},
+		{"add(a, ...xs, ...[1, 2])", "add(a, ...xs, ...[1, 2])"},
+		{"add(...f(x)[0])", "add(...(f(x)[0]))"},
+		{"[...a, ...b]", "[...a, ...b]"},
+		{"[1, ...a, 2 * 3]", "[1, ...a, (2 * 3)]"},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("spread-%d", i))
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestRestParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expectedRest   string
+	}{
+		{"fn(...args) {}", []string{}, "args"},
+		{"fn(a, b, ...rest) {}", []string{"a", "b"}, "rest"},
+		{"fn(a, b) {}", []string{"a", "b"}, ""},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("rest-parameter-%d", i))
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.Function)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.Function. got=%T", stmt.Expression)
+		}
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+		for j, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[j].Name, ident)
+		}
+		if tt.expectedRest == "" {
+			if function.Rest != nil {
+				t.Fatalf("function.Rest is not nil. got=%q", function.Rest.Value)
+			}
+			continue
+		}
+		if function.Rest == nil {
+			t.Fatalf("function.Rest is nil, want=%q", tt.expectedRest)
+		}
+		testLiteralExpression(t, function.Rest, tt.expectedRest)
+	}
+}
+
+func TestRestParameterErrors(t *testing.T) {
+	tests := []string{
+		"fn(...args, b) {}",
+		"fn(...a, ...b) {}",
+		"fn(a, ...) {}",
+		"fn(a, ...1) {}",
+	}
+	for i, input := range tests {
+		p := New(lexer.FromString(input), fmt.Sprintf("rest-parameter-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
+func TestDefaultParameterParsing(t *testing.T) {
+	input := `fn connect(host, port = 5432, opts = [1 + 2]) { host; }`
+	program := newProgram(t, input, "default.parameter")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.Function)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.Function. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, "connect", function.Name.Value, function.Name.Literal()) {
+		return
+	}
+	if len(function.Parameters) != 3 {
+		t.Fatalf("function parameters wrong. want 3, got=%d", len(function.Parameters))
+	}
+	testLiteralExpression(t, function.Parameters[0].Name, "host")
+	if function.Parameters[0].Default != nil {
+		t.Fatalf("host.Default is not nil. got=%q", function.Parameters[0].Default)
+	}
+	testLiteralExpression(t, function.Parameters[1].Name, "port")
+	testLiteralExpression(t, function.Parameters[1].Default, 5432)
+	want := "fn connect(host, port = 5432, opts = [(1 + 2)]) { host }"
+	if function.String() != want {
+		t.Errorf("function.String() wrong. want=%q, got=%q", want, function.String())
+	}
+}
+
+func TestFunctionDeclarationParsing(t *testing.T) {
+	input := "fn f() { 1; } [1, 2]; fn g() {}; (g)"
+	program := newProgram(t, input, "function.declaration")
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d",
+			len(program.Statements))
+	}
+	want := "fn f() { 1 }[1, 2]fn g() {  }g"
+	if program.String() != want {
+		t.Errorf("expected=%q, got=%q", want, program.String())
+	}
+}
+
+func TestTailCallParsing(t *testing.T) {
+	input := `fn f(x) {
+		n1();
+		if x { return t1(); } elif x { return n2() + 1; } else { { return t2(n3()); } }
+		for const i = x { return n4(); }
+		try { return n5(); } catch { return n6(); }
+		let y = fn() { return t3(); };
+		return t4();
+	}
+	return n7();`
+	calls := make(map[string]bool)
+	var walk func(node ast.Node)
+	walk = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.ExpressionStatement:
+			walk(node.Expression)
+		case *ast.AssignStatement:
+			walk(node.Right)
+		case *ast.ReturnStatement:
+			walk(node.ReturnValue)
+		case *ast.BlockStatement:
+			for _, stmt := range node.Statements {
+				walk(stmt)
+			}
+		case *ast.TryStatement:
+			walk(node.Body)
+			walk(node.Catch.Body)
+		case *ast.InfixExpression:
+			walk(node.Left)
+			walk(node.Right)
+		case *ast.IfExpression:
+			walk(node.If.Body)
+			for _, elif := range node.Elifs {
+				walk(elif.Body)
+			}
+			walk(node.Else)
+		case *ast.ForExpression:
+			walk(node.Body)
+		case *ast.Function:
+			walk(node.Body)
+		case *ast.CallExpression:
+			calls[node.Function.String()] = node.Tail
+			for _, arg := range node.Arguments {
+				walk(arg)
+			}
+		}
+	}
+	for _, stmt := range newProgram(t, input, "tail-call").Statements {
+		walk(stmt)
+	}
+	if len(calls) != 11 {
+		t.Fatalf("wrong number of calls, want=11, got=%d", len(calls))
+	}
+	for name, tail := range calls {
+		if want := name[0] == 't'; tail != want {
+			t.Errorf("wrong tail flag of %s, want=%t, got=%t", name, want, tail)
+		}
+	}
+}
+
+func TestNamedArgumentParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`connect(host: "db", port: 1)`, `connect(host: "db", port: 1)`},
+		{`connect("db", port: 1 + 2)`, `connect("db", port: (1 + 2))`},
+		{`connect(...args, port: f(x: 1))`, `connect(...args, port: f(x: 1))`},
+	}
+	for i, tt := range tests {
+		program := newProgram(t, tt.input, fmt.Sprintf("named-argument-%d", i))
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+	program := newProgram(t, `connect("db", port: 1)`, "named-argument")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call := stmt.Expression.(*ast.CallExpression)
+	arg, ok := call.Arguments[1].(*ast.NamedArgument)
+	if !ok {
+		t.Fatalf("call.Arguments[1] is not ast.NamedArgument. got=%T", call.Arguments[1])
+	}
+	testLiteralExpression(t, arg.Name, "port")
+	testLiteralExpression(t, arg.Value, 1)
+}
+
+func TestParameterAndArgumentOrderErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) {}", `required parameter "b" follows parameter with default value "a"`},
+		{"f(a: 1, 2)", `positional argument "2" follows named argument`},
+		{"f(a: 1, ...xs)", `positional argument "..." follows named argument`},
+		{"f(a: 1, a: 2)", `named argument "a" given more than once`},
+		{"[a: 1]", `unexpected token, got=":", want="]"`},
+		{"a ? b :", `no "prefix" function found for token "EOF"`},
+		{"(a ? b)", `unexpected token, got="IDENTIFIER", want=")"`},
+		{"a?.1", `unexpected token, got="INT", want="IDENTIFIER"`},
+		{"xs[1..=]", `inclusive range "..=" requires an end`},
+		{"for i = xs {}", `unexpected token, got="IDENTIFIER", want="LET"`},
+		{"for let i = xs; i", `unexpected token, got="IDENTIFIER", want="{"`},
+	}
+	for i, tt := range tests {
+		p := New(lexer.FromString(tt.input), fmt.Sprintf("order-error-%d", i))
+		p.ParseProgram()
+		if !p.HasErrors() {
+			t.Fatalf("expected parse errors for %q", tt.input)
+		}
+		if !strings.Contains(p.Errors()[0].Msg, tt.expected) {
+			t.Errorf("unexpected error for %q\nwant=%q\ngot=%q",
+				tt.input, tt.expected, p.Errors()[0].Msg)
+		}
+	}
+}
+
 //func TestFunctionParameterParsing(t *testing.T) {
 //	tests := []struct {
 //		input          string
@@ -8,11 +8,16 @@ type pred int
 const (
 	_ pred = iota
 	LOWEST
+	CONDITIONAL // x ? a : b
+	PIPELINE    // x |> f()
+	RANGE       // 0..10
+	COALESCE    // x ?? y
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POSTFIX     // X?
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 )
@@ -26,6 +31,11 @@ func (p pred) lt(t token.T) bool {
 type PredMap map[token.Type]pred
 
 var predMap = PredMap{
+	token.TERNARY:  CONDITIONAL,
+	token.NULLISH:  COALESCE,
+	token.PIPE:     PIPELINE,
+	token.DOTDOT:   RANGE,
+	token.DOTDOTEQ: RANGE,
 	token.EQ:       EQUALS,
 	token.NEQ:      EQUALS,
 	token.LT:       LESSGREATER,
@@ -36,8 +46,12 @@ var predMap = PredMap{
 	token.MINUS:    SUM,
 	token.FSLASH:   PRODUCT,
 	token.STAR:     PRODUCT,
+	token.QUESTION: POSTFIX,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.QBRACKET: INDEX,
+	token.QDOT:     INDEX,
+	token.DOT:      INDEX,
 }
 
 // find searches PredMap for precedence of token t
@@ -20,13 +20,19 @@ func makePrefixMap(p *P) prefixMap {
 		token.FLOAT:      p.parseNumberLiteral,
 		token.TRUE:       p.parseBooleanLiteral,
 		token.FALSE:      p.parseBooleanLiteral,
+		token.NULL:       p.parseNullLiteral,
 
 		token.LPAREN:   p.parseGroupedExpression,
 		token.LBRACKET: p.parseArrayLiteral,
 		token.FN:       p.parseFunctionLiteral,
-		//		token.LBRACE:   p.parseHashLiteral,
-		//		token.IF:       p.parseIfExpression,
-		//		token.FOR:      p.parseForExpression,
+		token.DOTDOT:   p.parseOpenRangeExpression,
+		token.DOTDOTEQ: p.parseOpenRangeExpression,
+		token.FOR:      p.parseForExpression,
+		token.SPAWN:    p.parseSpawnExpression,
+		token.ASYNC:    p.parseAsyncFunction,
+		token.AWAIT:    p.parseAwaitExpression,
+		token.IF:       p.parseIfExpression,
+		token.LBRACE:   p.parseDictLiteral,
 	}
 
 }
@@ -52,6 +58,10 @@ func (p *P) parseBooleanLiteral() ast.Expression {
 	return b
 }
 
+func (p *P) parseNullLiteral() ast.Expression {
+	return &ast.Null{Token: p.cur}
+}
+
 func (p *P) parseStringLiteral() ast.Expression {
 	return &ast.String{Token: p.cur, Value: p.cur.Literal}
 }
@@ -63,6 +73,96 @@ func (p *P) parsePrefixExpression() ast.Expression {
 	return expr
 }
 
+// parseOpenRangeExpression parses a range without a start i.e ..5
+func (p *P) parseOpenRangeExpression() ast.Expression {
+	return p.parseRangeExpression(nil)
+}
+
+// parseForExpression parses for let x = iterable { ... }
+func (p *P) parseForExpression() ast.Expression {
+	expression := &ast.ForExpression{Token: p.cur}
+	if p.next.Type != token.LET && p.next.Type != token.CONST {
+		expectErr(p, p.next, token.LET)
+		return nil
+	}
+	p.advance() // consume 'for'
+	expression.Assignment = p.parseAssignment(&ast.AssignStatement{Token: p.cur}, false)
+	if expression.Assignment == nil || !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	p.advance() // consume iterable
+	expression.Body = p.parseBlockStatement()
+	return expression
+}
+
+// parseIfExpression parses if a { } elif b { } else { }
+func (p *P) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.cur}
+	p.advance() // consume 'if'
+	if !p.parseConditional(&expression.If) {
+		return nil
+	}
+	for p.next.Type == token.ELIF {
+		p.advance() // consume '}'
+		p.advance() // consume 'elif'
+		var elif ast.Conditional
+		if !p.parseConditional(&elif) {
+			return nil
+		}
+		expression.Elifs = append(expression.Elifs, elif)
+	}
+	if p.next.Type == token.ELSE {
+		p.advance() // consume '}'
+		if !p.expectNext(token.LBRACE) {
+			return nil
+		}
+		p.advance() // consume 'else'
+		expression.Else = p.parseBlockStatement()
+	}
+	return expression
+}
+
+// parseConditional parses a condition followed by a block into c
+func (p *P) parseConditional(c *ast.Conditional) bool {
+	if c.Condition = p.parseExpression(LOWEST); c.Condition == nil {
+		return false
+	}
+	if !p.expectNext(token.LBRACE) {
+		return false
+	}
+	p.advance() // consume condition
+	c.Body = p.parseBlockStatement()
+	return true
+}
+
+// parseAwaitExpression parses await f(x), which is allowed
+// at the top level and in the body of an async function
+func (p *P) parseAwaitExpression() ast.Expression {
+	expression := &ast.AwaitExpression{Token: p.cur}
+	if n := len(p.functions); n > 0 && !p.functions[n-1].Async {
+		perr(p, p.cur, "await outside of an async function")
+		return nil
+	}
+	p.advance() // consume 'await'
+	if expression.Value = p.parseExpression(PREFIX); expression.Value == nil {
+		return nil
+	}
+	return expression
+}
+
+// parseSpawnExpression parses spawn f(x)
+func (p *P) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.cur}
+	p.advance() // consume 'spawn'
+	call, ok := p.parseExpression(PREFIX).(*ast.CallExpression)
+	if !ok {
+		perr(p, expression.Token, "spawn requires a function call")
+		return nil
+	}
+	expression.Call = call
+	return expression
+}
+
 func (p *P) parseGroupedExpression() ast.Expression {
 	p.advance() // consume '('
 	expr := p.parseExpression(LOWEST)
@@ -75,22 +175,52 @@ func (p *P) parseGroupedExpression() ast.Expression {
 
 func (p *P) parseArrayLiteral() ast.Expression {
 	array := &ast.Array{Token: p.cur}
-	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Elements = p.parseExpressionList(token.RBRACKET, p.parseListElement)
 	return array
 }
 
-func (p *P) parseExpressionList(end token.Type) []ast.Expression {
+// parseDictLiteral parses {key: value, ...}
+func (p *P) parseDictLiteral() ast.Expression {
+	dict := &ast.Dict{Token: p.cur}
+	if p.next.Type == token.RBRACE {
+		p.advance() // consume '{'
+		return dict
+	}
+	p.advance() // consume '{'
+	for {
+		key := p.parseExpression(LOWEST)
+		if !p.expectNext(token.COLON) {
+			return nil
+		}
+		p.advance() // consume ':'
+		p.advance() // consume value
+		dict.Pairs = append(dict.Pairs, ast.Pair{Key: key, Value: p.parseExpression(LOWEST)})
+		if p.next.Type != token.COMMA {
+			break
+		}
+		p.advance() // consume ','
+		p.advance() // consume next key
+	}
+	if !p.expectNext(token.RBRACE) {
+		return nil
+	}
+	p.advance() // consume '}'
+	return dict
+}
+
+// parseExpressionList parses elements with parseElement until end is seen
+func (p *P) parseExpressionList(end token.Type, parseElement prefixFn) []ast.Expression {
 	var list []ast.Expression
 	if p.next.Type == end {
 		p.advance() // consume ']'
 		return list
 	}
 	p.advance() // consume '['
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, parseElement())
 	for p.next.Type == token.COMMA {
 		p.advance() // consume ','
 		p.advance() // consume next element
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, parseElement())
 	}
 	if !p.expectNext(end) {
 		return nil
@@ -99,39 +229,164 @@ func (p *P) parseExpressionList(end token.Type) []ast.Expression {
 	return list
 }
 
+// parseListElement parses an element in a call or array literal,
+// allowing it to be spread i.e ...xs
+func (p *P) parseListElement() ast.Expression {
+	if p.cur.Type != token.ELLIPSIS {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.Spread{Token: p.cur}
+	p.advance() // consume '...'
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 func (p *P) parseFunctionLiteral() ast.Expression {
-	fn := &ast.Function{Token: p.cur}
+	return p.parseFunction(&ast.Function{Token: p.cur})
+}
+
+// parseAsyncFunction parses async fn f() { ... }
+func (p *P) parseAsyncFunction() ast.Expression {
+	if !p.expectNext(token.FN) {
+		return nil
+	}
+	p.advance() // consume 'async'
+	return p.parseFunction(&ast.Function{Token: p.cur, Async: true})
+}
+
+// parseFunction parses the function starting at 'fn' into fn
+func (p *P) parseFunction(fn *ast.Function) ast.Expression {
+	if p.next.Type == token.IDENTIFIER {
+		p.advance() // consume 'fn'
+		fn.Name = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+	}
 	p.advance() // consume 'identifier'
 	if !p.expectCur(token.LPAREN) {
 		return nil
 	}
-	fn.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(fn) {
+		return nil
+	}
+	if fn.Receiver != nil {
+		// fn (p Point) name(...), the receiver has been parsed
+		if !p.expectNext(token.IDENTIFIER) {
+			return nil
+		}
+		p.advance() // consume ')'
+		fn.Name = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+		if !p.expectNext(token.LPAREN) {
+			return nil
+		}
+		p.advance() // consume 'identifier'
+		if !p.parseFunctionParameters(fn) {
+			return nil
+		}
+	}
 	if !p.expectNext(token.LBRACE) {
 		return nil
 	}
 	p.advance() // consume '{'
+	p.functions = append(p.functions, fn)
 	fn.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
+	markTailCalls(fn.Body)
 	return fn
 }
 
-func (p *P) parseFunctionParameters() []*ast.Identifier {
-	var params []*ast.Identifier
+// markTailCalls marks the calls returned by the statements of block,
+// following blocks and the arms of if expressions. A return within a
+// for loop or a try statement is not a tail call, as the iterator or
+// the finally block must be released after the call.
+func markTailCalls(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			if call, ok := stmt.ReturnValue.(*ast.CallExpression); ok {
+				call.Tail = true
+			}
+		case *ast.BlockStatement:
+			markTailCalls(stmt)
+		case *ast.ExpressionStatement:
+			if ie, ok := stmt.Expression.(*ast.IfExpression); ok {
+				markTailCalls(ie.If.Body)
+				for _, elif := range ie.Elifs {
+					markTailCalls(elif.Body)
+				}
+				markTailCalls(ie.Else)
+			}
+		}
+	}
+}
+
+// parseFunctionParameters sets the parameters of fn and
+// returns false if they could not be parsed
+func (p *P) parseFunctionParameters(fn *ast.Function) bool {
 	if p.next.Type == token.RPAREN {
 		p.advance() // consume ')'
-		return params
+		return true
 	}
 	p.advance() // consume '('
-	params = append(params, &ast.Identifier{Token: p.cur, Value: p.cur.Literal})
+	if !p.parseFunctionParameter(fn) {
+		return false
+	}
 	for p.next.Type == token.COMMA {
 		p.advance() // consume ','
 		p.advance() // consume next parameter
-		params = append(params, &ast.Identifier{Token: p.cur, Value: p.cur.Literal})
+		if !p.parseFunctionParameter(fn) {
+			return false
+		}
 	}
 	if !p.expectNext(token.RPAREN) {
-		return nil
+		return false
 	}
 	p.advance() // consume ')'
-	return params
+	return true
+}
+
+// parseFunctionParameter parses a single parameter, a parameter
+// with a default value i.e port = 5432 or a rest parameter i.e ...args into fn
+func (p *P) parseFunctionParameter(fn *ast.Function) bool {
+	if fn.Rest != nil {
+		perr(p, p.cur, "rest parameter %q must be the last parameter", fn.Rest.Value)
+		return false
+	}
+	if p.cur.Type == token.ELLIPSIS {
+		if !p.expectNext(token.IDENTIFIER) {
+			return false
+		}
+		p.advance() // consume '...'
+		fn.Rest = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+		return true
+	}
+	if !p.expectCur(token.IDENTIFIER) {
+		return false
+	}
+	if p.next.Type == token.IDENTIFIER && fn.Name == nil && fn.Receiver == nil && len(fn.Parameters) == 0 {
+		return p.parseReceiver(fn)
+	}
+	param := &ast.Parameter{Name: &ast.Identifier{Token: p.cur, Value: p.cur.Literal}}
+	if p.next.Type == token.ASSIGN {
+		p.advance() // consume 'identifier'
+		p.advance() // consume '='
+		param.Default = p.parseExpression(LOWEST)
+	} else if n := len(fn.Parameters); n > 0 && fn.Parameters[n-1].Default != nil {
+		perr(p, p.cur, "required parameter %q follows parameter with default value %q",
+			param.Name.Value, fn.Parameters[n-1].Name.Value)
+	}
+	fn.Parameters = append(fn.Parameters, param)
+	return true
+}
+
+// parseReceiver parses the receiver of a method i.e (p Point)
+// into fn, the receiver must be alone in its parentheses
+func (p *P) parseReceiver(fn *ast.Function) bool {
+	fn.Receiver = &ast.Receiver{Name: &ast.Identifier{Token: p.cur, Value: p.cur.Literal}}
+	p.advance() // consume 'identifier'
+	fn.Receiver.Type = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+	return p.expectNext(token.RPAREN)
 }
 
 func (p *P) parseBlockStatement() *ast.BlockStatement {
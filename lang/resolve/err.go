@@ -0,0 +1,27 @@
+package resolve
+
+import (
+	"fmt"
+
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// ResolveErr describes an error encountered during resolving
+type ResolveErr struct {
+	token.T
+	Msg  string
+	Line string
+}
+
+// newResolveErr formats an error with sourceName, line, col and message.
+func newResolveErr(r *R, t token.T, msg string, args ...any) ResolveErr {
+	l := t.HighlightErr(r.l.Line(t.Line))
+	m := fmt.Sprintf(msg, args...)
+	m = fmt.Sprintf("ResolveError: %s at\n\t%s:L%d:C%d ------> %s",
+		m, r.sourceName, t.Line, t.Col, l)
+	return ResolveErr{T: t, Msg: m, Line: l}
+}
+
+func rerr(r *R, t token.T, msg string, args ...any) {
+	r.errs = append(r.errs, newResolveErr(r, t, msg, args...))
+}
@@ -0,0 +1,328 @@
+package resolve
+
+import (
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+// R walks a program before it is executed and links every
+// identifier to its declaration in a Table. It reports
+// undeclared identifiers, reassignment of constants and
+// redeclaration of names in the same scope.
+//
+// Function bodies are resolved when their enclosing scope
+// closes, as a closure may refer to names declared after it.
+type R struct {
+	l *lexer.L
+
+	sourceName string
+
+	scope *scope
+	table *Table
+	// builtin symbols created on first use
+	builtins map[string]*Symbol
+
+	errs []ResolveErr
+}
+
+// New creates a new resolver, l is used
+// to highlight the offending source lines
+func New(l *lexer.L, sourceName string) *R {
+	return &R{
+		l:          l,
+		sourceName: sourceName,
+		errs:       make([]ResolveErr, 0),
+	}
+}
+
+// Errors returns the errors that occured during resolving
+func (r *R) Errors() []ResolveErr {
+	return r.errs
+}
+
+// HasErrors returns true if there are any errors
+func (r *R) HasErrors() bool {
+	return len(r.errs) > 0
+}
+
+// Resolve walks program in a new global scope
+// and returns the resulting symbol table
+func (r *R) Resolve(program *ast.Program) *Table {
+	r.table = newTable()
+	r.builtins = make(map[string]*Symbol)
+	r.scope = newScope(nil)
+	for _, stmt := range program.Statements {
+		r.resolve(stmt)
+	}
+	r.closeScope()
+	return r.table
+}
+
+// resolve walks node and all of its children
+func (r *R) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+	case *ast.AssignStatement:
+		r.resolveAssignStatement(node)
+	case *ast.BlockStatement:
+		r.openScope()
+		r.resolveStatements(node)
+		r.closeScope()
+	case *ast.ReturnStatement:
+		r.resolve(node.ReturnValue)
+	case *ast.ThrowStatement:
+		r.resolve(node.Value)
+	case *ast.YieldStatement:
+		r.resolve(node.Value)
+	case *ast.TryStatement:
+		r.resolveTryStatement(node)
+	case *ast.StructStatement:
+		r.declare(node.Name, r.kind(), true)
+	case *ast.ImportStatement:
+		r.declare(node.Alias, r.kind(), true)
+	case *ast.ExportStatement:
+		r.resolve(node.Statement)
+	case *ast.SelectStatement:
+		r.resolveSelectStatement(node)
+	case *ast.Identifier:
+		r.resolveIdentifier(node)
+	case *ast.Array:
+		r.resolveList(node.Elements)
+	case *ast.Dict:
+		for _, pair := range node.Pairs {
+			r.resolve(pair.Key)
+			r.resolve(pair.Value)
+		}
+	case *ast.Spread:
+		r.resolve(node.Value)
+	case *ast.NamedArgument:
+		r.resolve(node.Value)
+	case *ast.PropagateExpression:
+		r.resolve(node.Value)
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+	case *ast.SliceExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Start)
+		r.resolve(node.End)
+		r.resolve(node.Step)
+	case *ast.MemberExpression:
+		r.resolve(node.Left)
+	case *ast.TernaryExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		r.resolve(node.Alternative)
+	case *ast.CallExpression:
+		r.resolve(node.Function)
+		r.resolveList(node.Arguments)
+	case *ast.SpawnExpression:
+		r.resolve(node.Call)
+	case *ast.AwaitExpression:
+		r.resolve(node.Value)
+	case *ast.IfExpression:
+		r.resolve(node.If.Condition)
+		r.resolve(node.If.Body)
+		for _, elif := range node.Elifs {
+			r.resolve(elif.Condition)
+			r.resolve(elif.Body)
+		}
+		if node.Else != nil {
+			r.resolve(node.Else)
+		}
+	case *ast.ForExpression:
+		// the iterable is evaluated before the frame of the loop variable
+		r.resolve(node.Assignment.Right)
+		r.openScope()
+		r.declare(node.Assignment.Left, LOCAL, node.Assignment.Token.Type == token.CONST)
+		r.resolve(node.Body)
+		r.closeScope()
+	case *ast.RangeExpression:
+		r.resolve(node.Start)
+		r.resolve(node.End)
+		r.resolve(node.Step)
+	case *ast.Function:
+		r.resolveFunction(node)
+	}
+}
+
+func (r *R) resolveList(expressions []ast.Expression) {
+	for _, e := range expressions {
+		r.resolve(e)
+	}
+}
+
+// resolveStatements walks the statements of block in the current scope
+func (r *R) resolveStatements(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		r.resolve(stmt)
+	}
+}
+
+func (r *R) resolveIdentifier(ident *ast.Identifier) {
+	sym, distance, ok := r.scope.lookup(ident.Value)
+	if !ok {
+		if sym, ok = r.builtin(ident.Value); !ok {
+			rerr(r, ident.Token, "undeclared identifier %q", ident.Value)
+			return
+		}
+		distance = r.scope.depth
+	}
+	sym.Reads++
+	r.table.link(ident, sym, distance)
+}
+
+func (r *R) resolveAssignStatement(node *ast.AssignStatement) {
+	r.resolve(node.Right)
+	switch node.Token.Type {
+	case token.LET, token.CONST:
+		r.declare(node.Left, r.kind(), node.Token.Type == token.CONST)
+	default:
+		sym, distance, ok := r.scope.lookup(node.Left.Value)
+		if !ok {
+			rerr(r, node.Left.Token, "assignment to undeclared identifier %q", node.Left.Value)
+			return
+		}
+		if sym.Const {
+			rerr(r, node.Left.Token, "assignment to constant %q declared at L%d:C%d",
+				node.Left.Value, sym.Decl.Token.Line, sym.Decl.Token.Col)
+		}
+		r.table.link(node.Left, sym, distance)
+	}
+}
+
+// resolveTryStatement walks the catch parameter and
+// catch body in the same scope, like the runtime frame
+func (r *R) resolveTryStatement(node *ast.TryStatement) {
+	r.resolve(node.Body)
+	if node.Catch != nil {
+		r.openScope()
+		if node.Catch.Param != nil {
+			r.declare(node.Catch.Param, LOCAL, false)
+		}
+		r.resolveStatements(node.Catch.Body)
+		r.closeScope()
+	}
+	if node.Finally != nil {
+		r.resolve(node.Finally)
+	}
+}
+
+// resolveSelectStatement walks the binding and body
+// of every case in the same scope, like the runtime frame
+func (r *R) resolveSelectStatement(node *ast.SelectStatement) {
+	for _, c := range node.Cases {
+		r.resolve(c.Call)
+	}
+	for _, c := range node.Cases {
+		r.openScope()
+		if c.Binding != nil {
+			r.declare(c.Binding, LOCAL, c.Token.Type == token.CONST)
+		}
+		r.resolveStatements(c.Body)
+		r.closeScope()
+	}
+	if node.Default != nil {
+		r.resolve(node.Default)
+	}
+}
+
+// resolveFunction declares the name of fn in the current scope and
+// defers its parameters and body until the current scope closes.
+// A method is not declared, it belongs to the struct of its receiver.
+func (r *R) resolveFunction(fn *ast.Function) {
+	if fn.Receiver != nil {
+		r.resolveIdentifier(fn.Receiver.Type)
+	} else if fn.Name != nil {
+		r.declare(fn.Name, r.kind(), false)
+	}
+	sc := r.scope
+	sc.deferred = append(sc.deferred, func() {
+		outer := r.scope
+		r.scope = sc
+		r.resolveFunctionBody(fn)
+		r.scope = outer
+	})
+}
+
+// resolveFunctionBody walks parameters and body of fn in a
+// new scope, like the frame created when fn is called
+func (r *R) resolveFunctionBody(fn *ast.Function) {
+	r.openScope()
+	if fn.Receiver != nil {
+		r.declare(fn.Receiver.Name, PARAMETER, false)
+	}
+	for _, param := range fn.Parameters {
+		r.resolve(param.Default)
+		r.declare(param.Name, PARAMETER, false)
+	}
+	if fn.Rest != nil {
+		r.declare(fn.Rest, PARAMETER, false)
+	}
+	r.resolveStatements(fn.Body)
+	r.closeScope()
+}
+
+// declare adds ident to the current scope
+func (r *R) declare(ident *ast.Identifier, kind Kind, isConst bool) {
+	if sym, ok := r.scope.names[ident.Value]; ok {
+		rerr(r, ident.Token, "%q is already declared in this scope at L%d:C%d",
+			ident.Value, sym.Decl.Token.Line, sym.Decl.Token.Col)
+		return
+	}
+	sym := &Symbol{
+		Name:  ident.Value,
+		Kind:  kind,
+		Depth: r.scope.depth,
+		Decl:  ident,
+		Const: isConst,
+	}
+	r.scope.names[ident.Value] = sym
+	r.table.symbols = append(r.table.symbols, sym)
+	r.table.link(ident, sym, 0)
+}
+
+// builtin returns the symbol of the builtin name
+func (r *R) builtin(name string) (*Symbol, bool) {
+	if sym, ok := r.builtins[name]; ok {
+		return sym, true
+	}
+	if _, ok := object.Builtins[name]; !ok {
+		return nil, false
+	}
+	sym := &Symbol{Name: name, Kind: BUILTIN}
+	r.builtins[name] = sym
+	return sym, true
+}
+
+// kind returns the Kind of a declaration in the current scope
+func (r *R) kind() Kind {
+	if r.scope.depth == 0 {
+		return GLOBAL
+	}
+	return LOCAL
+}
+
+func (r *R) openScope() {
+	r.scope = newScope(r.scope)
+}
+
+// closeScope resolves deferred function bodies
+// and returns to the enclosing scope
+func (r *R) closeScope() {
+	for _, fn := range r.scope.deferred {
+		fn()
+	}
+	r.scope = r.scope.outer
+}
@@ -0,0 +1,290 @@
+package resolve
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/parser"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"const x = 1; x = 2;", []string{`assignment to constant "x" declared at L1:C7`}},
+		{"x = 2;", []string{`assignment to undeclared identifier "x"`}},
+		{"let x = 1; let x = 2;", []string{`"x" is already declared in this scope at L1:C5`}},
+		{"let x = 1; const x = 2;", []string{`"x" is already declared in this scope at L1:C5`}},
+		{"fn f() {} let f = 1;", []string{`"f" is already declared in this scope at L1:C4`}},
+		{"fn(a, a) {}", []string{`"a" is already declared in this scope at L1:C4`}},
+		{"fn(a, ...a) {}", []string{`"a" is already declared in this scope at L1:C4`}},
+		{"fn(a) { let a = 1; }", []string{`"a" is already declared in this scope at L1:C4`}},
+		{"const x = 1; fn() { x = 2; }", []string{`assignment to constant "x"`}},
+		{"const x = 1; { { x = 2; } }", []string{`assignment to constant "x"`}},
+		{"{ let y = 1; } y = 2;", []string{`assignment to undeclared identifier "y"`}},
+		{"try { throw 1; } catch e { let e = 2; }", []string{`"e" is already declared in this scope`}},
+		{"try { throw 1; } catch e { } e = 2;", []string{`assignment to undeclared identifier "e"`}},
+		{"for const i = 0..3 { i = 1; }", []string{`assignment to constant "i"`}},
+		{"for let i = 0..i { }", []string{`undeclared identifier "i"`}},
+		{"struct P { x } P = 1;", []string{`assignment to constant "P" declared at L1:C8`}},
+		{"struct P { x } let P = 1;", []string{`"P" is already declared in this scope`}},
+		{"fn (p Q) f() {}", []string{`undeclared identifier "Q"`}},
+		{`import "m" as m; m = 1;`, []string{`assignment to constant "m" declared at L1:C15`}},
+		{`import "m" as m; export let m = 1;`, []string{`"m" is already declared in this scope`}},
+		{"export fn f() { return g; }", []string{`undeclared identifier "g"`}},
+		{"fn gen() { yield x; }", []string{`undeclared identifier "x"`}},
+		{"spawn f(1);", []string{`undeclared identifier "f"`}},
+		{"async fn f() { return await g(); }", []string{`undeclared identifier "g"`}},
+		{"const c = channel(); select { const v = c.recv() { v = 1; } }", []string{`assignment to constant "v"`}},
+		{"const c = channel(); select { let v = c.recv() { } else { v; } }", []string{`undeclared identifier "v"`}},
+		{"struct P { x } fn (p P) f(p) {}", []string{`"p" is already declared in this scope at L1:C20`}},
+		{
+			"const x = 1; x = 2; y = 3; let x = 4;",
+			[]string{
+				`assignment to constant "x"`,
+				`assignment to undeclared identifier "y"`,
+				`"x" is already declared in this scope`,
+			},
+		},
+	}
+	for i, tt := range tests {
+		r := resolveProgram(t, tt.input, fmt.Sprintf("resolve-error-%d", i))
+		errs := r.Errors()
+		if len(errs) != len(tt.expected) {
+			t.Fatalf("wrong number of errors for %q, want=%d, got=%d",
+				tt.input, len(tt.expected), len(errs))
+		}
+		for j, want := range tt.expected {
+			if !strings.Contains(errs[j].Msg, want) {
+				t.Errorf("unexpected error for %q\nwant=%q\ngot=%q", tt.input, want, errs[j].Msg)
+			}
+		}
+	}
+}
+
+func TestResolveValid(t *testing.T) {
+	tests := []string{
+		"let x = 1; x = 2;",
+		"let x = 1; { let x = 2; x = 3; } x = 4;",
+		"const x = 1; { let x = 2; x = 3; }",
+		"const x = 1; fn(x) { x = 2; }",
+		"let n = 0; const inc = fn() { n = n + 1; };",
+		"fn f(a, b = a, ...rest) { a = b; rest = a; }",
+		"fn f() {} fn g() { let f = 1; f = 2; }",
+		"let e = 1; try { throw e; } catch e { e = 2; } finally { e = 3; }",
+		"try { throw 1; } catch { let e = 1; }",
+		"let n = 3; for let i = 0..n { let n = i; n = 1; }",
+		"struct P { x, y } fn (p P) sum() { return p.x + p.y; } fn (p P) len() {} P(1, 2).sum();",
+		"fn f() { return P(1); } struct P { x }",
+		`import "lib/m" as m; export const x = m.f(); export fn g() { return x; }`,
+		"async fn f(x) { return x; } const g = async fn() { return await f(1); }; await g();",
+		"const c = channel(); fn f(x) { c.send(x); } spawn f(1); select { let v = c.recv() { let c = v; } c.send(2) { } }",
+	}
+	for i, input := range tests {
+		r := resolveProgram(t, input, fmt.Sprintf("resolve-valid-%d", i))
+		for _, err := range r.Errors() {
+			t.Errorf("unexpected error for %q: %s", input, err.Msg)
+		}
+	}
+}
+
+func TestResolveErrHighlight(t *testing.T) {
+	r := resolveProgram(t, "const foo = 1;\nfoo = 2;", "highlight")
+	if !r.HasErrors() {
+		t.Fatalf("expected errors")
+	}
+	err := r.Errors()[0]
+	if err.Line != "\x1b[31mfoo\x1b[0m = 2;" {
+		t.Errorf("unexpected highlighted line, got=%q", err.Line)
+	}
+	if err.T.Line != 2 || err.T.Col != 1 || err.T.Type != token.IDENTIFIER {
+		t.Errorf("unexpected error token, got=%s", err.T)
+	}
+	want := "ResolveError: assignment to constant \"foo\" declared at L1:C7 at\n\thighlight:L2:C1"
+	if !strings.HasPrefix(err.Msg, want) {
+		t.Errorf("unexpected message\nwant prefix=%q\ngot=%q", want, err.Msg)
+	}
+}
+
+func TestResolveSymbols(t *testing.T) {
+	input := `let x = 1;
+fn f(a, b = x, ...rest) {
+	let y = a;
+	{
+		let x = y;
+		return len(x) + b;
+	}
+}
+x;`
+	program, table := resolveTable(t, input, "symbols")
+	want := []struct {
+		name  string
+		kind  Kind
+		depth int
+	}{
+		{"x", GLOBAL, 0},
+		{"f", GLOBAL, 0},
+		{"a", PARAMETER, 1},
+		{"b", PARAMETER, 1},
+		{"rest", PARAMETER, 1},
+		{"y", LOCAL, 1},
+		{"x", LOCAL, 2},
+	}
+	symbols := table.Symbols()
+	if len(symbols) != len(want) {
+		t.Fatalf("wrong number of symbols, want=%d, got=%d", len(want), len(symbols))
+	}
+	for i, w := range want {
+		s := symbols[i]
+		if s.Name != w.name || s.Kind != w.kind || s.Depth != w.depth {
+			t.Errorf("symbols[%d] wrong, want=%s %s@%d, got=%s %s@%d",
+				i, w.name, w.kind, w.depth, s.Name, s.Kind, s.Depth)
+		}
+	}
+
+	uses := collectIdentifiers(program)
+	tests := []struct {
+		line     int
+		name     string
+		kind     Kind
+		depth    int
+		distance int
+	}{
+		{2, "x", GLOBAL, 0, 1},
+		{3, "a", PARAMETER, 1, 0},
+		{5, "y", LOCAL, 1, 1},
+		{6, "len", BUILTIN, 0, 2},
+		{6, "x", LOCAL, 2, 0},
+		{6, "b", PARAMETER, 1, 1},
+		{9, "x", GLOBAL, 0, 0},
+	}
+	for _, tt := range tests {
+		ident := uses[fmt.Sprintf("%d:%s", tt.line, tt.name)]
+		if ident == nil {
+			t.Fatalf("no identifier %q found at line %d", tt.name, tt.line)
+		}
+		ref, ok := table.Lookup(ident)
+		if !ok {
+			t.Fatalf("identifier %q at line %d not resolved", tt.name, tt.line)
+		}
+		if ref.Kind != tt.kind || ref.Depth != tt.depth || ref.Distance != tt.distance {
+			t.Errorf("%q at line %d resolved wrong, want=%s@%d+%d, got=%s@%d+%d",
+				tt.name, tt.line, tt.kind, tt.depth, tt.distance, ref.Kind, ref.Depth, ref.Distance)
+		}
+		if tt.kind != BUILTIN && ref.Decl.Token.Line > tt.line {
+			t.Errorf("%q at line %d declared after use at line %d",
+				tt.name, tt.line, ref.Decl.Token.Line)
+		}
+	}
+
+	unused := table.Unused()
+	if len(unused) != 1 || unused[0].Name != "rest" {
+		t.Errorf("unexpected unused symbols, got=%v", unused)
+	}
+}
+
+func TestResolveForwardReference(t *testing.T) {
+	input := `fn f() { return g(); }
+fn g() { n = n + 1; return n; }
+let n = 0;`
+	program, table := resolveTable(t, input, "forward-reference")
+	uses := collectIdentifiers(program)
+	for _, key := range []string{"1:g", "2:n"} {
+		ref, ok := table.Lookup(uses[key])
+		if !ok {
+			t.Fatalf("identifier %s not resolved", key)
+		}
+		if ref.Kind != GLOBAL || ref.Distance != 1 {
+			t.Errorf("identifier %s resolved wrong, got=%s+%d", key, ref.Kind, ref.Distance)
+		}
+	}
+}
+
+func TestResolveUndeclared(t *testing.T) {
+	r := resolveProgram(t, "let x = y + 1; { let z = 1; } z;", "undeclared")
+	errs := r.Errors()
+	if len(errs) != 2 {
+		t.Fatalf("wrong number of errors, want=2, got=%d", len(errs))
+	}
+	for i, want := range []string{`undeclared identifier "y"`, `undeclared identifier "z"`} {
+		if !strings.Contains(errs[i].Msg, want) {
+			t.Errorf("unexpected error\nwant=%q\ngot=%q", want, errs[i].Msg)
+		}
+	}
+}
+
+func resolveTable(t *testing.T, input, name string) (*ast.Program, *Table) {
+	t.Helper()
+	l := lexer.FromString(input)
+	p := parser.New(l, name)
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Fatal(err.Msg)
+	}
+	r := New(l, name)
+	table := r.Resolve(program)
+	for _, err := range r.Errors() {
+		t.Fatal(err.Msg)
+	}
+	return program, table
+}
+
+// collectIdentifiers returns the last identifier
+// read on each line, keyed by line:name
+func collectIdentifiers(program *ast.Program) map[string]*ast.Identifier {
+	uses := make(map[string]*ast.Identifier)
+	var walk func(node ast.Node)
+	walk = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.Program:
+			for _, s := range node.Statements {
+				walk(s)
+			}
+		case *ast.BlockStatement:
+			for _, s := range node.Statements {
+				walk(s)
+			}
+		case *ast.ExpressionStatement:
+			walk(node.Expression)
+		case *ast.AssignStatement:
+			walk(node.Right)
+		case *ast.ReturnStatement:
+			walk(node.ReturnValue)
+		case *ast.InfixExpression:
+			walk(node.Left)
+			walk(node.Right)
+		case *ast.CallExpression:
+			walk(node.Function)
+			for _, a := range node.Arguments {
+				walk(a)
+			}
+		case *ast.Function:
+			for _, p := range node.Parameters {
+				walk(p.Default)
+			}
+			walk(node.Body)
+		case *ast.Identifier:
+			uses[fmt.Sprintf("%d:%s", node.Token.Line, node.Value)] = node
+		}
+	}
+	walk(program)
+	return uses
+}
+
+func resolveProgram(t *testing.T, input, name string) *R {
+	t.Helper()
+	l := lexer.FromString(input)
+	p := parser.New(l, name)
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Fatal(err.Msg)
+	}
+	r := New(l, name)
+	r.Resolve(program)
+	return r
+}
@@ -0,0 +1,33 @@
+package resolve
+
+// scope mirrors a frame of the runtime environment,
+// a new scope is created for every block and function
+type scope struct {
+	names map[string]*Symbol
+	outer *scope
+	depth int
+	// deferred function bodies, resolved when the scope
+	// closes since a closure sees every name of its frame
+	deferred []func()
+}
+
+func newScope(outer *scope) *scope {
+	sc := &scope{names: make(map[string]*Symbol), outer: outer}
+	if outer != nil {
+		sc.depth = outer.depth + 1
+	}
+	return sc
+}
+
+// lookup searches s and its outer scopes for name and
+// returns the symbol and the number of scopes traversed
+func (s *scope) lookup(name string) (*Symbol, int, bool) {
+	distance := 0
+	for sc := s; sc != nil; sc = sc.outer {
+		if sym, ok := sc.names[name]; ok {
+			return sym, distance, true
+		}
+		distance++
+	}
+	return nil, 0, false
+}
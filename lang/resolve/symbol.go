@@ -0,0 +1,84 @@
+package resolve
+
+import "github.com/lindeneg/blue/lang/ast"
+
+// Kind describes where a symbol is declared
+type Kind int
+
+func (k Kind) String() string {
+	return kindName[k]
+}
+
+const (
+	GLOBAL    Kind = iota // declared in the global scope
+	LOCAL                 // declared in a block or function
+	PARAMETER             // parameter of a function
+	BUILTIN               // native function, i.e len
+)
+
+var kindName = map[Kind]string{
+	GLOBAL:    "GLOBAL",
+	LOCAL:     "LOCAL",
+	PARAMETER: "PARAMETER",
+	BUILTIN:   "BUILTIN",
+}
+
+// Symbol is the declaration site of a name
+type Symbol struct {
+	Name string
+	Kind
+	// Depth is the number of scopes enclosing the
+	// declaration, 0 for globals and builtins
+	Depth int
+	// Decl is the declaring identifier, nil for builtins
+	Decl  *ast.Identifier
+	Const bool
+	// Reads is the number of identifiers reading the symbol
+	Reads int
+}
+
+// Ref links an identifier to the symbol it resolves to
+type Ref struct {
+	*Symbol
+	// Distance is the number of scopes between
+	// the identifier and the declaration
+	Distance int
+}
+
+// Table is a side table linking every
+// resolved identifier to its declaration
+type Table struct {
+	refs    map[*ast.Identifier]Ref
+	symbols []*Symbol
+}
+
+func newTable() *Table {
+	return &Table{refs: make(map[*ast.Identifier]Ref)}
+}
+
+// Lookup returns the Ref of ident
+func (t *Table) Lookup(ident *ast.Identifier) (Ref, bool) {
+	ref, ok := t.refs[ident]
+	return ref, ok
+}
+
+// Symbols returns all declared symbols in the order they were declared
+func (t *Table) Symbols() []*Symbol {
+	return t.symbols
+}
+
+// Unused returns all locals and parameters that are never read
+func (t *Table) Unused() []*Symbol {
+	var unused []*Symbol
+	for _, s := range t.symbols {
+		if s.Reads == 0 && (s.Kind == LOCAL || s.Kind == PARAMETER) {
+			unused = append(unused, s)
+		}
+	}
+	return unused
+}
+
+// link records that ident resolves to s, distance scopes away
+func (t *Table) link(ident *ast.Identifier, s *Symbol, distance int) {
+	t.refs[ident] = Ref{Symbol: s, Distance: distance}
+}
@@ -4,17 +4,31 @@ package token
 // containing a keyword to that
 // keyword's appropriate token.Type
 var keywords = map[string]Type{
-	"fn":     FN,
-	"let":    LET,
-	"const":  CONST,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"elif":   ELIF,
-	"else":   ELSE,
-	"return": RETURN,
-	"for":    FOR,
-	"null":   NULL,
+	"fn":      FN,
+	"let":     LET,
+	"const":   CONST,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"elif":    ELIF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"for":     FOR,
+	"null":    NULL,
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"step":    STEP,
+	"struct":  STRUCT,
+	"import":  IMPORT,
+	"as":      AS,
+	"export":  EXPORT,
+	"yield":   YIELD,
+	"spawn":   SPAWN,
+	"select":  SELECT,
+	"async":   ASYNC,
+	"await":   AWAIT,
 }
 
 // Identifier checks if an
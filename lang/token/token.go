@@ -49,7 +49,8 @@ func (t T) String() string {
 }
 
 // Highlight returns a string that contains m,
-// with t being colored by color
+// with t being colored by color. The literal at the
+// column of t is colored, else its first occurrence
 func (t T) Highlight(m string, color Color) string {
 	if m == "" {
 		return m
@@ -57,6 +58,9 @@ func (t T) Highlight(m string, color Color) string {
 	errorTokenEscaped := strings.ReplaceAll(t.Literal, "\n", "\\n")
 	errorTokenEscaped = strings.ReplaceAll(errorTokenEscaped, "\t", "\\t")
 	coloredToken := fmt.Sprintf("%s%s%s", color, errorTokenEscaped, ColorReset)
+	if i := t.Col - 1; i >= 0 && i < len(m) && strings.HasPrefix(m[i:], t.Literal) {
+		return m[:i] + coloredToken + m[i+len(t.Literal):]
+	}
 	return strings.Replace(m, t.Literal, coloredToken, 1)
 }
 
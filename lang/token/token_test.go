@@ -34,3 +34,12 @@ func TestHighlightErr(t *testing.T) {
 		t.Fatalf("highlight failed\nwant=%q\ngot=%q", want, got)
 	}
 }
+
+func TestHighlightColumn(t *testing.T) {
+	input := "a[1]; a[2];"
+	want := "a[1]; a\x1b[31m[\x1b[0m2];"
+	got := T{Type: LBRACKET, Literal: "[", Col: 8}.HighlightErr(input)
+	if got != want {
+		t.Fatalf("highlight failed\nwant=%q\ngot=%q", want, got)
+	}
+}
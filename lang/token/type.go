@@ -18,6 +18,11 @@ const (
 	PLUS                   // +
 	MINUS                  // -
 	BANG                   // !
+	QUESTION               // ? i.e x? or x ? a : b
+	TERNARY                // ? the parser found to start a ternary i.e x ? a : b
+	NULLISH                // ??
+	QDOT                   // ?.
+	QBRACKET               // ?[ the parser found to start an optional index i.e x?[0]
 	STAR                   // *
 	FSLASH                 // /
 	COLON                  // :
@@ -31,12 +36,17 @@ const (
 	GTOE                   // >=
 	AND                    // &&
 	OR                     // ||
+	PIPE                   // |>
 	LPAREN                 // (
 	RPAREN                 // )
 	LBRACE                 // {
 	RBRACE                 // }
 	LBRACKET               // [
 	RBRACKET               // ]
+	DOT                    // .
+	ELLIPSIS               // ...
+	DOTDOT                 // ..
+	DOTDOTEQ               // ..=
 	FN                     // fn keyword
 	LET                    // let keyword
 	CONST                  // const keyword
@@ -48,6 +58,20 @@ const (
 	RETURN                 // return keyword
 	FOR                    // for keyword
 	NULL                   // null keyword
+	THROW                  // throw keyword
+	TRY                    // try keyword
+	CATCH                  // catch keyword
+	FINALLY                // finally keyword
+	STEP                   // step keyword
+	STRUCT                 // struct keyword
+	IMPORT                 // import keyword
+	AS                     // as keyword
+	EXPORT                 // export keyword
+	YIELD                  // yield keyword
+	SPAWN                  // spawn keyword
+	SELECT                 // select keyword
+	ASYNC                  // async keyword
+	AWAIT                  // await keyword
 )
 
 var name = map[Type]string{
@@ -61,6 +85,11 @@ var name = map[Type]string{
 	PLUS:       "+",
 	MINUS:      "-",
 	BANG:       "!",
+	QUESTION:   "?",
+	TERNARY:    "?",
+	NULLISH:    "??",
+	QDOT:       "?.",
+	QBRACKET:   "?[",
 	STAR:       "*",
 	FSLASH:     "/",
 	COLON:      ":",
@@ -74,12 +103,17 @@ var name = map[Type]string{
 	GTOE:       ">=",
 	AND:        "&&",
 	OR:         "||",
+	PIPE:       "|>",
 	LPAREN:     "(",
 	RPAREN:     ")",
 	LBRACE:     "{",
 	RBRACE:     "}",
 	LBRACKET:   "[",
 	RBRACKET:   "]",
+	DOT:        ".",
+	ELLIPSIS:   "...",
+	DOTDOT:     "..",
+	DOTDOTEQ:   "..=",
 	FN:         "FN",
 	LET:        "LET",
 	CONST:      "CONST",
@@ -91,4 +125,18 @@ var name = map[Type]string{
 	RETURN:     "RETURN",
 	FOR:        "FOR",
 	NULL:       "NULL",
+	THROW:      "THROW",
+	TRY:        "TRY",
+	CATCH:      "CATCH",
+	FINALLY:    "FINALLY",
+	STEP:       "STEP",
+	STRUCT:     "STRUCT",
+	IMPORT:     "IMPORT",
+	AS:         "AS",
+	EXPORT:     "EXPORT",
+	YIELD:      "YIELD",
+	SPAWN:      "SPAWN",
+	SELECT:     "SELECT",
+	ASYNC:      "ASYNC",
+	AWAIT:      "AWAIT",
 }
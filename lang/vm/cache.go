@@ -0,0 +1,108 @@
+package vm
+
+import "github.com/lindeneg/blue/lang/object"
+
+// maxPolymorphic is the number of entries an inline cache
+// holds before its access site is considered megamorphic
+const maxPolymorphic = 4
+
+// inlineCache remembers where the member accessed at one site was
+// found. A field is found by the shape of the instance, which tells its
+// slot, and a method by the struct of the instance. A key of a dict is
+// found by the shape of the dict like a field. A site which only
+// sees one shape is monomorphic and hits the first entry, a polymorphic
+// site checks up to maxPolymorphic entries and a megamorphic site, which
+// saw more, looks the members of any other instance up by name.
+//
+// Entries are never invalidated: the slots of a shape are fixed and
+// methods cannot be replaced once they are added to a struct.
+type inlineCache struct {
+	entries     [maxPolymorphic]cacheEntry
+	n           int
+	megamorphic bool
+}
+
+type cacheEntry struct {
+	// shape of the instances holding the field in slot
+	shape *object.Shape
+	slot  int
+	// strukt is set if the member is a method of strukt
+	strukt *object.Struct
+	method *Closure
+}
+
+// find returns the field or the method of inst an entry of ic
+// holds, ok is false if no entry matches inst
+func (ic *inlineCache) find(inst *object.Instance) (field object.Object, method *Closure, ok bool) {
+	for i := 0; i < ic.n; i++ {
+		e := &ic.entries[i]
+		if e.strukt == nil && e.shape == inst.Struct.Shape {
+			return inst.Values[e.slot], nil, true
+		}
+		if e.strukt == inst.Struct {
+			return nil, e.method, true
+		}
+	}
+	return nil, nil, false
+}
+
+// fill looks up the field or the method name of inst after find missed,
+// ok is false if inst has neither. It is added to ic unless ic is
+// megamorphic.
+func (ic *inlineCache) fill(inst *object.Instance, name string) (field object.Object, method *Closure, ok bool) {
+	shape := inst.Struct.Shape
+	if slot, ok := shape.Slot(name); ok {
+		ic.add(cacheEntry{shape: shape, slot: slot})
+		return inst.Values[slot], nil, true
+	}
+	if m, ok := inst.Struct.Methods[name].(*Closure); ok {
+		ic.add(cacheEntry{strukt: inst.Struct, method: m})
+		return nil, m, true
+	}
+	return nil, nil, false
+}
+
+// findKey returns the value of the key of dict an entry
+// of ic holds, ok is false if no entry matches dict
+func (ic *inlineCache) findKey(dict *object.Dict) (val object.Object, ok bool) {
+	for i := 0; i < ic.n; i++ {
+		if e := &ic.entries[i]; e.strukt == nil && e.shape == dict.Shape {
+			return dict.Values[e.slot], true
+		}
+	}
+	return nil, false
+}
+
+// fillKey looks up key in dict after findKey missed, ok is false if
+// dict does not have it. It is added to ic unless ic is megamorphic.
+func (ic *inlineCache) fillKey(dict *object.Dict, key string) (val object.Object, ok bool) {
+	slot, ok := dict.Shape.Slot(key)
+	if !ok {
+		return nil, false
+	}
+	ic.add(cacheEntry{shape: dict.Shape, slot: slot})
+	return dict.Values[slot], true
+}
+
+func (ic *inlineCache) add(e cacheEntry) {
+	if ic.megamorphic {
+		return
+	}
+	if ic.n == maxPolymorphic {
+		// the entries are kept, a megamorphic site stops
+		// adding shapes but still hits the ones it has seen
+		ic.megamorphic = true
+		return
+	}
+	ic.entries[ic.n] = e
+	ic.n++
+}
+
+// lookupMember finds the member name of inst without a cache
+func lookupMember(inst *object.Instance, name string) (field object.Object, method *Closure, ok bool) {
+	if field, ok := inst.Field(name); ok {
+		return field, nil, true
+	}
+	method, ok = inst.Struct.Methods[name].(*Closure)
+	return nil, method, ok
+}
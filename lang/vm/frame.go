@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"github.com/lindeneg/blue/lang/compiler"
+	"github.com/lindeneg/blue/lang/object"
+)
+
+// Closure is a compiled function and the variables it captured
+type Closure struct {
+	Fn       *compiler.Function
+	Upvalues []*Upvalue
+}
+
+func (c *Closure) Type() object.Type { return object.CLOSURE }
+func (c *Closure) String() string {
+	if c.Fn.Name == "" {
+		return "<closure>"
+	}
+	return "<closure " + c.Fn.Name + ">"
+}
+
+// BoundMethod is a method closure bound to its receiver i.e p.len
+type BoundMethod struct {
+	Receiver *object.Instance
+	Method   *Closure
+}
+
+func (m *BoundMethod) Type() object.Type { return object.METHOD }
+func (m *BoundMethod) String() string    { return m.Method.Fn.Name }
+
+// Upvalue is a variable captured by a closure. It refers to the stack
+// slot of the variable while the slot is live and holds the value
+// once the slot is closed.
+type Upvalue struct {
+	ref    *object.Object
+	closed object.Object
+	slot   int
+}
+
+// frame is the activation of a closure
+type frame struct {
+	cl *Closure
+	// ip is the offset of the next instruction
+	ip int
+	// bp is the stack slot of the first local
+	bp int
+	// argc is the number of arguments given by the caller
+	argc int
+	// caches are the inline caches of the function, nil if
+	// it has none or the VM does not cache member lookups
+	caches []inlineCache
+}
+
+// iterator is the state of a for loop, kept on the stack
+type iterator struct {
+	next func() (object.Object, bool)
+	// stop releases an iterator of a host sequence, nil otherwise
+	stop func()
+	slot int
+}
+
+func (it *iterator) Type() object.Type { return object.ITERATOR }
+func (it *iterator) String() string    { return "<iterator>" }
@@ -0,0 +1,228 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+
+	"github.com/lindeneg/blue/lang/compiler"
+	"github.com/lindeneg/blue/lang/object"
+)
+
+var operators = map[compiler.Opcode]string{
+	compiler.OpAdd:          "+",
+	compiler.OpSub:          "-",
+	compiler.OpMul:          "*",
+	compiler.OpDiv:          "/",
+	compiler.OpEqual:        "==",
+	compiler.OpNotEqual:     "!=",
+	compiler.OpLess:         "<",
+	compiler.OpLessEqual:    "<=",
+	compiler.OpGreater:      ">",
+	compiler.OpGreaterEqual: ">=",
+}
+
+// binaryOp applies the binary operator op like the evaluator
+func binaryOp(op compiler.Opcode, left, right object.Object) (object.Object, error) {
+	switch l := left.(type) {
+	case *object.Number:
+		if r, ok := right.(*object.Number); ok {
+			return numberOp(op, l.Value, r.Value)
+		}
+	case *object.String:
+		if r, ok := right.(*object.String); ok {
+			return stringOp(op, l.Value, r.Value)
+		}
+	}
+	switch op {
+	case compiler.OpEqual:
+		return object.Bool(equals(left, right)), nil
+	case compiler.OpNotEqual:
+		return object.Bool(!equals(left, right)), nil
+	}
+	return nil, fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+}
+
+func numberOp(op compiler.Opcode, left, right float64) (object.Object, error) {
+	switch op {
+	case compiler.OpAdd:
+		return &object.Number{Value: left + right}, nil
+	case compiler.OpSub:
+		return &object.Number{Value: left - right}, nil
+	case compiler.OpMul:
+		return &object.Number{Value: left * right}, nil
+	case compiler.OpDiv:
+		if right == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return &object.Number{Value: left / right}, nil
+	case compiler.OpEqual:
+		return object.Bool(left == right), nil
+	case compiler.OpNotEqual:
+		return object.Bool(left != right), nil
+	case compiler.OpLess:
+		return object.Bool(left < right), nil
+	case compiler.OpLessEqual:
+		return object.Bool(left <= right), nil
+	case compiler.OpGreater:
+		return object.Bool(left > right), nil
+	case compiler.OpGreaterEqual:
+		return object.Bool(left >= right), nil
+	}
+	return nil, fmt.Errorf("unknown operator: %s %s %s", object.NUMBER, operators[op], object.NUMBER)
+}
+
+func stringOp(op compiler.Opcode, left, right string) (object.Object, error) {
+	switch op {
+	case compiler.OpAdd:
+		return &object.String{Value: left + right}, nil
+	case compiler.OpEqual:
+		return object.Bool(left == right), nil
+	case compiler.OpNotEqual:
+		return object.Bool(left != right), nil
+	case compiler.OpLess:
+		return object.Bool(left < right), nil
+	case compiler.OpLessEqual:
+		return object.Bool(left <= right), nil
+	case compiler.OpGreater:
+		return object.Bool(left > right), nil
+	case compiler.OpGreaterEqual:
+		return object.Bool(left >= right), nil
+	}
+	return nil, fmt.Errorf("unknown operator: %s %s %s", object.STRING, operators[op], object.STRING)
+}
+
+// equals compares scalars by value and everything else by identity
+func equals(left, right object.Object) bool {
+	switch l := left.(type) {
+	case *object.Number:
+		r, ok := right.(*object.Number)
+		return ok && l.Value == r.Value
+	case *object.String:
+		r, ok := right.(*object.String)
+		return ok && l.Value == r.Value
+	case *object.Boolean:
+		r, ok := right.(*object.Boolean)
+		return ok && l.Value == r.Value
+	case *object.Null:
+		return right.Type() == object.NULL
+	case *object.Result:
+		r, ok := right.(*object.Result)
+		return ok && l.Ok == r.Ok && equals(l.Value, r.Value)
+	}
+	return left == right
+}
+
+// index returns the element of left at idx, or the slice of
+// left if idx is a range
+func index(left, idx object.Object) (object.Object, error) {
+	if r, ok := idx.(*object.Range); ok {
+		return object.Slice(left, r.Bounds(), r.String())
+	}
+	if dict, ok := left.(*object.Dict); ok {
+		key, ok := idx.(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("dict key must be a STRING, got %s", idx.Type())
+		}
+		if val, ok := dict.Get(key.Value); ok {
+			return val, nil
+		}
+		return nil, fmt.Errorf("%s has no key %q", object.DICT, key.Value)
+	}
+	i, ok := toInt(idx)
+	if !ok {
+		return nil, fmt.Errorf("index must be an integer, got %s", idx)
+	}
+	switch left := left.(type) {
+	case *object.Array:
+		if i < 0 || i >= len(left.Elements) {
+			return nil, fmt.Errorf("index %d out of range [0:%d]", i, len(left.Elements))
+		}
+		return left.Elements[i], nil
+	case *object.String:
+		if i < 0 || i >= len(left.Value) {
+			return nil, fmt.Errorf("index %d out of range [0:%d]", i, len(left.Value))
+		}
+		return &object.String{Value: string(left.Value[i])}, nil
+	}
+	return nil, fmt.Errorf("index operator not supported: %s", left.Type())
+}
+
+// newRange creates a range from the bounds given by flags
+func newRange(flags int, start, end, step object.Object) (object.Object, error) {
+	r := &object.Range{
+		Step:      1,
+		OpenStart: flags&compiler.RangeStart == 0,
+		OpenEnd:   flags&compiler.RangeEnd == 0,
+		Inclusive: flags&compiler.RangeInclusive != 0,
+	}
+	bounds := []struct {
+		val object.Object
+		dst *int
+	}{
+		{start, &r.Start},
+		{end, &r.End},
+		{step, &r.Step},
+	}
+	for _, b := range bounds {
+		if b.val == nil {
+			continue
+		}
+		i, ok := toInt(b.val)
+		if !ok {
+			return nil, fmt.Errorf("range bound must be an integer, got %s", b.val)
+		}
+		*b.dst = i
+	}
+	if r.Step == 0 {
+		return nil, errors.New("range step cannot be zero")
+	}
+	return r, nil
+}
+
+// newIterator iterates arrays, ranges and strings in place
+// and pulls the values of any other iterable
+func newIterator(iterable object.Object, slot int) (*iterator, error) {
+	it := &iterator{slot: slot}
+	switch obj := iterable.(type) {
+	case *object.Array:
+		elements := append([]object.Object(nil), obj.Elements...)
+		i := 0
+		it.next = func() (object.Object, bool) {
+			if i >= len(elements) {
+				return nil, false
+			}
+			i++
+			return elements[i-1], true
+		}
+		return it, nil
+	case *object.Range:
+		if !obj.Bounded() {
+			break
+		}
+		i := obj.Start
+		it.next = func() (object.Object, bool) {
+			if !obj.Within(i) {
+				return nil, false
+			}
+			i += obj.Step
+			return &object.Number{Value: float64(i - obj.Step)}, true
+		}
+		return it, nil
+	}
+	values, err := object.Values(iterable)
+	if err != nil {
+		return nil, err
+	}
+	it.next, it.stop = iter.Pull(values)
+	return it, nil
+}
+
+func toInt(obj object.Object) (int, bool) {
+	n, ok := obj.(*object.Number)
+	if !ok || n.Value != math.Trunc(n.Value) {
+		return 0, false
+	}
+	return int(n.Value), true
+}
@@ -0,0 +1,702 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lindeneg/blue/lang/compiler"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/token"
+)
+
+const (
+	// StackSize is the maximum number of slots of the value stack
+	StackSize = 1 << 16
+	// initialStack is the number of slots of the value stack of a new VM
+	initialStack = 1 << 8
+	// MaxFrames is the maximum depth of calls
+	MaxFrames = 1 << 12
+)
+
+// VM executes the bytecode of a compiled program. Every call pushes a
+// frame whose locals live on the value stack, variables captured by
+// closures are shared through upvalues until their slots are closed.
+// A tail call replaces the frame of the caller, so tail recursion
+// runs in constant space.
+//
+// Member accesses look up the field or method of an instance or the
+// key of a dict through inline caches of the accessing function, keyed
+// by the shape of the instance or the dict for fields and keys and by
+// the struct of the instance for methods, so a site seeing few kinds of
+// receivers does not look the member up by name.
+//
+// Runtime errors are returned as *object.Error like the evaluator,
+// positioned with the line tables of the compiled functions.
+type VM struct {
+	constants []object.Object
+	names     []string
+	globals   []object.Object
+	main      *compiler.Function
+
+	// stack grows as functions need it, up to StackSize slots
+	stack []object.Object
+	// sp is the next free slot
+	sp     int
+	frames []frame
+	// fp is the number of active frames
+	fp int
+	// open upvalues, ordered by slot
+	open []*Upvalue
+	// iterators pulling a host sequence, ordered by slot
+	iters []*iterator
+	// caches are the inline caches of every function entered
+	caches map[*compiler.Function][]inlineCache
+	// uncached disables the inline caches
+	uncached bool
+}
+
+// New creates a VM for bc
+func New(bc *compiler.Bytecode) *VM {
+	return &VM{
+		constants: bc.Constants,
+		names:     bc.Globals,
+		globals:   make([]object.Object, len(bc.Globals)),
+		main:      bc.Main,
+		stack:     make([]object.Object, initialStack),
+		frames:    make([]frame, MaxFrames),
+		caches:    make(map[*compiler.Function][]inlineCache),
+	}
+}
+
+// Run executes the program and returns the value of its last
+// statement or of a top-level return, or an *object.Error
+func (vm *VM) Run() object.Object {
+	vm.sp, vm.fp = 0, 0
+	main := &Closure{Fn: vm.main}
+	vm.push(main)
+	if err := vm.enter(main, 0); err != nil {
+		return err
+	}
+	result, err := vm.run(0)
+	if err != nil {
+		vm.unwind(0)
+		return err
+	}
+	return result
+}
+
+// run executes instructions until the frame
+// at depth base returns and returns its result
+func (vm *VM) run(base int) (object.Object, *object.Error) {
+	f := &vm.frames[vm.fp-1]
+	ins := f.cl.Fn.Instructions
+	for {
+		op := compiler.Opcode(ins[f.ip])
+		f.ip++
+		switch op {
+		case compiler.OpConstant:
+			i := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			vm.push(vm.constants[i])
+		case compiler.OpNull:
+			vm.push(object.Nil)
+		case compiler.OpTrue:
+			vm.push(object.True)
+		case compiler.OpFalse:
+			vm.push(object.False)
+		case compiler.OpPop:
+			vm.sp--
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv,
+			compiler.OpEqual, compiler.OpNotEqual, compiler.OpLess,
+			compiler.OpLessEqual, compiler.OpGreater, compiler.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+			result, err := binaryOp(op, left, right)
+			if err != nil {
+				return nil, vm.errorf("%s", err)
+			}
+			vm.push(result)
+		case compiler.OpMinus:
+			n, ok := vm.pop().(*object.Number)
+			if !ok {
+				return nil, vm.errorf("unknown operator: -%s", vm.stack[vm.sp].Type())
+			}
+			vm.push(&object.Number{Value: -n.Value})
+		case compiler.OpNot:
+			vm.push(object.Bool(!object.Truthy(vm.pop())))
+		case compiler.OpJump:
+			f.ip = int(compiler.ReadUint16(ins[f.ip:]))
+		case compiler.OpJumpFalse:
+			if object.Truthy(vm.pop()) {
+				f.ip += 2
+			} else {
+				f.ip = int(compiler.ReadUint16(ins[f.ip:]))
+			}
+		case compiler.OpJumpNotNull:
+			if vm.stack[vm.sp-1].Type() != object.NULL {
+				f.ip = int(compiler.ReadUint16(ins[f.ip:]))
+			} else {
+				f.ip += 2
+			}
+		case compiler.OpJumpSet:
+			if int(ins[f.ip]) < f.argc {
+				f.ip = int(compiler.ReadUint16(ins[f.ip+1:]))
+			} else {
+				f.ip += 3
+			}
+		case compiler.OpGetGlobal:
+			i := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			val := vm.globals[i]
+			if val == nil {
+				return nil, vm.errorf("identifier not found: %q", vm.names[i])
+			}
+			vm.push(val)
+		case compiler.OpSetGlobal:
+			i := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			vm.globals[i] = vm.pop()
+		case compiler.OpGetLocal:
+			vm.push(vm.stack[f.bp+int(ins[f.ip])])
+			f.ip++
+		case compiler.OpSetLocal:
+			vm.stack[f.bp+int(ins[f.ip])] = vm.pop()
+			f.ip++
+		case compiler.OpGetUpvalue:
+			i := int(ins[f.ip])
+			f.ip++
+			val := *f.cl.Upvalues[i].ref
+			if val == nil {
+				return nil, vm.errorf("identifier not found: %q", f.cl.Fn.Upvalues[i].Name)
+			}
+			vm.push(val)
+		case compiler.OpSetUpvalue:
+			*f.cl.Upvalues[ins[f.ip]].ref = vm.pop()
+			f.ip++
+		case compiler.OpCloseUpvalues:
+			vm.closeUpvalues(f.bp + int(ins[f.ip]))
+			f.ip++
+		case compiler.OpArray:
+			n := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			vm.push(&object.Array{Elements: elements})
+		case compiler.OpDict:
+			n := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			dict := object.NewDict()
+			for i := vm.sp - 2*n; i < vm.sp; i += 2 {
+				key, ok := vm.stack[i].(*object.String)
+				if !ok {
+					return nil, vm.errorf("dict key must be a STRING, got %s", vm.stack[i].Type())
+				}
+				dict.Set(key.Value, vm.stack[i+1])
+			}
+			vm.sp -= 2 * n
+			vm.push(dict)
+		case compiler.OpIndex:
+			idx := vm.pop()
+			result, err := index(vm.pop(), idx)
+			if err != nil {
+				return nil, vm.errorf("%s", err)
+			}
+			vm.push(result)
+		case compiler.OpRange:
+			flags := int(ins[f.ip])
+			f.ip++
+			var bounds [3]object.Object
+			for i, flag := range []int{compiler.RangeStep, compiler.RangeEnd, compiler.RangeStart} {
+				if flags&flag != 0 {
+					bounds[2-i] = vm.pop()
+				}
+			}
+			r, err := newRange(flags, bounds[0], bounds[1], bounds[2])
+			if err != nil {
+				return nil, vm.errorf("%s", err)
+			}
+			vm.push(r)
+		case compiler.OpIter:
+			it, err := newIterator(vm.pop(), vm.sp)
+			if err != nil {
+				return nil, vm.errorf("%s", err)
+			}
+			if it.stop != nil {
+				vm.iters = append(vm.iters, it)
+			}
+			vm.push(it)
+		case compiler.OpIterNext:
+			it, ok := vm.stack[vm.sp-1].(*iterator)
+			if !ok {
+				return nil, vm.errorf("cannot iterate over %s", vm.stack[vm.sp-1].Type())
+			}
+			val, ok := it.next()
+			if !ok {
+				vm.stopIterators(vm.sp - 1)
+				vm.sp--
+				f.ip = int(compiler.ReadUint16(ins[f.ip:]))
+				continue
+			}
+			f.ip += 2
+			if err, ok := val.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(val)
+		case compiler.OpClosure:
+			i := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			vm.push(vm.closure(f, vm.constants[i].(*compiler.Function)))
+		case compiler.OpCall:
+			argc := int(ins[f.ip])
+			f.ip++
+			if err := vm.call(vm.stack[vm.sp-1-argc], argc); err != nil {
+				return nil, err
+			}
+			f = &vm.frames[vm.fp-1]
+			ins = f.cl.Fn.Instructions
+		case compiler.OpTailCall:
+			argc := int(ins[f.ip])
+			f.ip++
+			if err := vm.tailCall(f, vm.stack[vm.sp-1-argc], argc); err != nil {
+				return nil, err
+			}
+			f = &vm.frames[vm.fp-1]
+			ins = f.cl.Fn.Instructions
+		case compiler.OpStruct:
+			name := vm.constants[compiler.ReadUint16(ins[f.ip:])].(*object.String)
+			n := int(ins[f.ip+2])
+			f.ip += 3
+			fields := make([]string, n)
+			for i, field := range vm.stack[vm.sp-n : vm.sp] {
+				name, ok := field.(*object.String)
+				if !ok {
+					return nil, vm.errorf("struct field must be a string, got %s", field.Type())
+				}
+				fields[i] = name.Value
+			}
+			vm.sp -= n
+			vm.push(object.NewStruct(name.Value, fields))
+		case compiler.OpMethod:
+			name := vm.constants[compiler.ReadUint16(ins[f.ip:])].(*object.String).Value
+			f.ip += 2
+			cl, ok := vm.pop().(*Closure)
+			if !ok {
+				return nil, vm.errorf("method must be a closure, got %s", vm.stack[vm.sp].Type())
+			}
+			if err := vm.addMethod(vm.stack[vm.sp-1], name, cl); err != nil {
+				return nil, err
+			}
+			vm.stack[vm.sp-1] = cl
+		case compiler.OpGetMember:
+			name := int(compiler.ReadUint16(ins[f.ip:]))
+			ic := int(compiler.ReadUint16(ins[f.ip+2:]))
+			f.ip += 4
+			inst, field, method, err := vm.member(f, vm.stack[vm.sp-1], name, ic)
+			if err != nil {
+				return nil, err
+			}
+			if method != nil {
+				field = &BoundMethod{Receiver: inst, Method: method}
+			}
+			vm.stack[vm.sp-1] = field
+		case compiler.OpInvoke, compiler.OpTailInvoke:
+			name := int(compiler.ReadUint16(ins[f.ip:]))
+			argc := int(ins[f.ip+2])
+			ic := int(compiler.ReadUint16(ins[f.ip+3:]))
+			f.ip += 5
+			inst, callee, method, err := vm.member(f, vm.stack[vm.sp-1-argc], name, ic)
+			if err != nil {
+				return nil, err
+			}
+			if method != nil {
+				// the receiver is the first argument of the method
+				vm.bindReceiver(method, inst, argc)
+				callee = method
+				argc++
+			} else {
+				vm.stack[vm.sp-1-argc] = callee
+			}
+			if op == compiler.OpTailInvoke {
+				err = vm.tailCall(f, callee, argc)
+			} else {
+				err = vm.call(callee, argc)
+			}
+			if err != nil {
+				return nil, err
+			}
+			f = &vm.frames[vm.fp-1]
+			ins = f.cl.Fn.Instructions
+		case compiler.OpReturn:
+			result := vm.pop()
+			vm.unwind(f.bp)
+			vm.sp--
+			vm.fp--
+			if vm.fp == base {
+				return result, nil
+			}
+			vm.push(result)
+			f = &vm.frames[vm.fp-1]
+			ins = f.cl.Fn.Instructions
+		default:
+			return nil, vm.errorf("unknown opcode %d", op)
+		}
+	}
+}
+
+// call calls callee with the argc arguments on top of the stack. A
+// closure is entered, any other callee leaves its result on the stack.
+func (vm *VM) call(callee object.Object, argc int) *object.Error {
+	switch fn := callee.(type) {
+	case *Closure:
+		return vm.enter(fn, argc)
+	case *BoundMethod:
+		vm.bindReceiver(fn.Method, fn.Receiver, argc)
+		return vm.enter(fn.Method, argc+1)
+	case *object.Struct:
+		inst, err := vm.construct(fn, argc)
+		if err != nil {
+			return err
+		}
+		vm.sp -= argc + 1
+		vm.push(inst)
+		return nil
+	case *object.Builtin:
+		args := make([]object.Object, argc)
+		copy(args, vm.stack[vm.sp-argc:vm.sp])
+		result := vm.applyBuiltin(fn, args)
+		if err, ok := result.(*object.Error); ok {
+			return err
+		}
+		vm.sp -= argc + 1
+		vm.push(result)
+		return nil
+	}
+	return vm.errorf("not a function: %s", callee.Type())
+}
+
+// tailCall calls callee with the argc arguments on top of the stack in
+// place of the frame f. A callee which is not a closure is called like
+// any other call and its result is returned by the OpReturn that follows.
+func (vm *VM) tailCall(f *frame, callee object.Object, argc int) *object.Error {
+	if m, ok := callee.(*BoundMethod); ok {
+		vm.bindReceiver(m.Method, m.Receiver, argc)
+		callee, argc = m.Method, argc+1
+	}
+	cl, ok := callee.(*Closure)
+	if !ok {
+		return vm.call(callee, argc)
+	}
+	if err := vm.checkArguments(cl.Fn, argc); err != nil {
+		return err
+	}
+	// leave the frame of f and move the callee and
+	// its arguments to where the callee of f was
+	vm.closeUpvalues(f.bp)
+	vm.stopIterators(f.bp)
+	copy(vm.stack[f.bp-1:], vm.stack[vm.sp-1-argc:vm.sp])
+	vm.sp = f.bp + argc
+	vm.fp--
+	return vm.enter(cl, argc)
+}
+
+// bindReceiver makes recv the first of the argc arguments on
+// top of the stack and method the callee below them
+func (vm *VM) bindReceiver(method *Closure, recv *object.Instance, argc int) {
+	first := vm.sp - argc
+	copy(vm.stack[first+1:vm.sp+1], vm.stack[first:vm.sp])
+	vm.stack[first] = recv
+	vm.stack[first-1] = method
+	vm.sp++
+}
+
+// member looks up the field or method of recv named by the constant
+// name with the inline cache ic of f, method is set if the member is a
+// method. The name is only read if the cache misses.
+func (vm *VM) member(f *frame, recv object.Object, name int, ic int) (inst *object.Instance, field object.Object, method *Closure, err *object.Error) {
+	if dict, ok := recv.(*object.Dict); ok {
+		field, err = vm.key(f, dict, name, ic)
+		return nil, field, nil, err
+	}
+	inst, ok := recv.(*object.Instance)
+	if !ok {
+		return nil, nil, nil, vm.errorf("member access not supported: %s", recv.Type())
+	}
+	if f.caches != nil {
+		if field, method, ok = f.caches[ic].find(inst); ok {
+			return inst, field, method, nil
+		}
+	}
+	key := vm.constants[name].(*object.String).Value
+	if f.caches != nil {
+		field, method, ok = f.caches[ic].fill(inst, key)
+	} else {
+		field, method, ok = lookupMember(inst, key)
+	}
+	if !ok {
+		return nil, nil, nil, vm.errorf("%s has no field or method %q", inst.Struct.Name, key)
+	}
+	return inst, field, method, nil
+}
+
+// key looks up the key of dict named by the constant name with the
+// inline cache ic of f. The name is only read if the cache misses.
+func (vm *VM) key(f *frame, dict *object.Dict, name int, ic int) (object.Object, *object.Error) {
+	if f.caches != nil {
+		if val, ok := f.caches[ic].findKey(dict); ok {
+			return val, nil
+		}
+	}
+	key := vm.constants[name].(*object.String).Value
+	var val object.Object
+	var ok bool
+	if f.caches != nil {
+		val, ok = f.caches[ic].fillKey(dict, key)
+	} else {
+		val, ok = dict.Get(key)
+	}
+	if !ok {
+		return nil, vm.errorf("%s has no key %q", object.DICT, key)
+	}
+	return val, nil
+}
+
+// addMethod adds the method cl to the struct recv
+func (vm *VM) addMethod(recv object.Object, name string, cl *Closure) *object.Error {
+	s, ok := recv.(*object.Struct)
+	if !ok {
+		typ, _, _ := strings.Cut(cl.Fn.Name, ".")
+		return vm.errorf("%q is not a struct, got %s", typ, recv.Type())
+	}
+	if s.HasField(name) {
+		return vm.errorf("method %q conflicts with field of %s", name, s.Name)
+	}
+	if _, ok := s.Methods[name]; ok {
+		return vm.errorf("method %q is already declared on %s", name, s.Name)
+	}
+	s.Methods[name] = cl
+	return nil
+}
+
+// construct creates an instance of s from the argc arguments on
+// top of the stack, every field must be given by position
+func (vm *VM) construct(s *object.Struct, argc int) (*object.Instance, *object.Error) {
+	if argc > len(s.Fields) {
+		return nil, vm.errorf("too many arguments to %s, want=%d, got=%d", s.Name, len(s.Fields), argc)
+	}
+	if argc < len(s.Fields) {
+		return nil, vm.errorf("missing field %q of %s", s.Fields[argc], s.Name)
+	}
+	values := make([]object.Object, argc)
+	copy(values, vm.stack[vm.sp-argc:vm.sp])
+	return &object.Instance{Struct: s, Values: values}, nil
+}
+
+// enter pushes a frame for cl, whose argc arguments are on top of the
+// stack. Remaining arguments are collected if cl has a rest parameter.
+func (vm *VM) enter(cl *Closure, argc int) *object.Error {
+	fn := cl.Fn
+	if err := vm.checkArguments(fn, argc); err != nil {
+		return err
+	}
+	params := len(fn.Params)
+	bp := vm.sp - argc
+	if vm.fp == MaxFrames || !vm.reserve(bp+fn.NumLocals+fn.MaxStack) {
+		return vm.errorf("stack overflow")
+	}
+	var rest *object.Array
+	if fn.Rest {
+		rest = &object.Array{}
+		if argc > params {
+			rest.Elements = append(rest.Elements, vm.stack[bp+params:bp+argc]...)
+		}
+	}
+	for i := bp + min(argc, params); i < bp+max(argc, fn.NumLocals); i++ {
+		vm.stack[i] = nil
+	}
+	if rest != nil {
+		vm.stack[bp+params] = rest
+	}
+	vm.sp = bp + fn.NumLocals
+	vm.frames[vm.fp] = frame{cl: cl, bp: bp, argc: argc, caches: vm.cachesOf(fn)}
+	vm.fp++
+	return nil
+}
+
+// cachesOf returns the inline caches of fn
+func (vm *VM) cachesOf(fn *compiler.Function) []inlineCache {
+	if fn.Caches == 0 || vm.uncached {
+		return nil
+	}
+	caches, ok := vm.caches[fn]
+	if !ok {
+		caches = make([]inlineCache, fn.Caches)
+		vm.caches[fn] = caches
+	}
+	return caches
+}
+
+// checkArguments fails unless fn may be called with argc arguments
+func (vm *VM) checkArguments(fn *compiler.Function, argc int) *object.Error {
+	params := len(fn.Params)
+	if argc > params && !fn.Rest {
+		if fn.Method {
+			// the receiver is not an argument given by the caller
+			params, argc = params-1, argc-1
+		}
+		return vm.errorf("too many arguments, want=%d, got=%d", params, argc)
+	}
+	for i := argc; i < params; i++ {
+		if !fn.Params[i].Default {
+			return vm.errorf("missing argument %q", fn.Params[i].Name)
+		}
+	}
+	return nil
+}
+
+// closure creates a closure of fn, capturing variables of f
+func (vm *VM) closure(f *frame, fn *compiler.Function) *Closure {
+	cl := &Closure{Fn: fn, Upvalues: make([]*Upvalue, len(fn.Upvalues))}
+	for i, uv := range fn.Upvalues {
+		if uv.Local {
+			cl.Upvalues[i] = vm.capture(f.bp + uv.Index)
+		} else {
+			cl.Upvalues[i] = f.cl.Upvalues[uv.Index]
+		}
+	}
+	return cl
+}
+
+// reserve grows the stack to at least n slots and reports
+// whether it fits within StackSize. Open upvalues refer to
+// their slots, so they are moved along with the stack.
+func (vm *VM) reserve(n int) bool {
+	if n <= len(vm.stack) {
+		return true
+	}
+	if n > StackSize {
+		return false
+	}
+	stack := make([]object.Object, min(max(n, 2*len(vm.stack)), StackSize))
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+	for _, uv := range vm.open {
+		uv.ref = &vm.stack[uv.slot]
+	}
+	return true
+}
+
+// capture returns the open upvalue of slot, shared by every closure
+func (vm *VM) capture(slot int) *Upvalue {
+	i := len(vm.open)
+	for i > 0 && vm.open[i-1].slot >= slot {
+		if vm.open[i-1].slot == slot {
+			return vm.open[i-1]
+		}
+		i--
+	}
+	uv := &Upvalue{ref: &vm.stack[slot], slot: slot}
+	vm.open = append(vm.open, nil)
+	copy(vm.open[i+1:], vm.open[i:])
+	vm.open[i] = uv
+	return uv
+}
+
+// closeUpvalues moves the value of every open
+// upvalue from slot and above into the upvalue
+func (vm *VM) closeUpvalues(slot int) {
+	for n := len(vm.open); n > 0 && vm.open[n-1].slot >= slot; n-- {
+		uv := vm.open[n-1]
+		uv.closed = *uv.ref
+		uv.ref = &uv.closed
+		vm.open[n-1] = nil
+		vm.open = vm.open[:n-1]
+	}
+}
+
+// stopIterators releases the iterators from slot and above
+func (vm *VM) stopIterators(slot int) {
+	for n := len(vm.iters); n > 0 && vm.iters[n-1].slot >= slot; n-- {
+		vm.iters[n-1].stop()
+		vm.iters = vm.iters[:n-1]
+	}
+}
+
+// unwind discards the stack from slot
+func (vm *VM) unwind(slot int) {
+	vm.closeUpvalues(slot)
+	vm.stopIterators(slot)
+	vm.sp = slot
+}
+
+// callValue calls callee with args from a builtin and returns the
+// result, which is an *object.Error if the call failed
+func (vm *VM) callValue(callee object.Object, args ...object.Object) object.Object {
+	base, sp := vm.fp, vm.sp
+	if !vm.reserve(sp + 1 + len(args)) {
+		return vm.errorf("stack overflow")
+	}
+	vm.push(callee)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	if err := vm.call(callee, len(args)); err != nil {
+		vm.sp = sp
+		return err
+	}
+	if vm.fp == base {
+		return vm.pop()
+	}
+	result, err := vm.run(base)
+	if err != nil {
+		vm.fp = base
+		vm.unwind(sp)
+		return err
+	}
+	return result
+}
+
+// applyBuiltin calls the native function fn. A Go error returned
+// or a panic raised by fn is returned as an *object.Error.
+func (vm *VM) applyBuiltin(fn *object.Builtin, args []object.Object) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = vm.errorf("builtin %q panicked: %v", fn.Name, r)
+		}
+	}()
+	result, err := fn.Fn(vm.callValue, args...)
+	if err != nil {
+		return vm.errorf("%s", err)
+	}
+	if result == nil {
+		return object.Nil
+	}
+	return result
+}
+
+// errorf creates an error at the instruction executing in the
+// innermost frame, with the position of every call of the stack
+func (vm *VM) errorf(msg string, args ...any) *object.Error {
+	err := &object.Error{Token: vm.position(vm.fp - 1), Msg: fmt.Sprintf(msg, args...)}
+	for i := vm.fp - 1; i > 0; i-- {
+		err.Stack = append(err.Stack, vm.position(i-1))
+	}
+	return err
+}
+
+// position returns the token of the last instruction frame i executed
+func (vm *VM) position(i int) token.T {
+	f := &vm.frames[i]
+	t, _ := f.cl.Fn.Lines.Lookup(f.ip - 1)
+	return t
+}
+
+func (vm *VM) push(obj object.Object) {
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
@@ -0,0 +1,617 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lindeneg/blue/lang/ast"
+	"github.com/lindeneg/blue/lang/compiler"
+	"github.com/lindeneg/blue/lang/evaluator"
+	"github.com/lindeneg/blue/lang/lexer"
+	"github.com/lindeneg/blue/lang/object"
+	"github.com/lindeneg/blue/lang/optimize"
+	"github.com/lindeneg/blue/lang/parser"
+	"github.com/lindeneg/blue/lang/resolve"
+)
+
+// TestRun runs every program on the VM and on the evaluator,
+// both must produce the expected value
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3 - 4 / 2;", "5"},
+		{"-(1 + 2) < 0 == !false;", "true"},
+		{`"foo" + "bar" == "foobar";`, "true"},
+		{`"a" < "b";`, "true"},
+		{"null ?? 1;", "1"},
+		{"2 ?? 1;", "2"},
+		{"[1, 2] == [1, 2];", "false"},
+		{"false ? 1 : 2;", "2"},
+		{`"hello"[..5];`, "hello"},
+		{`let s = "hello"; [s[1..=2], s[..-2], s[..0 step -1]];`, "[el, hel, olle]"},
+		{"[1, 2, 3][1..=2];", "[2, 3]"},
+		{"let a = [1, 2, 3, 4]; [a[.. step 2], a[-1..]];", "[[1, 3], [4]]"},
+		{"[1, [2, 3]][1][0];", "2"},
+		{`let k = "b"; let d = {"a": 1, k: [2], "a": 3}; [d, len(d), d.a, d["b"][0]];`, "[{a: 3, b: [2]}, 2, 3, 2]"},
+		{`let d = {"f": fn(x) { return x * 2; }}; d.f(21);`, "42"},
+		{`fn f(o) { return o.x; } [f({"x": 1}), f({"y": 2, "x": 3}), f({"x": 4, "z": 5})];`, "[1, 3, 4]"},
+		{`"blue"[2];`, "u"},
+		{"0..=10 step 5;", "0..=10 step 5"},
+		{"let a = 1; a = a + 1; a;", "2"},
+		{"{ let a = 1; { let b = a + 1; b; } }", "2"},
+		{"if 1 > 2 { 1 } elif 2 > 1 { 2 } else { 3 }", "2"},
+		{"if false { 1 }", "null"},
+		{"let s = 0; for const i = 0..5 { s = s + i; } s;", "10"},
+		{"let s = 0; for let x = [1, 2, 3] { s = s + x; } s;", "6"},
+		{`let s = ""; for const c = "abc" { s = c + s; } s;`, "cba"},
+		{"let s = 0; for const x = map([1, 2], fn(x) { return x * 10; }) { s = s + x; } s;", "30"},
+		{"fn add(a, b) { return a + b; } add(1, 2);", "3"},
+		{"fn f() { } f();", "null"},
+		{"fn f(a, b = a * 2) { return b; } [f(1), f(1, 5)];", "[2, 5]"},
+		{"fn f(a, ...rest) { return [a, rest]; } [f(1), f(1, 2, 3)];", "[[1, []], [1, [2, 3]]]"},
+		{"fn fib(n) { return n < 2 ? n : fib(n - 1) + fib(n - 2); } fib(15);", "610"},
+		{"len([1, 2, 3]) + len(\"ab\");", "5"},
+		{"filter([1, 2, 3, 4], fn(x) { return x > 2; });", "<filter>"},
+		{"let xs = []; for const x = filter([1, 2, 3, 4], fn(x) { return x > 2; }) { xs = [xs, x]; } xs;", "[[[], 3], 4]"},
+		{"return 5; 6;", "5"},
+		{
+			`fn counter() {
+				let n = 0;
+				return fn() { n = n + 1; return n; };
+			}
+			const c = counter();
+			c(); c();
+			const d = counter();
+			[c(), d()];`,
+			"[3, 1]",
+		},
+		{
+			`fn outer() {
+				let x = 1;
+				const get = fn() { return fn() { return x; }; };
+				x = 2;
+				return get();
+			}
+			outer()();`,
+			"2",
+		},
+		{
+			`let fns = [];
+			for const i = 0..3 {
+				fns = [fns, fn() { return i; }];
+			}
+			[fns[0][0][1](), fns[0][1](), fns[1]()];`,
+			"[0, 1, 2]",
+		},
+		{
+			`let fns = [];
+			for const i = 0..2 {
+				let j = i * 10;
+				fns = [fns, fn() { j = j + 1; return j; }];
+			}
+			const a = fns[0][1];
+			const b = fns[1];
+			a();
+			[a(), b()];`,
+			"[2, 11]",
+		},
+		{
+			`fn f() {
+				const g = fn() { return y; };
+				let y = 5;
+				return g();
+			}
+			f();`,
+			"5",
+		},
+		{
+			`fn f(x) {
+				const g = fn() { return y; };
+				if x { return 1; } else { return g(); }
+				let y = 5;
+			}
+			f(true);`,
+			"1",
+		},
+		{"fn f() { return 1; 2; } if false { 3 } elif 1 < 2 { f() + 5 * 60 } else { 4 }", "301"},
+		{"let x = 2; [x * 1, x + 0, -x + 0, (x - 1) * 1, if null { 1 }];", "[2, 2, -2, 1, null]"},
+		{"let x = 0; [-x + 0, 0 + -x, -x - 0, -x * 1, 1 * -x, -x / 1];", "[0, 0, -0, -0, -0, -0]"},
+		{"struct Point { x, y } const p = Point(1, 2); [p, p.x, p.y, Point];", "[Point{x: 1, y: 2}, 1, 2, struct Point { x, y }]"},
+		{
+			`struct Point { x, y }
+			fn (p Point) add(o) { return Point(p.x + o.x, p.y + o.y); }
+			fn (p Point) len() { return p.x + p.y; }
+			Point(1, 2).add(Point(3, 4)).len();`,
+			"10",
+		},
+		{
+			`struct Counter { n }
+			fn (c Counter) next(by = c.n) { return Counter(c.n + by); }
+			Counter(1).next().next(5);`,
+			"Counter{n: 7}",
+		},
+		{
+			`struct Point { x, y }
+			let p = Point(1, 2);
+			fn (p Point) sum() { return p.x + p.y; }
+			const f = p.sum;
+			let r = [];
+			for const v = map([p, Point(3, 4)], fn(q) { return q.sum(); }) { r = [r, v]; }
+			[f(), f, r];`,
+			"[3, Point.sum, [[[], 3], 7]]",
+		},
+		{
+			`struct A { x, y }
+			struct B { x, y }
+			struct C { y, x }
+			struct D { x, get }
+			fn (a A) get() { return a.y; }
+			fn (b B) get() { return b.x; }
+			fn (c C) get() { return c.y; }
+			let s = [];
+			for const o = [A(1, 2), B(3, 4), C(5, 6), A(7, 8), D(9, fn() { return 90; })] {
+				s = [s, o.x, o.get()];
+			}
+			s;`,
+			"[[[[[[], 1, 2], 3, 3], 6, 5], 7, 8], 9, 90]",
+		},
+	}
+	for _, tt := range tests {
+		got := runVM(t, tt.input)
+		if got.String() != tt.expected {
+			t.Errorf("wrong VM result for %q\nwant=%s\ngot=%s", tt.input, tt.expected, got)
+		}
+		want := evaluator.Eval(parse(t, tt.input), object.NewEnvironment())
+		if got.String() != want.String() {
+			t.Errorf("VM disagrees with the evaluator for %q\nevaluator=%s\nvm=%s", tt.input, want, got)
+		}
+		data, err := compiler.Marshal(compile(t, tt.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bc, err := compiler.Unmarshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded := New(bc).Run(); decoded.String() != got.String() {
+			t.Errorf("decoded bytecode disagrees for %q\nwant=%s\ngot=%s", tt.input, got, decoded)
+		}
+		if optimized := New(compileWith(t, tt.input, true)).Run(); optimized.String() != got.String() {
+			t.Errorf("optimized bytecode disagrees for %q\nwant=%s\ngot=%s", tt.input, got, optimized)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0;", "RuntimeError: division by zero at L1:C3"},
+		{`1 + "a";`, "RuntimeError: unknown operator: NUMBER + STRING at L1:C3"},
+		{`-"a";`, "RuntimeError: unknown operator: -STRING at L1:C1"},
+		{"[1][3];", "RuntimeError: index 3 out of range [0:1] at L1:C4"},
+		{"[1][..5];", "RuntimeError: slice bounds out of range [..5] with length 1 at L1:C4"},
+		{"1();", "RuntimeError: not a function: NUMBER at L1:C2"},
+		{"fn f(a) { } f(1, 2);", "RuntimeError: too many arguments, want=1, got=2 at L1:C14"},
+		{"fn f(a) { } f();", `RuntimeError: missing argument "a" at L1:C14`},
+		{"len(1);", "RuntimeError: argument to len not supported, got NUMBER at L1:C4"},
+		{"for const i = 0.. { }", "RuntimeError: cannot iterate over unbounded range 0.. at L1:C5"},
+		{"0..1 step 0;", "RuntimeError: range step cannot be zero at L1:C2"},
+		{"fn f() { return g(); } f(); let g = 1;", `RuntimeError: identifier not found: "g" at L1:C17` + "\n\tcalled at L1:C25"},
+		{
+			"fn f() { const g = fn() { return y; }; g(); let y = 1; } f();",
+			`RuntimeError: identifier not found: "y" at L1:C34` + "\n\tcalled at L1:C41\n\tcalled at L1:C59",
+		},
+		{"struct P { x } P(1).y;", `RuntimeError: P has no field or method "y" at L1:C21`},
+		{"struct P { x } P(1).y();", `RuntimeError: P has no field or method "y" at L1:C22`},
+		{"struct P { x } P(1, 2);", "RuntimeError: too many arguments to P, want=1, got=2 at L1:C17"},
+		{"struct P { x, y } P(1);", `RuntimeError: missing field "y" of P at L1:C20`},
+		{"struct P { x } P(1).x();", "RuntimeError: not a function: NUMBER at L1:C22"},
+		{"struct P { x } fn (p P) f(a) {} P(1).f(1, 2);", "RuntimeError: too many arguments, want=1, got=2 at L1:C39"},
+		{"let P = 1; fn (p P) f() {}", `RuntimeError: "P" is not a struct, got NUMBER at L1:C21`},
+		{"struct P { x } fn (p P) x() {}", `RuntimeError: method "x" conflicts with field of P at L1:C25`},
+		{"struct P { x } fn (p P) f() {} fn (p P) f() {}", `RuntimeError: method "f" is already declared on P at L1:C41`},
+		{"1.x;", "RuntimeError: member access not supported: NUMBER at L1:C3"},
+		{`let d = {"a": 1}; d.b;`, `RuntimeError: DICT has no key "b" at L1:C21`},
+		{`let d = {"a": 1}; d["b"];`, `RuntimeError: DICT has no key "b" at L1:C20`},
+		{`let d = {"a": 1}; d[0];`, "RuntimeError: dict key must be a STRING, got NUMBER at L1:C20"},
+		{`let d = {"a": 1, 2: 3};`, "RuntimeError: dict key must be a STRING, got NUMBER at L1:C9"},
+	}
+	for _, tt := range tests {
+		got := runVM(t, tt.input)
+		if got.String() != tt.expected {
+			t.Errorf("wrong error for %q\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `fn a(x) {
+	return 1 / x;
+}
+fn b(x) {
+	return a(x);
+}
+fn c() {
+	return b(0) + 1;
+}
+c();`
+	got := runVM(t, input)
+	// b tail calls a, the frame of b is replaced by the frame of a
+	want := "RuntimeError: division by zero at L2:C11\n\tcalled at L8:C10\n\tcalled at L10:C2"
+	if got.String() != want {
+		t.Errorf("unexpected stack trace\nwant=%q\ngot=%q", want, got)
+	}
+	evaluated := evaluator.Eval(parse(t, input), object.NewEnvironment())
+	if evaluated.String() != want {
+		t.Errorf("evaluator disagrees\nwant=%q\ngot=%q", want, evaluated)
+	}
+}
+
+// TestTailCalls recurses far deeper than MaxFrames,
+// which only tail calls replacing frames allow
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`fn count(n, acc) {
+				if n == 0 {
+					return acc;
+				}
+				return count(n - 1, acc + 1);
+			}
+			count(1000000, 0);`,
+			"1000000",
+		},
+		{
+			`fn even(n) {
+				if n == 0 { return true; } elif n == 1 { return false; } else { return odd(n - 1); }
+			}
+			fn odd(n) {
+				if n == 0 { return false; } else { { return even(n - 1); } }
+			}
+			[even(100000), odd(100001)];`,
+			"[true, true]",
+		},
+		{
+			`fn loop(n, fns = []) {
+				if n == 0 { return fns; }
+				let i = n;
+				return loop(n - 1, [fns, fn() { return i; }]);
+			}
+			const fns = loop(3);
+			[fns[1](), fns[0][1](), fns[0][0][1]()];`,
+			"[1, 2, 3]",
+		},
+		{"fn f(n, ...rest) { if n == 0 { return rest; } return f(n - 1, n, rest); } f(2);", "[1, [2, []]]"},
+		{"fn f(xs) { return len(xs); } f([1, 2]) + 1;", "3"},
+		{"fn g(x, y) { return x * y; } let s = 0; for const x = map([1, 2], fn(x) { return g(x, 10); }) { s = s + x; } s;", "30"},
+		{"fn f(n) { if n == 0 { return 1 / n; } return f(n - 1); } fn g() { return f(3) + 1; } g();", "RuntimeError: division by zero at L1:C32\n\tcalled at L1:C75\n\tcalled at L1:C87"},
+		{"fn f(a) { return a; } fn g() { return f(); } g();", "RuntimeError: missing argument \"a\" at L1:C40\n\tcalled at L1:C47"},
+		{"fn f() { return 1(); } f();", "RuntimeError: not a function: NUMBER at L1:C18\n\tcalled at L1:C25"},
+		{
+			`struct List { n, next }
+			fn (l List) len(acc = 0) {
+				if l.next == null { return acc + 1; }
+				return l.next.len(acc + 1);
+			}
+			fn (l List) push(n) { return List(n, l); }
+			fn build(l, n) {
+				if n == 0 { return l; }
+				return build(l.push(n), n - 1);
+			}
+			const long = build(List(0, null), 100000);
+			const count = long.len;
+			[long.len(), count(), List(1, null).push];`,
+			"[100001, 100001, List.push]",
+		},
+		{"struct P { f } fn g() { return P(len).f([1]); } g();", "1"},
+		{"struct P { x } fn (p P) f() { return p.y; } fn g() { return P(1).f(); } g();", "RuntimeError: P has no field or method \"y\" at L1:C40\n\tcalled at L1:C74"},
+	}
+	for _, tt := range tests {
+		got := runVM(t, tt.input)
+		if got.String() != tt.expected {
+			t.Errorf("wrong VM result for %q\nwant=%s\ngot=%s", tt.input, tt.expected, got)
+		}
+		want := evaluator.Eval(parse(t, tt.input), object.NewEnvironment())
+		if got.String() != want.String() {
+			t.Errorf("VM disagrees with the evaluator for %q\nevaluator=%s\nvm=%s", tt.input, want, got)
+		}
+	}
+}
+
+// TestRunDecodedBytecode runs bytecode no compiler produced,
+// which Unmarshal accepts, the VM must fail with an error
+func TestRunDecodedBytecode(t *testing.T) {
+	tests := []struct {
+		main     *compiler.Function
+		expected string
+	}{
+		{
+			&compiler.Function{Instructions: slices.Concat(
+				compiler.Make(compiler.OpNull),
+				compiler.Make(compiler.OpIterNext, 8),
+				compiler.Make(compiler.OpPop),
+				compiler.Make(compiler.OpJump, 1),
+				compiler.Make(compiler.OpNull),
+				compiler.Make(compiler.OpReturn),
+			)},
+			"RuntimeError: cannot iterate over NULL",
+		},
+		{
+			&compiler.Function{Instructions: slices.Concat(
+				compiler.Make(compiler.OpNull),
+				compiler.Make(compiler.OpNull),
+				compiler.Make(compiler.OpMethod, 0),
+				compiler.Make(compiler.OpReturn),
+			)},
+			"RuntimeError: method must be a closure, got NULL",
+		},
+	}
+	for _, tt := range tests {
+		bc := &compiler.Bytecode{Main: tt.main, Constants: []object.Object{&object.String{Value: "x"}}}
+		data, err := compiler.Marshal(bc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bc, err = compiler.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		if got := New(bc).Run(); !strings.HasPrefix(got.String(), tt.expected) {
+			t.Errorf("wrong result, want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	got := runVM(t, "fn f(n) { return f(n + 1) + 1; } f(0);")
+	err, ok := got.(*object.Error)
+	if !ok || err.Msg != "stack overflow" {
+		t.Fatalf("expected a stack overflow, got=%s", got)
+	}
+	if len(err.Stack) != MaxFrames-1 {
+		t.Errorf("wrong stack depth, want=%d, got=%d", MaxFrames-1, len(err.Stack))
+	}
+}
+
+// TestStackOverflowOperands fills the stack with the
+// operands of a frame rather than with frames
+func TestStackOverflowOperands(t *testing.T) {
+	elements := strings.TrimSuffix(strings.Repeat("0, ", math.MaxUint16), ", ")
+	got := runVM(t, "fn f() { return ["+elements+"]; }\n[1, 2, 3, f()];")
+	want := "RuntimeError: stack overflow at L2:C12"
+	if got.String() != want {
+		t.Errorf("unexpected error\nwant=%q\ngot=%q", want, got)
+	}
+}
+
+// TestStackGrowth grows the stack while a
+// variable captured by a closure is open
+func TestStackGrowth(t *testing.T) {
+	got := runVM(t, `fn outer() {
+		let x = 1;
+		const inc = fn() { x = x + 1; return x; };
+		fn deep(n) { if n == 0 { return inc(); } return deep(n - 1) + 0; }
+		deep(1000);
+		return x + inc();
+	}
+	outer();`)
+	if got.String() != "5" {
+		t.Errorf("wrong result, want=5, got=%s", got)
+	}
+}
+
+func TestBuiltinPanic(t *testing.T) {
+	object.Builtins["vmExplode"] = &object.Builtin{
+		Name: "vmExplode",
+		Fn: func(_ object.Caller, args ...object.Object) (object.Object, error) {
+			panic("kaboom")
+		},
+	}
+	defer delete(object.Builtins, "vmExplode")
+	got := runVM(t, "fn f() { return vmExplode(); }\nf();")
+	want := `RuntimeError: builtin "vmExplode" panicked: kaboom at L1:C26` + "\n\tcalled at L2:C2"
+	if got.String() != want {
+		t.Errorf("unexpected error\nwant=%q\ngot=%q", want, got)
+	}
+}
+
+// TestInlineCaches checks the entries the caches of f hold after
+// accessing the members of the instances f is called with
+func TestInlineCaches(t *testing.T) {
+	structs := `struct A { x } struct B { x } struct C { y, x } struct D { z, x }
+	struct E { w, x } struct F { v, x } fn (a A) m() { return 1; } fn (b B) m() { return 2; }
+	`
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn f(o) { return o.x; } f(A(1)); f(A(2));", []string{"monomorphic"}},
+		// instances of A and B share a shape
+		{"fn f(o) { return o.x; } f(A(1)); f(B(2));", []string{"monomorphic"}},
+		{"fn f(o) { return o.x; } f(A(1)); f(C(2, 3)); f(D(4, 5));", []string{"polymorphic 3"}},
+		{"fn f(o) { return o.x; } for const o = [A(1), C(2, 3), D(4, 5), E(6, 7), F(8, 9), A(10)] { f(o); }", []string{"megamorphic"}},
+		{"fn f(o) { return o.m() + o.x; } f(A(1)); f(B(2));", []string{"polymorphic 2", "monomorphic"}},
+		{"fn f(o) { return [o.m, o.y]; } f(A(1));", []string{"monomorphic", "empty"}},
+		{"fn f(o) { return o.y; } f(A(1));", []string{"empty"}},
+		// dicts share shapes with each other and with instances
+		{`fn f(o) { return o.x; } f({"x": 1}); f({"x": 2}); f(A(3));`, []string{"monomorphic"}},
+		{`fn f(o) { return o.x; } f({"x": 1}); f({"y": 2, "x": 3}); f(C(4, 5));`, []string{"polymorphic 2"}},
+		{`fn f(o) { return o.x; } for const o = [{"x": 1}, {"a": 1, "x": 2}, {"b": 1, "x": 3}, {"c": 1, "x": 4}, {"d": 1, "x": 5}] { f(o); }`, []string{"megamorphic"}},
+		{`fn f(o) { return o.m(); } f({"m": fn() { return 1; }});`, []string{"monomorphic"}},
+	}
+	for _, tt := range tests {
+		bc := compile(t, structs+tt.input)
+		vm := New(bc)
+		vm.Run()
+		var caches []inlineCache
+		for fn, c := range vm.caches {
+			if fn.Name == "f" {
+				caches = c
+			}
+		}
+		if len(caches) != len(tt.expected) {
+			t.Fatalf("wrong number of caches for %q, want=%d, got=%d", tt.input, len(tt.expected), len(caches))
+		}
+		for i, ic := range caches {
+			got := "empty"
+			switch {
+			case ic.megamorphic:
+				got = "megamorphic"
+			case ic.n == 1:
+				got = "monomorphic"
+			case ic.n > 1:
+				got = fmt.Sprintf("polymorphic %d", ic.n)
+			}
+			if got != tt.expected[i] {
+				t.Errorf("wrong state of cache %d for %q, want=%s, got=%s", i, tt.input, tt.expected[i], got)
+			}
+		}
+	}
+}
+
+const fibProgram = `fn fib(n) {
+	return n < 2 ? n : fib(n - 1) + fib(n - 2);
+}
+fib(30);`
+
+const stringProgram = `let s = "";
+for const i = 0..2000 {
+	s = s + "ab";
+	if s[i] == "a" { s = s + "c"; }
+}
+len(s);`
+
+// fieldProgram reads fields and calls methods of instances of two
+// structs, whose fields are in different slots, at the same sites.
+// The instances are created once so member access is the main cost.
+const fieldProgram = `struct Vec { x, y, z }
+struct Scaled { k, x, y, z }
+fn (v Vec) first() { return v.x; }
+fn (s Scaled) first() { return s.k; }
+fn read(o) {
+	let t = o.x; t = o.y; t = o.z;
+	t = o.z; t = o.y; t = o.x;
+	return o.first();
+}
+const a = Vec(1, 2, 3);
+const b = Scaled(2, 3, 4, 5);
+let n = null;
+for const i = 0..20000 {
+	n = read(a);
+	n = read(b);
+}
+n;`
+
+// dictProgram reads the keys of two dicts, whose keys are in
+// different slots, at the same sites like fieldProgram.
+const dictProgram = `fn read(o) {
+	let t = o.x; t = o.y; t = o.z;
+	t = o.z; t = o.y; t = o.x;
+	return o.first;
+}
+const a = {"x": 1, "y": 2, "z": 3, "first": 1};
+const b = {"first": 2, "x": 3, "y": 4, "z": 5};
+let n = null;
+for const i = 0..20000 {
+	n = read(a);
+	n = read(b);
+}
+n;`
+
+func BenchmarkFibVM(b *testing.B)           { benchmarkVM(b, fibProgram) }
+func BenchmarkFibEvaluator(b *testing.B)    { benchmarkEvaluator(b, fibProgram) }
+func BenchmarkStringVM(b *testing.B)        { benchmarkVM(b, stringProgram) }
+func BenchmarkStringEvaluator(b *testing.B) { benchmarkEvaluator(b, stringProgram) }
+func BenchmarkFieldsVM(b *testing.B)        { benchmarkVM(b, fieldProgram) }
+func BenchmarkFieldsEvaluator(b *testing.B) { benchmarkEvaluator(b, fieldProgram) }
+func BenchmarkFieldsUncachedVM(b *testing.B) {
+	benchmarkVM(b, fieldProgram, func(vm *VM) { vm.uncached = true })
+}
+func BenchmarkDictsVM(b *testing.B)        { benchmarkVM(b, dictProgram) }
+func BenchmarkDictsEvaluator(b *testing.B) { benchmarkEvaluator(b, dictProgram) }
+func BenchmarkDictsUncachedVM(b *testing.B) {
+	benchmarkVM(b, dictProgram, func(vm *VM) { vm.uncached = true })
+}
+
+// benchmarkVM runs input, setup is applied to every VM before it runs
+func benchmarkVM(b *testing.B, input string, setup ...func(*VM)) {
+	bc := compile(b, input)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm := New(bc)
+		for _, f := range setup {
+			f(vm)
+		}
+		if result, ok := vm.Run().(*object.Error); ok {
+			b.Fatal(result)
+		}
+	}
+}
+
+func benchmarkEvaluator(b *testing.B, input string) {
+	program := parse(b, input)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if result, ok := evaluator.Eval(program, object.NewEnvironment()).(*object.Error); ok {
+			b.Fatal(result)
+		}
+	}
+}
+
+func runVM(t *testing.T, input string) object.Object {
+	t.Helper()
+	return New(compile(t, input)).Run()
+}
+
+func compile(t testing.TB, input string) *compiler.Bytecode {
+	t.Helper()
+	return compileWith(t, input, false)
+}
+
+// compileWith compiles input, optimizing the program if optimized is set
+func compileWith(t testing.TB, input string, optimized bool) *compiler.Bytecode {
+	t.Helper()
+	l := lexer.FromString(input)
+	p := parser.New(l, "vm-test")
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Fatal(err.Msg)
+	}
+	r := resolve.New(l, "vm-test")
+	table := r.Resolve(program)
+	for _, err := range r.Errors() {
+		t.Fatal(err.Msg)
+	}
+	if optimized {
+		o := optimize.New(l, "vm-test")
+		o.Optimize(program)
+		for _, err := range o.Errors() {
+			t.Fatal(err.Msg)
+		}
+	}
+	c := compiler.New(l, "vm-test")
+	bc := c.Compile(program, table)
+	for _, err := range c.Errors() {
+		t.Fatal(strings.TrimSpace(err.Msg))
+	}
+	return bc
+}
+
+func parse(t testing.TB, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.FromString(input), "vm-test")
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Fatal(err.Msg)
+	}
+	return program
+}